@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default number of results the error rate of AbortErrorRate is
+// computed over.
+const defaultAbortWindow = 100
+
+// abortCheck tells when the run crossed its error thresholds, as the
+// results are collected: a number of errors in total, or a percentage
+// of errors over the last results. The rate is only checked once the
+// window is full, so that a few early errors do not abort the run.
+type abortCheck struct {
+	errors int
+	rate   float64
+	// Outcome of the last results, in a ring, and the number of
+	// failures among them.
+	window []bool
+	pos    int
+	seen   int
+	failed int
+	total  int
+}
+
+func newAbortCheck(errors int, rate float64, window int) *abortCheck {
+	if window <= 0 {
+		window = defaultAbortWindow
+	}
+	a := &abortCheck{errors: errors, rate: rate}
+	if rate > 0 {
+		a.window = make([]bool, window)
+	}
+	return a
+}
+
+// Adds the outcome of a result, and returns why the run should be
+// aborted, or an empty string if no threshold is crossed.
+func (a *abortCheck) add(failed bool) string {
+	if failed {
+		a.total++
+	}
+	if a.errors > 0 && a.total >= a.errors {
+		return fmt.Sprintf("%d errors", a.total)
+	}
+	if a.window == nil {
+		return ""
+	}
+	if a.window[a.pos] {
+		a.failed--
+	}
+	a.window[a.pos] = failed
+	if failed {
+		a.failed++
+	}
+	a.pos = (a.pos + 1) % len(a.window)
+	if a.seen < len(a.window) {
+		if a.seen++; a.seen < len(a.window) {
+			return ""
+		}
+	}
+	if rate := float64(a.failed) / float64(len(a.window)) * 100; rate > a.rate {
+		return fmt.Sprintf("%.2f%% errors over the last %d requests", rate, len(a.window))
+	}
+	return ""
+}
+
+// Aborted tells when and why the run was aborted.
+type Aborted struct {
+	// Offset from the start of the run of the result crossing the
+	// threshold.
+	At     time.Duration `json:"at_ns"`
+	Reason string        `json:"reason"`
+}
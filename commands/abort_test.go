@@ -0,0 +1,47 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import "testing"
+
+func TestAbortCheck_Count(t *testing.T) {
+	a := newAbortCheck(3, 0, 0)
+	for i, failed := range []bool{true, false, true, false} {
+		if reason := a.add(failed); reason != "" {
+			t.Fatalf("Expected no abort at result %d, %q is found", i, reason)
+		}
+	}
+	if reason := a.add(true); reason != "3 errors" {
+		t.Errorf("Expected an abort at the third error, %q is found", reason)
+	}
+}
+
+func TestAbortCheck_Rate(t *testing.T) {
+	a := newAbortCheck(0, 10, 20)
+	// The first results all failed, but the rate is computed over a
+	// full window: 2 of 20 is not above 10%.
+	for i := 0; i < 40; i++ {
+		if reason := a.add(i < 2); reason != "" {
+			t.Fatalf("Expected no abort at result %d, %q is found", i, reason)
+		}
+	}
+	var reason string
+	for i := 0; i < 20 && reason == ""; i++ {
+		reason = a.add(i%4 == 0)
+	}
+	if reason != "15.00% errors over the last 20 requests" {
+		t.Errorf("Expected an abort once the rate is over 10%%, %q is found", reason)
+	}
+}
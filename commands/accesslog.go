@@ -0,0 +1,167 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// Number of paths listed as the slowest ones.
+const slowestPaths = 10
+
+// Lines of the supported access log formats, the request line is
+// the first quoted field.
+var logFormats = map[string]*regexp.Regexp{
+	"common":   regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]+\] "(\S+) (\S+)(?: [^"]*)?" \d{3} \S+$`),
+	"combined": regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]+\] "(\S+) (\S+)(?: [^"]*)?" \d{3} \S+ "[^"]*" "[^"]*"`),
+}
+
+// LogRequest is a request of an access log.
+type LogRequest struct {
+	Method string
+	Path   string
+}
+
+// AccessLog is the requests of an access log, in the order of its lines.
+type AccessLog struct {
+	Requests []LogRequest
+	// Number of lines that could not be parsed.
+	Skipped int
+}
+
+// LoadAccessLog reads the requests of an access log file, in the
+// "common" or "combined" format.
+func LoadAccessLog(path, format string) (*AccessLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadAccessLog(f, format)
+}
+
+// ReadAccessLog reads the requests of an access log. Lines that cannot
+// be parsed are counted and skipped, it fails if none can.
+func ReadAccessLog(r io.Reader, format string) (*AccessLog, error) {
+	re, ok := logFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	l := &AccessLog{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			l.Skipped++
+			continue
+		}
+		if _, err := url.ParseRequestURI(m[2]); err != nil || m[2][0] != '/' {
+			l.Skipped++
+			continue
+		}
+		l.Requests = append(l.Requests, LogRequest{Method: m[1], Path: m[2]})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.Requests) == 0 {
+		return nil, errors.New("access log has no request")
+	}
+	return l, nil
+}
+
+// Sets the request of the job to the i-th request of the log, or a
+// random one, sent to BaseUrl.
+func (b *Boom) setLogRequest(j *job, i int) {
+	reqs := b.Log.Requests
+	lr := reqs[i%len(reqs)]
+	if b.UrlOrder == "random" {
+		lr = reqs[rand.Intn(len(reqs))]
+	}
+	opts := *b.Req
+	opts.Method, opts.Url = lr.Method, b.BaseUrl+lr.Path
+	j.req, j.err = opts.Request(), nil
+	j.path, j.rawBody = lr.Path, b.rawBody
+}
+
+// PathStats is the latency of the requests of an access log path.
+type PathStats struct {
+	Path    string  `json:"path"`
+	Count   int     `json:"count"`
+	Errors  int     `json:"errors"`
+	Average float64 `json:"average"`
+	Slowest float64 `json:"slowest"`
+
+	total float64
+}
+
+func (r *Report) addToPath(res *result) {
+	ps := r.paths[res.path]
+	if ps == nil {
+		ps = &PathStats{Path: res.path}
+		r.paths[res.path] = ps
+	}
+	ps.Count++
+	if res.err != nil {
+		ps.Errors++
+		return
+	}
+	lat := res.duration.Seconds()
+	ps.total += lat
+	if lat > ps.Slowest {
+		ps.Slowest = lat
+	}
+}
+
+// Keeps the paths of the highest average latencies.
+func (r *Report) finalizePaths() {
+	r.SlowestPaths = nil
+	for _, ps := range r.paths {
+		if n := ps.Count - ps.Errors; n > 0 {
+			ps.Average = ps.total / float64(n)
+			r.SlowestPaths = append(r.SlowestPaths, ps)
+		}
+	}
+	sort.Slice(r.SlowestPaths, func(i, j int) bool {
+		a, b := r.SlowestPaths[i], r.SlowestPaths[j]
+		if a.Average != b.Average {
+			return a.Average > b.Average
+		}
+		return a.Path < b.Path
+	})
+	if len(r.SlowestPaths) > slowestPaths {
+		r.SlowestPaths = r.SlowestPaths[:slowestPaths]
+	}
+}
+
+func (r *Report) printSlowestPaths() {
+	fmt.Fprintf(r.w, "\nSlowest paths:\n")
+	for _, ps := range r.SlowestPaths {
+		fmt.Fprintf(r.w, "  %s:\t%d requests, average %4.4f secs, slowest %4.4f secs\n", ps.Path, ps.Count, ps.Average, ps.Slowest)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAccessLog = `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 "http://example.com/" "Mozilla/4.08"
+10.0.0.2 - frank [10/Oct/2000:13:55:37 -0700] "POST /api/items?x=1 HTTP/1.1" 201 12 "-" "curl/7.0"
+not a log line
+10.0.0.3 - - [10/Oct/2000:13:55:38 -0700] "-" 400 0 "-" "-"
+
+10.0.0.4 - - [10/Oct/2000:13:55:39 -0700] "GET /slow HTTP/1.1" 200 - "-" "-"
+`
+
+func TestReadAccessLog(t *testing.T) {
+	l, err := ReadAccessLog(strings.NewReader(testAccessLog), "combined")
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	want := []LogRequest{{"GET", "/index.html"}, {"POST", "/api/items?x=1"}, {"GET", "/slow"}}
+	if !reflect.DeepEqual(l.Requests, want) {
+		t.Errorf("Expected %v, %v is found", want, l.Requests)
+	}
+	if l.Skipped != 2 {
+		t.Errorf("Expected 2 skipped lines, %v is found", l.Skipped)
+	}
+
+	common := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0" 200 2326`
+	if l, err := ReadAccessLog(strings.NewReader(common), "common"); err != nil || len(l.Requests) != 1 {
+		t.Errorf("Expected the common format to be parsed, %v is found", err)
+	}
+	if _, err := ReadAccessLog(strings.NewReader(common), "combined"); err == nil {
+		t.Errorf("Expected a log without requests to be rejected")
+	}
+	if _, err := ReadAccessLog(strings.NewReader(common), "nginx"); err == nil {
+		t.Errorf("Expected an unknown format to be rejected")
+	}
+}
+
+func TestRun_AccessLog(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		reqs []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reqs = append(reqs, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		if r.URL.Path == "/base/slow" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	l, _ := ReadAccessLog(strings.NewReader(testAccessLog), "combined")
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL + "/base/index.html",
+		},
+		Log:     l,
+		BaseUrl: server.URL + "/base",
+		N:       6,
+		C:       1,
+		Output:  "quiet",
+		Writer:  ioutil.Discard,
+	}
+	rpt := boom.Run()
+	want := []string{"GET /base/index.html", "POST /base/api/items?x=1", "GET /base/slow"}
+	for i, r := range reqs {
+		if r != want[i%3] {
+			t.Errorf("Expected request %d to be %q, %q is found", i+1, want[i%3], r)
+		}
+	}
+	if rpt.LogSkipped != 2 {
+		t.Errorf("Expected 2 skipped lines, %v is found", rpt.LogSkipped)
+	}
+	if len(rpt.SlowestPaths) != 3 {
+		t.Fatalf("Expected 3 paths, %v are found", len(rpt.SlowestPaths))
+	}
+	if ps := rpt.SlowestPaths[0]; ps.Path != "/slow" || ps.Count != 2 || ps.Average < 0.02 {
+		t.Errorf("Expected /slow to be the slowest path, %+v is found", ps)
+	}
+}
+
+func TestFinalizePaths(t *testing.T) {
+	rpt := newReport(0, nil, "", ioutil.Discard)
+	for i := 0; i < 15; i++ {
+		rpt.addToPath(&result{path: "/" + string(rune('a'+i)), duration: time.Duration(i) * time.Millisecond})
+	}
+	rpt.finalizePaths()
+	if len(rpt.SlowestPaths) != 10 || rpt.SlowestPaths[0].Path != "/o" || rpt.SlowestPaths[9].Path != "/f" {
+		t.Errorf("Expected the 10 slowest paths, %v is found", rpt.SlowestPaths)
+	}
+}
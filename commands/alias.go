@@ -0,0 +1,81 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// aliasTable picks indexes at random, with a probability proportional
+// to their weight, in constant time. See Vose's alias method.
+type aliasTable struct {
+	// Probability of each index to be kept rather than replaced by its
+	// alias, once picked uniformly.
+	prob  []float64
+	alias []int
+}
+
+func newAliasTable(weights []float64) (*aliasTable, error) {
+	n := len(weights)
+	if n == 0 {
+		return nil, errors.New("no weight")
+	}
+	var sum float64
+	for _, w := range weights {
+		if w <= 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return nil, errors.New("weights must be positive")
+		}
+		sum += w
+	}
+	t := &aliasTable{prob: make([]float64, n), alias: make([]int, n)}
+	// Scaled so that the average weight is 1, indexes below it share
+	// their slot with one above it.
+	scaled := make([]float64, n)
+	var small, large []int
+	for i, w := range weights {
+		scaled[i] = w * float64(n) / sum
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small = small[:len(small)-1]
+		t.prob[s], t.alias[s] = scaled[s], l
+		scaled[l] -= 1 - scaled[s]
+		if scaled[l] < 1 {
+			large = large[:len(large)-1]
+			small = append(small, l)
+		}
+	}
+	// The rest is 1, up to rounding errors.
+	for _, i := range append(small, large...) {
+		t.prob[i], t.alias[i] = 1, i
+	}
+	return t, nil
+}
+
+// Returns an index at random, safe for concurrent use.
+func (t *aliasTable) pick() int {
+	i := rand.Intn(len(t.prob))
+	if rand.Float64() < t.prob[i] {
+		return i
+	}
+	return t.alias[i]
+}
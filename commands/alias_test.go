@@ -0,0 +1,45 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAliasTable(t *testing.T) {
+	weights := []float64{9, 1, 0.5, 4.5}
+	at, err := newAliasTable(weights)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	const n = 200000
+	counts := make([]int, len(weights))
+	for i := 0; i < n; i++ {
+		counts[at.pick()]++
+	}
+	for i, w := range weights {
+		want := w / 15
+		if got := float64(counts[i]) / n; math.Abs(got-want) > 0.01 {
+			t.Errorf("Expected index %d to be picked %.3f of the time, %.3f is found", i, want, got)
+		}
+	}
+
+	for _, weights := range [][]float64{nil, {1, 0}, {-1}, {math.Inf(1)}} {
+		if _, err := newAliasTable(weights); err == nil {
+			t.Errorf("Expected weights %v to be rejected", weights)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Config is the configuration of a run of Run, a subset of the options
+// of Boom.
+type Config struct {
+	// URL and method of the requests, GET by default.
+	Url    string
+	Method string
+	Header http.Header
+	Body   string
+	// Number of requests, ignored if Duration is set, and number of
+	// concurrent workers.
+	N int
+	C int
+	// Optional rate limit, in requests per second over all the workers.
+	Qps int
+	// Optional duration of the run, in lieu of a number of requests.
+	Duration time.Duration
+	// Optional timeout in seconds of each request, of its connection,
+	// and of its response headers once the request is written.
+	Timeout        int
+	ConnectTimeout time.Duration
+	HeaderTimeout  time.Duration
+	// Optional transport of the requests, instead of those boom makes,
+	// see Boom.Transport. ConnectTimeout and HeaderTimeout then have no
+	// effect.
+	Transport http.RoundTripper
+	// Optional callback passed every completed request, see
+	// Boom.OnResult.
+	OnResult func(Result)
+}
+
+// Run makes the requests of cfg and returns the report, with all its
+// statistics, without printing anything. Cancelling ctx stops the run,
+// the report is then made over the results received so far. Use Boom
+// for the other options.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.Url == "" {
+		return nil, errors.New("the URL is required")
+	}
+	if cfg.C <= 0 {
+		return nil, errors.New("the concurrency must be positive")
+	}
+	if cfg.Duration == 0 && cfg.N < cfg.C {
+		return nil, errors.New("the number of requests cannot be less than the concurrency")
+	}
+	method := cfg.Method
+	if method == "" {
+		method = "GET"
+	}
+	header := cfg.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	b := &Boom{
+		Req: &ReqOpts{
+			Method: method,
+			Url:    cfg.Url,
+			Header: header,
+			Body:   cfg.Body,
+		},
+		N:              cfg.N,
+		C:              cfg.C,
+		Qps:            cfg.Qps,
+		Duration:       cfg.Duration,
+		Timeout:        cfg.Timeout,
+		ConnectTimeout: cfg.ConnectTimeout,
+		HeaderTimeout:  cfg.HeaderTimeout,
+		Transport:      cfg.Transport,
+		OnResult:       cfg.OnResult,
+	}
+	return b.RunContext(ctx)
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+		if r.Method != "POST" || r.Header.Get("X-Test") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	rpt, err := Run(context.Background(), Config{
+		Url:    server.URL,
+		Method: "POST",
+		Header: http.Header{"X-Test": {"1"}},
+		Body:   "body",
+		N:      20,
+		C:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 20 {
+		t.Errorf("Expected to boom 20 times, found %v", count)
+	}
+	if rpt.StatusCodeDist[200] != 20 {
+		t.Errorf("Expected 20 responses with status 200, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.RPS <= 0 || rpt.Average <= 0 || rpt.Slowest < rpt.Fastest || len(rpt.LatencyDistribution) == 0 {
+		t.Errorf("Expected the statistics to be computed, %+v is found", rpt)
+	}
+
+	if _, err := Run(context.Background(), Config{Url: server.URL, N: 1, C: 2}); err == nil {
+		t.Errorf("Expected an error if N is less than C")
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		Duration: time.Minute,
+		C:        2,
+		Writer:   &buf,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	rpt, err := boom.RunContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Expected the run to stop with its context, it lasted %v", d)
+	}
+	if !rpt.Interrupted || rpt.StatusCodeDist[200] == 0 {
+		t.Errorf("Expected an interrupted run with results, %v and %v are found", rpt.Interrupted, rpt.StatusCodeDist)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Expected nothing to be printed, %q is found", buf.String())
+	}
+	rpt.Print()
+	if buf.Len() == 0 {
+		t.Errorf("Expected the report to be printed")
+	}
+}
+
+// stubTransport answers every request with a canned response, 404 for
+// the path /missing and 200 otherwise.
+type stubTransport struct {
+	count int64
+}
+
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&s.count, 1)
+	resp := &http.Response{
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("hello")),
+		Request:    req,
+	}
+	if req.URL.Path == "/missing" {
+		resp.StatusCode = 404
+	}
+	return resp, nil
+}
+
+func TestRun_Transport(t *testing.T) {
+	tr := &stubTransport{}
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "http://example.invalid/",
+		},
+		Urls:             []string{"http://example.invalid/", "http://example.invalid/missing"},
+		N:                20,
+		C:                4,
+		DisableKeepAlive: true,
+		Transport:        tr,
+		Writer:           ioutil.Discard,
+	}
+	rpt, err := boom.RunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.count != 20 {
+		t.Errorf("Expected 20 requests through the transport, %v is found", tr.count)
+	}
+	if rpt.StatusCodeDist[200] != 10 || rpt.StatusCodeDist[404] != 10 {
+		t.Errorf("Expected 10 responses with status 200 and 404, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.SizeTotal != 100 || len(rpt.Errors) > 0 || rpt.ErrorRate != 0 {
+		t.Errorf("Expected 100 bytes and no error, %v, %v and %v are found", rpt.SizeTotal, rpt.Errors, rpt.ErrorRate)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+)
+
+// Maximum length of the body kept as example of a failed assertion.
+const snippetSize = 256
+
+// snippet keeps the first bytes written to it and discards the rest.
+type snippet struct {
+	buf []byte
+}
+
+func (s *snippet) Write(p []byte) (int, error) {
+	if n := snippetSize - len(s.buf); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		s.buf = append(s.buf, p[:n]...)
+	}
+	return len(p), nil
+}
+
+// Matches the body against re as it is read, so that large bodies are
+// not held in memory. Reading stops at the first match. Returns true
+// and the start of the body if it does not match.
+func checkBody(re *regexp.Regexp, body io.Reader) (bool, string) {
+	var s snippet
+	if re.MatchReader(bufio.NewReader(io.TeeReader(body, &s))) {
+		return false, ""
+	}
+	return true, string(s.buf)
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCheckBody(t *testing.T) {
+	re := regexp.MustCompile(`order-\d+`)
+	if failed, _ := checkBody(re, strings.NewReader(`{"id":"order-42"}`)); failed {
+		t.Errorf("Expected the body to match")
+	}
+	failed, s := checkBody(re, strings.NewReader(`{"id":"order-"}`))
+	if !failed || s != `{"id":"order-"}` {
+		t.Errorf("Expected the body not to match, with its snippet, %v and %q are found", failed, s)
+	}
+}
+
+func TestCheckBody_Large(t *testing.T) {
+	re := regexp.MustCompile(regexp.QuoteMeta(`"ok":true`))
+	body := strings.Repeat("a", 1<<20)
+	if failed, _ := checkBody(re, strings.NewReader(body+`"ok":true`)); failed {
+		t.Errorf("Expected the end of the body to match")
+	}
+	failed, s := checkBody(re, strings.NewReader(body))
+	if !failed || len(s) != snippetSize {
+		t.Errorf("Expected a snippet of %v bytes, %v is found", snippetSize, len(s))
+	}
+}
@@ -16,18 +16,134 @@
 package commands
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
-
-	"github.com/rakyll/pb"
 )
 
+// A request to make, handed out to the workers.
+type job struct {
+	req *http.Request
+	// Sequence number of the request, in the order it was issued.
+	seq int
+	// Index of the worker making the request, or of its client if the
+	// arrival rate is constant.
+	worker int
+	// URL of the request if picked from a list of URLs.
+	url string
+	// Set if the request could not be created.
+	err error
+	// Number of the entry of the request, counting from 1, if any.
+	entry int
+	// Path of the request if picked from an access log.
+	path string
+	// User-Agent header of the request if picked from a list.
+	userAgent string
+	// ID of the request, if it is sent in a header.
+	requestID string
+	// Values to extract from the response of the entry, if any, into
+	// the variables of the iteration. Set if the extraction failed, the
+	// iteration is then aborted.
+	extract []Extraction
+	vars    map[string]string
+	abort   bool
+	// Size of the body before compression, and time spent compressing
+	// it, if compressed.
+	rawBody  int64
+	compress time.Duration
+	// Time the request was due, as of the rate limit or arrival rate,
+	// if latencies are corrected.
+	intended time.Time
+}
+
 type result struct {
 	err           error
 	statusCode    int
+	proto         string
+	url           string
+	seq           int
+	worker        int
+	start         time.Time
 	duration      time.Duration
 	contentLength int64
+	// Bytes of the request body sent, and before compression if it
+	// is compressed.
+	sent    int64
+	rawSent int64
+	// Time spent compressing the body.
+	compress time.Duration
+	// Set if the body was longer than MaxBody, and not read past it.
+	truncated bool
+	// Response to save, if it is part of the sample.
+	sample *sample
+	// Number of the entry of the request, counting from 1, if any.
+	entry int
+	// Path of the request if picked from an access log.
+	path string
+	// User-Agent header of the request if picked from a list.
+	userAgent string
+	// ID of the request, if it is sent in a header.
+	requestID string
+	// Reasons of the retried attempts, if any.
+	retries []string
+	// Number of redirects followed to get the response.
+	redirects int
+	// Set if the response carried a Set-Cookie header.
+	setCookie bool
+	// Time spent signing the request, before it was sent.
+	signing time.Duration
+	// Set if a Digest challenge was answered before the request.
+	challenged bool
+	// Set if the body was sent without a 100 Continue response.
+	continueTimeout bool
+	// TLS version and cipher suite of the handshake of the request, zero
+	// if the connection was reused or is not TLS.
+	tlsVersion  uint16
+	cipherSuite uint16
+	// Address family of the connection, if it is a new one.
+	family string
+	// Local IP of the connection, if it is a new one from a set address.
+	localAddr string
+	// Server IP of the connection, if it is a new one and DNSEach is set.
+	serverAddr string
+	// Number of connections dialed for the request.
+	dials int
+	// Durations of the stages of the request.
+	timings timings
+	// Latency from the time the request was due, if corrected.
+	corrected time.Duration
+	// Set if the body failed the assertion, with the start of the body.
+	assertFailed bool
+	snippet      string
+	// Start of the body, if values are extracted from it.
+	body *capped
+}
+
+// Results are put back once collected, unless kept for the output.
+var resultPool = sync.Pool{New: func() interface{} { return new(result) }}
+
+// Returns a result from the pool, starting now.
+func newResult() *result {
+	res := resultPool.Get().(*result)
+	*res = result{contentLength: -1, start: time.Now()}
+	return res
+}
+
+// Resolution is the lookup of a host, made once before the run.
+type Resolution struct {
+	Host string `json:"host"`
+	// Addresses the host resolved to, and the one connected to.
+	Addrs []string `json:"addrs"`
+	Addr  string   `json:"addr"`
 }
 
 type ReqOpts struct {
@@ -37,53 +153,407 @@ type ReqOpts struct {
 	Body     string
 	Username string
 	Password string
+	// Bearer token, sent unless Username and Password are set.
+	Bearer string
+	// Option to authenticate with Digest rather than Basic, using
+	// Username and Password.
+	Digest bool
+	// Cookies sent with every request, besides those of the jar if any.
+	Cookies []*http.Cookie
+	// Optional multipart/form-data body, sent instead of Body with its
+	// content-type.
+	Multipart *Multipart
+	// Optional name of the request, e.g. of a step of a scenario, used
+	// by the report.
+	Name string
+	// Optional values captured from the response if the request is an
+	// entry. The entries are then templates of the captured variables.
+	Extract []Extraction
 	// Request host is an resolved IP. TLS/SSL handshakes may require
 	// the original server name, keep it to initate the TLS client.
 	OriginalHost string
 }
 
-// Creates a req object from req options
+// Creates a req object from req options. The body is read from a new
+// reader for each request, so it can be replayed.
 func (r *ReqOpts) Request() *http.Request {
 	req, _ := http.NewRequest(r.Method, r.Url, strings.NewReader(r.Body))
-	req.Header = r.Header
+	req.Header = r.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if m := r.Multipart; m != nil {
+		// The length is known, the body is not sent chunked.
+		req.Body, req.ContentLength = m.body(), m.Len()
+		req.GetBody = func() (io.ReadCloser, error) {
+			return m.body(), nil
+		}
+		req.Header.Set("Content-Type", m.ContentType())
+	}
 
 	// update the Host value in the Request - this is used as the host header in any subsequent request
 	req.Host = r.OriginalHost
 
-	if r.Username != "" && r.Password != "" {
+	// an explicit Authorization header takes precedence
+	if r.Username != "" && r.Password != "" && !r.Digest && req.Header.Get("Authorization") == "" {
 		req.SetBasicAuth(r.Username, r.Password)
+	} else if r.Bearer != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+r.Bearer)
+	}
+	for _, c := range r.Cookies {
+		req.AddCookie(c)
 	}
 	return req
 }
 
+// Step is a phase of a step-load run.
+type Step struct {
+	Qps      int
+	Duration time.Duration
+}
+
 type Boom struct {
 	// Request to make.
 	Req *ReqOpts
-	// Total number of requests to make.
+	// Optional list of URLs, requests are made to each of them in turn
+	// rather than to the URL of Req. Their host is used as Host header,
+	// unless Req.OriginalHost is set.
+	Urls []string
+	// Order in which the URLs are picked, "random" or round-robin.
+	UrlOrder string
+	// Optional weights of the URLs, in the same order. If set, each
+	// request is sent to a URL picked at random with a probability
+	// proportional to its weight, whatever UrlOrder.
+	UrlWeights []float64
+	// Optional sequence of requests, e.g. the entries of a HAR file. Each
+	// worker makes them in order, over and over, with the method, URL,
+	// headers and body of the entry and the other options of Req. They
+	// are not templates.
+	Entries []*ReqOpts
+	// Optional requests of an access log, sent to BaseUrl in the order
+	// of UrlOrder with the method and path of their line and the other
+	// options of Req. They are not templates.
+	Log     *AccessLog
+	BaseUrl string
+	// Option to disable the templates in the URLs and body. By default,
+	// they are rendered for each request, e.g. /item/{{rand_int 1 100}}.
+	NoTemplate bool
+	// Optional data feed, a row is used by each request as template data.
+	Data *DataFeed
+	// Order in which the rows are used, "random" or round-robin.
+	DataOrder string
+	// Option to stop the run once every row is used, rather than to
+	// start over.
+	DataStop bool
+	// Optional name of a query parameter added to each request with a
+	// random UUID, so that caches do not serve them. Option to send a
+	// "Cache-Control: no-cache" header with each request.
+	CacheBust string
+	NoCache   bool
+	// Optional User-Agent headers, each request is sent with one of them
+	// in the order of UserAgentOrder, "random" or round-robin. They take
+	// precedence over that of the request.
+	UserAgents     []string
+	UserAgentOrder string
+	// Optional header set to a unique ID on each request, so that the
+	// requests can be found in the logs of the server. The ID is a random
+	// UUID or, if RequestIDSeq is set, a random prefix of the run followed
+	// by the sequence number of the request. Retries keep the ID.
+	RequestIDHeader string
+	RequestIDSeq    bool
+	// Total number of requests to make, ignored if Duration is set.
 	N int
+	// Duration of the run. If set, requests are made until it expires.
+	Duration time.Duration
+	// Optional hard deadline of the run. Once it expires, in-flight
+	// requests are cancelled and the report covers the results so far.
+	MaxDuration time.Duration
+	// Warmup period and number of warmup requests. Requests issued
+	// during the warmup are made but excluded from the report.
+	Warmup         time.Duration
+	WarmupRequests int
+	// Ramp-up period, workers are started one after the other until all
+	// of them are running at its end. Requests issued during the ramp are
+	// counted in the report, unless they are excluded as those of the
+	// warmup, which -ramp-exclude does by extending Warmup to the ramp.
+	Ramp time.Duration
 	// Concurrency level, the number of concurrent workers to run.
 	C int
-	// Timeout in seconds.
+	// Timeout in seconds of each request, redirects and body included.
 	Timeout int
-	// Rate limit.
+	// Optional timeouts of the connection, and of the response headers
+	// once the request is written. Both are within Timeout.
+	ConnectTimeout time.Duration
+	HeaderTimeout  time.Duration
+	// Idle connection pool of the transports, as of http.Transport.
+	// MaxIdlePerHost defaults to C.
+	MaxIdleConns    int
+	MaxIdlePerHost  int
+	IdleConnTimeout time.Duration
+	// Rate limit, in requests per second over all the workers.
 	Qps int
+	// Optional time each worker waits between receiving a response and
+	// sending its next request, as users do between actions. The rate
+	// limit, if any, still applies: the next request is sent once the
+	// think time is over and its slot is due. Think time does not apply
+	// to the constant arrival rate.
+	Think time.Duration
+	// Option to apply the rate limit to each worker instead.
+	QpsPerWorker bool
+	// Option to correct the latencies for coordinated omission, if a rate
+	// limit, steps or an arrival rate is set. Due requests are then sent
+	// as soon as possible, however late, and their latency is also
+	// measured from the time they were due. The report has both.
+	CorrectLatency bool
+	// Optional constant arrival rate, in requests per second. Requests are
+	// then sent on schedule whether previous ones completed or not, with at
+	// most C of them in flight.
+	Rate int
+	// Optional load steps, each one with its own rate limit. The run lasts
+	// as long as the steps and the report includes a summary per step.
+	Steps []Step
+	// Optional expected status codes. Responses with any other status are
+	// counted as failed, by default any 2xx status is a success.
+	ExpectedStatus []int
+	// Option to count the responses that are not a success in the error
+	// rate, besides the requests that failed without a response.
+	Non2xxErrors bool
+	// Option to also report the number of errors per message, rather
+	// than per category only.
+	VerboseErrors bool
+	// Optional assertion on the response bodies, those not matching are
+	// counted as failed. Bodies are matched as they are read.
+	AssertBody *regexp.Regexp
+	// Option to send the body with chunked transfer encoding rather than
+	// with its Content-Length, ChunkSize bytes at a time. ChunkSize
+	// defaults to 4KB.
+	Chunked   bool
+	ChunkSize int
+	// Option to send an "Expect: 100-continue" header with the requests
+	// that have a body, which is then sent once the server replies 100
+	// Continue, or after ContinueTimeout if it does not. ContinueTimeout
+	// defaults to 1s.
+	ExpectContinue  bool
+	ContinueTimeout time.Duration
+	// Option to send the body compressed with gzip. It is compressed
+	// once, or for each request if it is a template.
+	GzipBody bool
+	// Option to count the successful responses whose JSON body has a
+	// GraphQL errors array, or is not JSON, as failed requests.
+	GraphQLErrors bool
+	// Option not to read the response bodies, their size is then the
+	// Content-Length header, if any. By default, bodies are read to
+	// the end and their bytes counted, so that connections are reused.
+	NoBodyRead bool
+	// Optional maximum number of bytes read per body. Longer bodies are
+	// truncated, and their connection closed rather than reused.
+	MaxBody int64
+	// Option not to keep the first failure, whose response is printed
+	// at the end of the report otherwise.
+	NoFirstFailure bool
+	// Optional directory where up to SaveSample responses per status
+	// code are written, headers included, up to SaveMaxBytes in total.
+	SaveDir      string
+	SaveSample   int
+	SaveMaxBytes int64
+	// Optional length of the intervals of the time series, the report
+	// then includes statistics per interval.
+	TimeSeries time.Duration
+	// Optional thresholds checked at the end of the run, the report
+	// tells whether they are met.
+	SLA *SLA
+	// Optional error thresholds checked as the results are collected:
+	// a number of failed requests, and a percentage of failed requests
+	// over the last AbortWindow results, 100 by default, checked once that
+	// many are collected. Failures are counted as of the error rate,
+	// warmup excluded. Once one is crossed, the run is stopped as Stop
+	// does and the report tells when.
+	AbortErrors    int
+	AbortErrorRate float64
+	AbortWindow    int
+	// Optional address to serve live Prometheus metrics on during the
+	// run, at /metrics.
+	MetricsAddr string
+	// Optional StatsD server address, a timing per request and a counter
+	// per error are sent to it over UDP. A fraction of the results is sent
+	// if StatsdSample is in (0, 1), each metric name starts with the prefix.
+	StatsdAddr   string
+	StatsdPrefix string
+	StatsdSample float64
+	// Optional path of a file each result is written to as it is
+	// collected, gzipped CSV, so that its report can be made again with
+	// other options, see Replay.
+	Record string
+	// Measurement name of the influx output, defaults to "boom".
+	Measurement string
+	// Number of times a request is retried on connection-level failures,
+	// and on 5xx responses if Retry5xx is set. Only the last attempt is
+	// part of the report. Retries apply whatever the method is.
+	Retries  int
+	Retry5xx bool
+	// Delay before the first retry, doubled with each retry.
+	RetryBackoff time.Duration
+	// Option to report redirect responses as is rather than to follow
+	// them. Followed redirects are part of the latency of the request.
+	NoRedirects bool
+	// Option to give each worker its own cookie jar, cookies set by the
+	// responses are then sent back by the following requests of the worker.
+	// Jars are per worker even if workers share connections.
+	CookieJar bool
+	// Option to give each worker a new cookie jar each time it starts
+	// over the sequence of Entries, so that the cookies set by an entry
+	// are only sent by the following ones of the same iteration. It takes
+	// precedence over CookieJar.
+	IterationJar bool
+	// Optional AWS Signature Version 4 signer. Each request is signed by
+	// its worker before it is sent, the signing time is not part of the
+	// latency but is reported.
+	AWS *AWSSigner
+	// Optional client certificate presented to the servers asking for one.
+	ClientCert *tls.Certificate
+	// Optional pool of CAs the server certificates are verified against,
+	// defaults to the CAs of the system.
+	RootCAs *x509.CertPool
+	// Optional TLS versions range and cipher suites, tls.Config defaults
+	// are used otherwise. TLS 1.3 suites cannot be selected.
+	TLSMin       uint16
+	TLSMax       uint16
+	CipherSuites []uint16
 	// Option to allow insecure TLS/SSL certificates.
 	AllowInsecure bool
+	// Optional TLS server name, defaults to the host of the Host header.
+	SNI string
 
 	// Output type
 	Output string
 
-	// Optional address of HTTP proxy server as host:port
-	ProxyAddr string
+	// Option to include the sorted latencies in the JSON output.
+	IncludeLats bool
 
-	bar     *pb.ProgressBar
-	rpt     *Report
-	results chan *result
-}
+	// Percentiles to print in the latency distribution, defaults
+	// to 10, 25, 50, 75, 90, 95 and 99.
+	Percentiles []float64
+
+	// Number of histogram buckets, defaults to 10.
+	Buckets int
+
+	// Optional fixed width of the histogram buckets. The number
+	// of buckets is then derived from the latency range.
+	BucketWidth time.Duration
+
+	// Scale of the histogram buckets, "log" or linear by default. On a
+	// log scale, each bucket is wider than the previous one by the same
+	// factor, and the marks are printed in milliseconds or seconds.
+	HistScale string
+
+	// Option to aggregate latencies as they arrive rather than keeping
+	// every sample. Percentiles are then approximated within 0.1%.
+	StreamStats bool
+
+	// Writer the report is printed to, defaults to os.Stdout.
+	Writer io.Writer
+
+	// Optional callback passed every completed request, in the order
+	// they are collected. It is called from a goroutine of its own,
+	// after a queue of 1024 results, results are dropped rather than
+	// blocking the run when the queue is full, see DroppedResults.
+	OnResult func(Result)
+
+	// Optional proxy, an http, https or socks5 URL. Its user info, if any,
+	// authenticates with the proxy, TLS targets are tunneled through it.
+	// Host names are resolved by SOCKS5 proxies.
+	Proxy *url.URL
+	// Hosts connected to directly rather than through the proxy, as of
+	// NO_PROXY: host names which also match their subdomains, IP addresses
+	// or CIDR ranges, optionally with a port, or "*".
+	NoProxy []string
+
+	// Optional path of a Unix domain socket to connect to, whatever
+	// the host of the URL is.
+	UnixSocket string
+
+	// Optional network of the connections, "tcp4" or "tcp6" to connect
+	// over a single address family.
+	Network string
+	// Optional local addresses the connections are made from, in turn.
+	LocalAddrs []net.IP
+	// Lookup of the host of the URL made before the run, reported. If
+	// DNSEach is set instead, the host is resolved by each connection
+	// and the server addresses of the connections are reported.
+	Resolution *Resolution
+	DNSEach    bool
+
+	// Options to use HTTP/2 over TLS, and HTTP/2 over cleartext
+	// TCP with prior knowledge.
+	HTTP2 bool
+	H2C   bool
+	// Number of connections shared by the workers. HTTP/2 multiplexes
+	// the requests of the workers over them. Defaults to one connection
+	// per worker.
+	Conns int
+	// Number of requests after which a worker closes its connection,
+	// so that the next request dials a new one. Setting it to 1 is the
+	// same as disabling keep-alives.
+	RequestsPerConn  int
+	DisableKeepAlive bool
+	// Optional transport of the requests, shared by the workers, used
+	// instead of those made from the options. The options of the
+	// connections, e.g. DisableKeepAlive, Conns, Proxy, HeaderTimeout or
+	// the TLS ones, then have no effect.
+	Transport http.RoundTripper
+
+	// Optional writer the progress line is printed to, refreshed every
+	// ProgressInterval, a second by default. Run prints it to stderr if
+	// it is a terminal and no output type is set.
+	Progress         io.Writer
+	ProgressInterval time.Duration
+	// Optional length of the intervals summarized as the run goes on, a
+	// line per interval with its requests, p50, p99 and errors, e.g.
+	// "last 10s: 1,204 req, p50 38.000ms, p99 210.000ms, 3 errors". The
+	// lines are printed above the progress line, or to stderr if Progress
+	// is not set. The report then has a time series of the same intervals,
+	// unless TimeSeries is set.
+	Interval time.Duration
+
+	prog     *progress
+	rpt      *Report
+	results  chan *result
+	metrics  *metrics
+	hook     *hook
+	digest   *digestAuth
+	saver    *saver
+	recorder *recorder
+	debug    *debugDump
+	// First failure, kept by the request that set failed to 1.
+	failed  int32
+	failure *Failure
+	// Index of the local address of the next connection.
+	localNext uint64
+	// Prefix of the sequential request IDs of the run.
+	idPrefix string
+
+	prepared    bool
+	urlTmpls    map[string]*template.Template
+	entryTmpls  []*entryTemplate
+	urlAlias    *aliasTable
+	bodyTmpl    *template.Template
+	headerTmpls map[string][]*template.Template
+	// Size of the body before compression, if compressed once.
+	rawBody int64
+	// Request copied for each request if they are all the same.
+	baseReq *http.Request
 
-func newPb(size int) (bar *pb.ProgressBar) {
-	bar = pb.New(size)
-	bar.Format("Bom !")
-	bar.Start()
-	return
+	initOnce sync.Once
+	stopOnce sync.Once
+	// Closed when the run is stopped, ctx is cancelled once the
+	// grace period of in-flight requests expires.
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Set to 1 once MaxDuration expires, in-flight requests are then
+	// cancelled right away. Requests cancelled by either are counted.
+	expired   int32
+	cancelled int64
+	// Set to 1 once an error threshold is crossed.
+	aborted int32
 }
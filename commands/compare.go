@@ -0,0 +1,257 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunOptions are the options of a run that tell whether two reports are
+// comparable, part of the JSON output.
+type RunOptions struct {
+	Url string `json:"url"`
+	C   int    `json:"c"`
+	// Number of requests, zero if the run has a duration.
+	N        int           `json:"n"`
+	Duration time.Duration `json:"duration_ns,omitempty"`
+}
+
+// Delta is the change of a metric between two runs. Latencies are in
+// seconds, the error rate is a fraction. Change is in percent of the
+// first value, infinite if it is zero and the second one is not.
+type Delta struct {
+	Metric string
+	Before float64
+	After  float64
+	Change float64
+	// Set if lower values are better, e.g. latencies.
+	lower bool
+}
+
+// Better returns true if the metric improved, and Worse if it degraded.
+func (d *Delta) Better() bool {
+	return d.After != d.Before && (d.After < d.Before) == d.lower
+}
+
+func (d *Delta) Worse() bool {
+	return d.After != d.Before && !d.Better()
+}
+
+// Regressed returns true if the metric degraded by more than threshold
+// percent.
+func (d *Delta) Regressed(threshold float64) bool {
+	return d.Worse() && math.Abs(d.Change) > threshold
+}
+
+// ReadReport reads a report of the "json" output.
+func ReadReport(r io.Reader) (*Report, error) {
+	rpt := &Report{}
+	if err := json.NewDecoder(r).Decode(rpt); err != nil {
+		return nil, fmt.Errorf("invalid JSON report, %v", err)
+	}
+	return rpt, nil
+}
+
+// LoadReport reads a report file of the "json" output.
+func LoadReport(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadReport(f)
+}
+
+// Compare returns the changes of the requests per second, the average
+// latency, the percentiles of both reports and the error rate, in this
+// order. The reports can have different numbers of requests.
+func Compare(before, after *Report) []*Delta {
+	deltas := []*Delta{
+		newDelta("rps", before.RPS, after.RPS, false),
+		newDelta("average", before.Average, after.Average, true),
+	}
+	for _, b := range before.LatencyDistribution {
+		for _, a := range after.LatencyDistribution {
+			if a.Percentage == b.Percentage {
+				name := "p" + strconv.FormatFloat(b.Percentage, 'f', -1, 64)
+				deltas = append(deltas, newDelta(name, b.Latency, a.Latency, true))
+			}
+		}
+	}
+	return append(deltas, newDelta("error_rate", before.ErrorRate, after.ErrorRate, true))
+}
+
+func newDelta(metric string, before, after float64, lower bool) *Delta {
+	d := &Delta{Metric: metric, Before: before, After: after, lower: lower}
+	switch {
+	case before != 0:
+		d.Change = (after - before) / before * 100
+	case after > 0:
+		d.Change = math.Inf(1)
+	}
+	return d
+}
+
+// Differences returns the options that differ between the runs of the
+// reports, if both have options.
+func Differences(before, after *Report) []string {
+	a, b := before.Options, after.Options
+	if a == nil || b == nil {
+		return nil
+	}
+	var diff []string
+	if a.Url != b.Url {
+		diff = append(diff, "url")
+	}
+	if a.C != b.C {
+		diff = append(diff, "c")
+	}
+	if a.N != b.N {
+		diff = append(diff, "n")
+	}
+	if a.Duration != b.Duration {
+		diff = append(diff, "z")
+	}
+	return diff
+}
+
+// Regressions returns the metrics that degraded by more than threshold
+// percent, among the given ones or any if none are.
+func Regressions(deltas []*Delta, threshold float64, metrics []string) []string {
+	var regressed []string
+	for _, d := range deltas {
+		if threshold > 0 && isChecked(d.Metric, metrics) && d.Regressed(threshold) {
+			regressed = append(regressed, d.Metric)
+		}
+	}
+	return regressed
+}
+
+func isChecked(metric string, metrics []string) bool {
+	for _, m := range metrics {
+		if m == metric {
+			return true
+		}
+	}
+	return len(metrics) == 0
+}
+
+// PrintDeltas prints a row per change, followed by a better or worse
+// marker, and a regression marker if it is one of Regressions.
+func PrintDeltas(w io.Writer, deltas []*Delta, threshold float64, metrics []string) {
+	regressed := Regressions(deltas, threshold, metrics)
+	fmt.Fprintf(w, "\nComparison:\n")
+	for _, d := range deltas {
+		var values string
+		switch d.Metric {
+		case "rps":
+			values = fmt.Sprintf("%4.4f -> %4.4f requests/sec", d.Before, d.After)
+		case "error_rate":
+			values = fmt.Sprintf("%.2f%% -> %.2f%%", d.Before*100, d.After*100)
+		default:
+			values = fmt.Sprintf("%4.4f -> %4.4f secs", d.Before, d.After)
+		}
+		change := "n/a"
+		if !math.IsInf(d.Change, 0) {
+			change = fmt.Sprintf("%+.2f%%", d.Change)
+		}
+		marker := "same"
+		if d.Better() {
+			marker = "better"
+		} else if d.Worse() {
+			marker = "worse"
+			if isChecked(d.Metric, regressed) && len(regressed) > 0 {
+				marker = "worse, regression"
+			}
+		}
+		fmt.Fprintf(w, "  %s:\t%s, %s, %s\n", d.Metric, values, change, marker)
+	}
+	if len(regressed) > 0 {
+		fmt.Fprintf(w, "\nRegressions over %.2f%%:\t%s.\n", threshold, strings.Join(regressed, ", "))
+	}
+}
+
+// BaselineCheck is the outcome of the check of a metric against its
+// baseline, Max is the regression allowed in percent.
+type BaselineCheck struct {
+	Delta *Delta
+	// Name of the metric, set even if missing from the reports.
+	Metric string
+	Max    float64
+	Pass   bool
+}
+
+// CheckBaseline compares the metrics of a report with those of its
+// baseline, each one can regress by at most its limit, in percent. A
+// metric missing from either report fails.
+func CheckBaseline(baseline, rpt *Report, limits map[string]float64) []*BaselineCheck {
+	var (
+		checks []*BaselineCheck
+		found  = make(map[string]bool)
+	)
+	for _, d := range Compare(baseline, rpt) {
+		if max, ok := limits[d.Metric]; ok {
+			checks = append(checks, &BaselineCheck{Delta: d, Metric: d.Metric, Max: max, Pass: !d.Regressed(max)})
+			found[d.Metric] = true
+		}
+	}
+	var missing []string
+	for m := range limits {
+		if !found[m] {
+			missing = append(missing, m)
+		}
+	}
+	sort.Strings(missing)
+	for _, m := range missing {
+		checks = append(checks, &BaselineCheck{Metric: m, Max: limits[m]})
+	}
+	return checks
+}
+
+// PrintBaseline prints the outcome of each check, as the SLA checks are.
+func PrintBaseline(w io.Writer, checks []*BaselineCheck) {
+	fmt.Fprintf(w, "\nBaseline:\n")
+	for _, c := range checks {
+		status := "PASS"
+		if !c.Pass {
+			status = "FAIL"
+		}
+		d := c.Delta
+		if d == nil {
+			fmt.Fprintf(w, "  [%s]\t%s, not in both reports.\n", status, c.Metric)
+			continue
+		}
+		change := "n/a"
+		if !math.IsInf(d.Change, 0) {
+			change = fmt.Sprintf("%+.2f%%", d.Change)
+		}
+		switch d.Metric {
+		case "rps":
+			fmt.Fprintf(w, "  [%s]\trps %4.4f -> %4.4f requests/sec, %s, at most %.2f%% worse.\n", status, d.Before, d.After, change, c.Max)
+		case "error_rate":
+			fmt.Fprintf(w, "  [%s]\terror rate %.2f%% -> %.2f%%, %s, at most %.2f%% worse.\n", status, d.Before*100, d.After*100, change, c.Max)
+		default:
+			fmt.Fprintf(w, "  [%s]\t%s %4.4f -> %4.4f secs, %s, at most %.2f%% worse.\n", status, d.Metric, d.Before, d.After, change, c.Max)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	before, err := ReadReport(strings.NewReader(`{"rps": 100, "average": 0.2, "error_rate": 0,
+		"latency_distribution": [{"percentage": 50, "latency": 0.1}, {"percentage": 99, "latency": 0.5}],
+		"options": {"url": "http://a.com", "c": 10, "n": 1000}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := ReadReport(strings.NewReader(`{"rps": 110, "average": 0.2, "error_rate": 0.01,
+		"latency_distribution": [{"percentage": 99, "latency": 0.6}, {"percentage": 99.9, "latency": 0.9}],
+		"options": {"url": "http://a.com", "c": 20, "n": 2000}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltas := Compare(before, after)
+	var metrics []string
+	for _, d := range deltas {
+		metrics = append(metrics, d.Metric)
+	}
+	if want := []string{"rps", "average", "p99", "error_rate"}; !reflect.DeepEqual(metrics, want) {
+		t.Fatalf("Expected %v, %v is found", want, metrics)
+	}
+	rps, avg, p99, errs := deltas[0], deltas[1], deltas[2], deltas[3]
+	if rps.Change != 10 || !rps.Better() || rps.Regressed(5) {
+		t.Errorf("Expected a 10%% better rps, %+v is found", rps)
+	}
+	if avg.Change != 0 || avg.Better() || avg.Worse() {
+		t.Errorf("Expected the same average, %+v is found", avg)
+	}
+	if math.Abs(p99.Change-20) > 1e-9 || !p99.Worse() || !p99.Regressed(5) || p99.Regressed(25) {
+		t.Errorf("Expected a 20%% worse p99, %+v is found", p99)
+	}
+	if !math.IsInf(errs.Change, 1) || !errs.Regressed(5) {
+		t.Errorf("Expected an error rate regression, %+v is found", errs)
+	}
+	if diff := Differences(before, after); !reflect.DeepEqual(diff, []string{"c", "n"}) {
+		t.Errorf("Expected c and n to differ, %v is found", diff)
+	}
+
+	var buf bytes.Buffer
+	PrintDeltas(&buf, deltas, 5, nil)
+	for _, line := range []string{
+		"  rps:\t100.0000 -> 110.0000 requests/sec, +10.00%, better\n",
+		"  average:\t0.2000 -> 0.2000 secs, +0.00%, same\n",
+		"  p99:\t0.5000 -> 0.6000 secs, +20.00%, worse, regression\n",
+		"  error_rate:\t0.00% -> 1.00%, n/a, worse, regression\n",
+		"\nRegressions over 5.00%:\tp99, error_rate.\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected %q, %q is found", line, buf.String())
+		}
+	}
+	if r := Regressions(deltas, 5, []string{"rps", "p99"}); !reflect.DeepEqual(r, []string{"p99"}) {
+		t.Errorf("Expected a p99 regression, %v is found", r)
+	}
+}
+
+func TestCheckBaseline(t *testing.T) {
+	baseline := &Report{RPS: 100, LatencyDistribution: []LatencyDistribution{{Percentage: 99, Latency: 0.5}}}
+	rpt := &Report{RPS: 96, LatencyDistribution: []LatencyDistribution{{Percentage: 99, Latency: 0.6}}}
+	checks := CheckBaseline(baseline, rpt, map[string]float64{"rps": 5, "p99": 10, "p90": 10})
+	var got []string
+	for _, c := range checks {
+		got = append(got, fmt.Sprintf("%s %v", c.Metric, c.Pass))
+	}
+	if want := []string{"rps true", "p99 false", "p90 false"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, %v is found", want, got)
+	}
+
+	var buf bytes.Buffer
+	PrintBaseline(&buf, checks)
+	want := "\nBaseline:\n" +
+		"  [PASS]\trps 100.0000 -> 96.0000 requests/sec, -4.00%, at most 5.00% worse.\n" +
+		"  [FAIL]\tp99 0.5000 -> 0.6000 secs, +20.00%, at most 10.00% worse.\n" +
+		"  [FAIL]\tp90, not in both reports.\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, %q is found", want, buf.String())
+	}
+
+	// The baseline is read back from the JSON output.
+	buf.Reset()
+	if err := baseline.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadReport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.RPS != 100 || !reflect.DeepEqual(read.LatencyDistribution, baseline.LatencyDistribution) {
+		t.Errorf("Expected the baseline, %+v is found", read)
+	}
+}
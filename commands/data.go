@@ -0,0 +1,94 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+)
+
+// DataFeed holds the rows of a CSV file. The first row names the
+// columns, which are available as template variables, e.g. {{.email}}.
+type DataFeed struct {
+	columns []string
+	rows    [][]string
+	// Random order of the rows, if they are used once each.
+	perm []int
+}
+
+// LoadDataFeed reads the data feed of a CSV file.
+func LoadDataFeed(path string) (*DataFeed, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadDataFeed(f)
+}
+
+// ReadDataFeed reads a data feed in CSV format.
+func ReadDataFeed(r io.Reader) (*DataFeed, error) {
+	cr := csv.NewReader(r)
+	columns, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("data feed has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("data feed has no row")
+	}
+	return &DataFeed{columns: columns, rows: rows}, nil
+}
+
+// Len returns the number of rows.
+func (d *DataFeed) Len() int {
+	return len(d.rows)
+}
+
+// Returns the i-th row as template data.
+func (d *DataFeed) row(i int) map[string]string {
+	m := make(map[string]string, len(d.columns))
+	for j, c := range d.columns {
+		m[c] = d.rows[i][j]
+	}
+	return m
+}
+
+// Returns the row of the i-th request, and false if every row
+// was used and the feed does not loop.
+func (d *DataFeed) pick(i int, random, loop bool) (map[string]string, bool) {
+	n := len(d.rows)
+	switch {
+	case !loop && i >= n:
+		return nil, false
+	case random && loop:
+		return d.row(rand.Intn(n)), true
+	case random:
+		if d.perm == nil {
+			d.perm = rand.Perm(n)
+		}
+		return d.row(d.perm[i]), true
+	}
+	return d.row(i % n), true
+}
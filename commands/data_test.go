@@ -0,0 +1,53 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDataFeed(t *testing.T) {
+	d, err := ReadDataFeed(strings.NewReader("id,email\n1,a@x.com\n2,b@x.com\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if d.Len() != 2 {
+		t.Fatalf("Expected 2 rows, %v are found", d.Len())
+	}
+	row, ok := d.pick(3, false, true)
+	if !ok || row["id"] != "2" || row["email"] != "b@x.com" {
+		t.Errorf("Unexpected row %v", row)
+	}
+	if _, ok := d.pick(2, false, false); ok {
+		t.Errorf("Expected the feed to be exhausted")
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		row, _ := d.pick(i, true, false)
+		seen[row["id"]] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("Expected each row to be used once, %v is found", seen)
+	}
+}
+
+func TestDataFeedInvalid(t *testing.T) {
+	for _, s := range []string{"", "id,email\n", "id,email\n1\n"} {
+		if _, err := ReadDataFeed(strings.NewReader(s)); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
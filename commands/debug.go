@@ -0,0 +1,143 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Maximum length of the request body printed.
+const printedBodySize = 4096
+
+// debugDump keeps the request and response of a debug run, as sent
+// and received by send.
+type debugDump struct {
+	req    *http.Request
+	resp   *http.Response
+	body   bytes.Buffer
+	remote string
+}
+
+// Debug makes a single request, built and sent as the workers of a run
+// would, and prints it along with its response and the timings of its
+// stages instead of a report. Returns the error of the request, if any.
+func (b *Boom) Debug() error {
+	if err := b.Prepare(); err != nil {
+		return err
+	}
+	b.init()
+	defer b.cancel()
+	w := b.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	b.rpt = newReport(1, nil, "", w)
+	b.rpt.expected = b.ExpectedStatus
+	b.rpt.Resolution = b.Resolution
+	if b.Req.Digest {
+		b.digest = &digestAuth{username: b.Req.Username, password: b.Req.Password}
+	}
+	b.debug = &debugDump{}
+	j := b.newJob(0)
+	if j == nil {
+		return errors.New("The data feed has no rows.")
+	}
+	if j.err != nil {
+		return j.err
+	}
+	j.setUserAgent()
+	b.setRequestID(j)
+	res := b.send(b.newClients()[0], j, 0)
+	res.duration = time.Now().Sub(res.start)
+	b.printDebug(w, res)
+	return res.err
+}
+
+func (b *Boom) printDebug(w io.Writer, res *result) {
+	d := b.debug
+	if b.rpt.Resolution != nil {
+		b.rpt.printResolution()
+	}
+	if d.remote != "" {
+		fmt.Fprintf(w, "\nConnected to %s.\n", d.remote)
+	}
+	if res.tlsVersion != 0 {
+		fmt.Fprintf(w, "TLS:\t%s, %s.\n", tls.VersionName(res.tlsVersion), tls.CipherSuiteName(res.cipherSuite))
+	}
+
+	if d.req != nil {
+		fmt.Fprintln(w)
+		printRequest(w, d.req)
+	}
+
+	if resp := d.resp; resp != nil {
+		fmt.Fprintln(w)
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%s %s\n", resp.Proto, resp.Status)
+		resp.Header.Write(&buf)
+		writePrefixed(w, "< ", buf.String())
+		if d.body.Len() > 0 {
+			fmt.Fprintf(w, "\n%s\n", strings.TrimRight(d.body.String(), "\n"))
+		}
+	}
+
+	fmt.Fprintf(w, "\nTimings:\n")
+	for i, st := range res.timings.stages {
+		if st > 0 {
+			fmt.Fprintf(w, "  %s:\t%4.4f secs.\n", stageLabels[i], st.Seconds())
+		}
+	}
+	fmt.Fprintf(w, "  Total:\t%4.4f secs.\n", res.duration.Seconds())
+	if res.err != nil {
+		fmt.Fprintf(w, "\nError:\t%v\n", res.err)
+	}
+}
+
+// Prints the request line, headers and body of req, prefixed by "> ".
+func printRequest(w io.Writer, req *http.Request) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s %s\nHost: %s\n", req.Method, req.URL.RequestURI(), req.Proto, host)
+	req.Header.Write(&buf)
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			buf.WriteString("\n")
+			// Large bodies, e.g. uploads, are cut.
+			if n, _ := io.Copy(&buf, io.LimitReader(body, printedBodySize)); n == printedBodySize && req.ContentLength > n {
+				fmt.Fprintf(&buf, "\n[%d more bytes]", req.ContentLength-n)
+			}
+			body.Close()
+		}
+	}
+	writePrefixed(w, "> ", buf.String())
+}
+
+// Writes the lines of s, each one after prefix.
+func writePrefixed(w io.Writer, prefix, s string) {
+	for _, line := range strings.Split(strings.TrimRight(s, "\r\n"), "\n") {
+		fmt.Fprintln(w, strings.TrimRight(prefix+line, " \r"))
+	}
+}
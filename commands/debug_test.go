@@ -0,0 +1,99 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	var count int
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		count++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Echo", r.Header.Get("X-Test"))
+		w.Write(body)
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL + "/item/{{seq}}",
+			Header: http.Header{"X-Test": []string{"boom"}},
+			Body:   "payload",
+		},
+		N:             100,
+		C:             10,
+		AllowInsecure: true,
+		Writer:        &buf,
+	}
+	if err := boom.Debug(); err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected a single request, %v are found", count)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"\nConnected to 127.0.0.1.\n",
+		"TLS:\tTLS 1.3, ",
+		"> POST /item/",
+		" HTTP/1.1\n> Host: ",
+		"> X-Test: boom\n>\n> payload\n",
+		"< HTTP/1.1 200 OK\n",
+		"< X-Echo: boom\n",
+		"\npayload\n",
+		"\nTimings:\n  TCP connect:\t",
+		"  TLS handshake:\t",
+		"  Total:\t",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q to be printed, %v is found", s, out)
+		}
+	}
+	if strings.Contains(out, "Summary:") {
+		t.Errorf("Expected no report, %v is found", out)
+	}
+}
+
+func TestDebug_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      1,
+		C:      1,
+		Writer: &buf,
+	}
+	if err := boom.Debug(); err == nil {
+		t.Errorf("Expected the error of the request")
+	}
+	if !strings.Contains(buf.String(), "\nError:\t") {
+		t.Errorf("Expected the error to be printed, %v is found", buf.String())
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestChallenge is the Digest challenge of a 401 response.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	// Set if the server supports the "auth" quality of protection,
+	// the RFC 2069 response is computed otherwise.
+	qop bool
+}
+
+// Returns the hash function of the algorithm, nil if not supported.
+func (c *digestChallenge) hash() func() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+// Returns the first supported Digest challenge of the response.
+func parseChallenges(resp *http.Response) *digestChallenge {
+	for _, v := range resp.Header["Www-Authenticate"] {
+		if len(v) < 7 || !strings.EqualFold(v[:7], "Digest ") {
+			continue
+		}
+		params := parseAuthParams(v[7:])
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+		for _, q := range strings.Split(params["qop"], ",") {
+			if strings.TrimSpace(q) == "auth" {
+				c.qop = true
+			}
+		}
+		if c.nonce != "" && c.hash() != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// Parses comma-separated name=value parameters, values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return params
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i = 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			s = s[min(i+1, len(s)):]
+		} else {
+			i = strings.IndexAny(s, ", \t")
+			if i < 0 {
+				i = len(s)
+			}
+			value.WriteString(s[:i])
+			s = s[i:]
+		}
+		params[name] = value.String()
+	}
+}
+
+// Computes the response to the challenge, as of RFC 7616.
+func digestResponse(c *digestChallenge, username, password, method, uri, nc, cnonce string) string {
+	h := func(s string) string {
+		hh := c.hash()()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	ha1 := h(username + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	if !c.qop {
+		return h(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+	return h(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+}
+
+// digestAuth authorizes requests with the last challenge of the server,
+// shared by the workers so that requests following the first challenge
+// are authorized on the first try.
+type digestAuth struct {
+	username string
+	password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	// Number of requests made with the nonce of the challenge.
+	nc int
+}
+
+// Sets the challenge to answer, the nonce count starts over.
+func (d *digestAuth) setChallenge(c *digestChallenge) {
+	d.mu.Lock()
+	d.challenge = c
+	d.nc = 0
+	d.mu.Unlock()
+}
+
+// Sets the Authorization header of the request if a challenge is known.
+func (d *digestAuth) authorize(req *http.Request) {
+	d.mu.Lock()
+	c := d.challenge
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+	d.mu.Unlock()
+	if c == nil {
+		return
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	cnonce := hex.EncodeToString(b)
+	uri := req.URL.RequestURI()
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		d.username, c.realm, c.nonce, uri, digestResponse(c, d.username, d.password, req.Method, uri, nc, cnonce))
+	if c.algorithm != "" {
+		auth += ", algorithm=" + c.algorithm
+	}
+	if c.qop {
+		auth += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s"`, nc, cnonce)
+	}
+	if c.opaque != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+	req.Header.Set("Authorization", auth)
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// The examples of RFC 7616, section 3.9.1.
+func TestDigestResponse(t *testing.T) {
+	for _, c := range []struct{ algorithm, expected string }{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	} {
+		ch := &digestChallenge{
+			realm:     "http-auth@example.org",
+			nonce:     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+			algorithm: c.algorithm,
+			qop:       true,
+		}
+		got := digestResponse(ch, "Mufasa", "Circle of Life", "GET", "/dir/index.html", "00000001",
+			"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+		if got != c.expected {
+			t.Errorf("Expected the %v response %v, %v is found", c.algorithm, c.expected, got)
+		}
+	}
+}
+
+func TestParseChallenges(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Www-Authenticate": {
+		`Basic realm="basic"`,
+		`Digest realm="a, \"b\"", qop="auth-int, auth", algorithm=SHA-256, nonce="n", opaque="o"`,
+	}}}
+	c := parseChallenges(resp)
+	if c == nil || c.realm != `a, "b"` || c.nonce != "n" || c.opaque != "o" || c.algorithm != "SHA-256" || !c.qop {
+		t.Errorf("Expected the Digest challenge, %+v is found", c)
+	}
+	resp.Header.Set("Www-Authenticate", `Digest realm="r", nonce="n", algorithm=SHA-512-256`)
+	if c := parseChallenges(resp); c != nil {
+		t.Errorf("Expected an unsupported algorithm to be skipped, %+v is found", c)
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	var challenges int64
+	ch := &digestChallenge{realm: "boom", nonce: "abc", opaque: "xyz", algorithm: "SHA-256", qop: true}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		params := parseAuthParams(r.Header.Get("Authorization"))
+		expected := digestResponse(ch, "user", "pass", r.Method, r.URL.RequestURI(), params["nc"], params["cnonce"])
+		if params["response"] != expected || params["opaque"] != "xyz" {
+			atomic.AddInt64(&challenges, int64(1))
+			w.Header().Set("WWW-Authenticate", `Digest realm="boom", qop="auth", algorithm=SHA-256, nonce="abc", opaque="xyz"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method:   "POST",
+			Url:      server.URL + "/path?q=1",
+			Body:     "body",
+			Username: "user",
+			Password: "pass",
+			Digest:   true,
+		},
+		N:      5,
+		C:      1,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if n := atomic.LoadInt64(&challenges); n != 1 {
+		t.Errorf("Expected a single challenge, %v is found", n)
+	}
+	if rpt.StatusCodeDist[200] != 5 || rpt.DigestChallenges != 1 {
+		t.Errorf("Expected 5 authenticated responses after 1 challenge, %v (%v) is found", rpt.StatusCodeDist, rpt.DigestChallenges)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+)
+
+// DryRun validates the options, builds the first request and prints
+// what a run would do, without sending any request. Returns the error
+// of the options or of the request, if any.
+func (b *Boom) DryRun() error {
+	if err := b.Prepare(); err != nil {
+		return err
+	}
+	w := b.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	u := b.Req.Url
+	if len(b.Urls) > 0 {
+		u = b.Urls[0]
+	}
+	var data map[string]string
+	if b.Data != nil {
+		data = b.Data.row(0)
+	}
+	req, err := b.build(&job{}, u, data)
+	if len(b.Entries) > 0 || b.Log != nil {
+		j := b.newJob(0)
+		req, err = j.req, j.err
+	}
+	if err != nil {
+		return err
+	}
+	if len(b.UserAgents) > 0 {
+		req.Header.Set("User-Agent", b.UserAgents[0])
+	}
+	b.bustCache(req)
+
+	fmt.Fprintf(w, "Dry run, no request is sent.\n")
+	if b.Resolution != nil {
+		rpt := newReport(0, nil, "", w)
+		rpt.Resolution = b.Resolution
+		rpt.printResolution()
+	}
+	fmt.Fprintf(w, "\nRun:\n")
+	if b.Duration > 0 {
+		fmt.Fprintf(w, "  Duration:\t%v.\n", b.Duration)
+	} else {
+		fmt.Fprintf(w, "  Requests:\t%d.\n", b.N)
+	}
+	fmt.Fprintf(w, "  Concurrency:\t%d.\n", b.C)
+	switch {
+	case b.Qps > 0 && b.QpsPerWorker:
+		fmt.Fprintf(w, "  Rate limit:\t%d QPS per worker.\n", b.Qps)
+	case b.Qps > 0:
+		fmt.Fprintf(w, "  Rate limit:\t%d QPS.\n", b.Qps)
+	case b.Rate > 0:
+		fmt.Fprintf(w, "  Arrival rate:\t%d requests per second.\n", b.Rate)
+	case len(b.Steps) > 0:
+		fmt.Fprintf(w, "  Steps:\t%d.\n", len(b.Steps))
+	}
+	if b.Think > 0 && b.Rate == 0 {
+		fmt.Fprintf(w, "  Think time:\t%v between the requests of a worker.\n", b.Think)
+	}
+	if b.MaxDuration > 0 {
+		fmt.Fprintf(w, "  Deadline:\t%v.\n", b.MaxDuration)
+	}
+	if len(b.Urls) > 0 {
+		order := "round-robin"
+		switch {
+		case len(b.UrlWeights) > 0:
+			order = "random, weighted"
+		case b.UrlOrder == "random":
+			order = "random"
+		}
+		fmt.Fprintf(w, "  URLs:\t%d, %s.\n", len(b.Urls), order)
+	}
+	if len(b.UserAgents) > 0 {
+		order := "round-robin"
+		if b.UserAgentOrder == "random" {
+			order = "random"
+		}
+		fmt.Fprintf(w, "  User agents:\t%d, %s.\n", len(b.UserAgents), order)
+	}
+	if b.Data != nil {
+		fmt.Fprintf(w, "  Data rows:\t%d.\n", b.Data.Len())
+	}
+	if len(b.Entries) > 0 {
+		fmt.Fprintf(w, "  Entries:\t%d, in order by each worker.\n", len(b.Entries))
+	}
+	if b.Log != nil {
+		order := "in order"
+		if b.UrlOrder == "random" {
+			order = "random"
+		}
+		fmt.Fprintf(w, "  Log requests:\t%d, %s, %d lines skipped.\n", len(b.Log.Requests), order, b.Log.Skipped)
+	}
+	fmt.Fprintf(w, "\nFirst request, %s:\n", req.URL)
+	printRequest(w, req)
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+	}))
+	defer server.Close()
+
+	data, _ := ReadDataFeed(strings.NewReader("id,name\n42,boom\n"))
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL + "/item/{{.id}}",
+			Header: http.Header{"X-Name": []string{"{{.name}}"}},
+			Body:   `{"id":{{.id}}}`,
+		},
+		Data:   data,
+		N:      100,
+		C:      10,
+		Qps:    5,
+		Writer: &buf,
+	}
+	if err := boom.DryRun(); err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no request to be sent, %v are found", count)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"  Requests:\t100.\n  Concurrency:\t10.\n  Rate limit:\t5 QPS.\n",
+		"  Data rows:\t1.\n",
+		"\nFirst request, " + server.URL + "/item/42:\n> POST /item/42 HTTP/1.1\n",
+		"> X-Name: boom\n",
+		">\n> {\"id\":42}\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q to be printed, %v is found", s, out)
+		}
+	}
+}
+
+func TestDryRun_Invalid(t *testing.T) {
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "http://localhost/{{.missing}}",
+		},
+		N: 1,
+		C: 1,
+	}
+	if err := boom.DryRun(); err == nil {
+		t.Errorf("Expected the unknown template variable to be an error")
+	}
+}
+
+func TestDryRun_CacheBust(t *testing.T) {
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "http://localhost/items?page=2",
+		},
+		CacheBust: "cb",
+		N:         1,
+		C:         1,
+		Writer:    &buf,
+	}
+	if err := boom.DryRun(); err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if s := "\nFirst request, http://localhost/items?page=2&cb="; !strings.Contains(buf.String(), s) {
+		t.Errorf("Expected %q to be printed, %v is found", s, buf.String())
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Categories of the errors, in the order they are printed. They are
+// also used as metric labels.
+const (
+	errDNS     = "dns"
+	errRefused = "connection_refused"
+	errReset   = "connection_reset"
+	errTLS     = "tls_handshake"
+	errProxy   = "proxy"
+	// Errors array of a successful GraphQL response.
+	errGraphQL = "graphql"
+	// Values not found in the response of an entry.
+	errExtract = "extraction"
+	// Timeouts of the connection, of the response headers and of
+	// the whole request.
+	errConnectTimeout = "connect_timeout"
+	errHeaderTimeout  = "header_timeout"
+	errTimeout        = "timeout"
+	errOther          = "other"
+)
+
+var errorCategories = []string{errDNS, errRefused, errReset, errTLS, errProxy,
+	errConnectTimeout, errHeaderTimeout, errTimeout, errGraphQL, errExtract, errOther}
+
+// Returns the category of an error, so that the same failure against
+// different addresses is counted once.
+func classifyError(err error) string {
+	var (
+		dnsErr  *net.DNSError
+		recErr  tls.RecordHeaderError
+		alert   tls.AlertError
+		certErr *tls.CertificateVerificationError
+		authErr x509.UnknownAuthorityError
+		hostErr x509.HostnameError
+		invErr  x509.CertificateInvalidError
+		netErr  net.Error
+		opErr   *net.OpError
+		prxErr  *proxyError
+		gqlErr  *graphqlError
+		extErr  *extractError
+		repErr  *recordedError
+	)
+	switch {
+	case errors.As(err, &repErr):
+		return repErr.category
+	case errors.As(err, &gqlErr):
+		return errGraphQL
+	case errors.As(err, &extErr):
+		return errExtract
+	case errors.As(err, &prxErr), errors.As(err, &opErr) && (opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks ")):
+		// Failures to connect to or through the proxy, whatever
+		// the underlying error is.
+		return errProxy
+	case errors.As(err, &dnsErr):
+		return errDNS
+	case errors.As(err, &recErr), errors.As(err, &alert), errors.As(err, &certErr),
+		errors.As(err, &authErr), errors.As(err, &hostErr), errors.As(err, &invErr),
+		strings.Contains(err.Error(), "tls: "), strings.Contains(err.Error(), "TLS handshake"):
+		return errTLS
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return errConnectTimeout
+	case strings.Contains(err.Error(), "timeout awaiting response headers"):
+		return errHeaderTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errReset
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return errTimeout
+	}
+	return errOther
+}
+
+// Returns the printed name of a category.
+func categoryName(c string) string {
+	return strings.Replace(c, "_", " ", -1)
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://10.0.0.5", Err: err}
+	}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{wrap(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nope"}}), errDNS},
+		{wrap(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), errRefused},
+		{wrap(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), errReset},
+		{wrap(io.EOF), errReset},
+		{wrap(x509.UnknownAuthorityError{}), errTLS},
+		{wrap(errors.New("net/http: TLS handshake timeout")), errTLS},
+		{wrap(&net.OpError{Op: "proxyconnect", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), errProxy},
+		{wrap(&proxyError{status: "407 Proxy Authentication Required"}), errProxy},
+		{wrap(&net.OpError{Op: "socks connect", Err: errors.New("username/password authentication failed")}), errProxy},
+		{wrap(context.DeadlineExceeded), errTimeout},
+		{wrap(&net.OpError{Op: "dial", Err: &timeoutError{}}), errConnectTimeout},
+		{wrap(errors.New("net/http: timeout awaiting response headers")), errHeaderTimeout},
+		{wrap(&net.OpError{Op: "read", Err: &timeoutError{}}), errTimeout},
+		{errors.New("template: url: missing value"), errOther},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("Expected %v to be classified as %v, %v is found", tt.err, tt.want, got)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestPrintErrors(t *testing.T) {
+	refused := func(addr string) error {
+		return &url.Error{Op: "Get", URL: "http://" + addr, Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}
+	}
+	rpt, buf := newTestReport("", false,
+		&result{statusCode: 200, duration: time.Millisecond},
+		&result{err: refused("10.0.0.5")},
+		&result{err: refused("10.0.0.6")},
+		&result{err: errors.New("boom")},
+	)
+	rpt.verboseErrors = true
+	finalizeReport(rpt, time.Second)
+
+	if rpt.Errors[errRefused] != 2 || rpt.Errors[errOther] != 1 {
+		t.Errorf("Expected the errors per category, %v is found", rpt.Errors)
+	}
+	if len(rpt.RawErrors) != 3 {
+		t.Errorf("Expected the errors per message, %v is found", rpt.RawErrors)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "  [2]\tconnection refused, e.g. Get \"http://10.0.0.5\"") {
+		t.Errorf("Expected a category with a sample message, %q is found", out)
+	}
+	i := strings.Index(out, "Raw error distribution:")
+	raw := out[i+1:]
+	a, b, c := strings.Index(raw, "10.0.0.5"), strings.Index(raw, "10.0.0.6"), strings.Index(raw, "\tboom\n")
+	if i < 0 || a < 0 || a > b || b > c {
+		t.Errorf("Expected the raw errors in order, %q is found", out)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Maximum length of the response body values are extracted from.
+const extractBodySize = 1 << 20
+
+// Extraction captures a value of the response body of an entry, as a
+// variable of the templates of the following entries of the iteration,
+// e.g. {{.token}}.
+type Extraction struct {
+	Var string
+	// Either a regexp, whose first group is captured or else the whole
+	// match, or the dotted path of a JSON field, e.g. data.items.0.id.
+	Regexp   *regexp.Regexp
+	JSONPath string
+}
+
+// extractError is an extraction that found nothing, the iteration of
+// the worker is then aborted.
+type extractError struct {
+	name string
+}
+
+func (e *extractError) Error() string {
+	return "extraction: no value for " + e.name
+}
+
+// Returns the value of the extraction in body, if any.
+func (e *Extraction) extract(body []byte) (string, bool) {
+	if e.Regexp != nil {
+		m := e.Regexp.FindSubmatch(body)
+		switch {
+		case m == nil:
+			return "", false
+		case len(m) > 1:
+			return string(m[1]), true
+		}
+		return string(m[0]), true
+	}
+	return jsonField(body, e.JSONPath)
+}
+
+// Returns the field of the JSON document at path, the names of the
+// fields or the indexes of the arrays separated by dots. Strings are
+// returned as is, other values as JSON. A null field is not found.
+func jsonField(body []byte, path string) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+	for _, name := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[name]
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(t) {
+				return "", false
+			}
+			v = t[i]
+		default:
+			return "", false
+		}
+	}
+	switch t := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return t, true
+	}
+	b, _ := json.Marshal(v)
+	return string(b), true
+}
+
+// Extracts the values of the entry of the job from the body of its
+// result into the variables of its iteration. If one is not found,
+// or the request failed, the request fails and the iteration is
+// aborted.
+func (j *job) extractFrom(res *result) {
+	if res.err != nil {
+		j.abort = true
+		return
+	}
+	for _, e := range j.extract {
+		v, ok := e.extract(res.body.buf)
+		if !ok {
+			res.err = &extractError{name: e.Var}
+			j.abort = true
+			return
+		}
+		if j.vars != nil {
+			j.vars[e.Var] = v
+		}
+	}
+}
+
+// entryTemplate is the templates of an entry, rendered with the
+// variables extracted by the previous entries of the iteration.
+type entryTemplate struct {
+	url, body *template.Template
+	header    map[string][]*template.Template
+}
+
+// Parses the templates of the entries, if any of them extracts values.
+// Entries are not templates otherwise, e.g. those of a HAR file.
+func (b *Boom) parseEntries() error {
+	var extracting bool
+	for _, e := range b.Entries {
+		extracting = extracting || len(e.Extract) > 0
+	}
+	if !extracting {
+		return nil
+	}
+	if b.NoBodyRead {
+		return errors.New("values cannot be extracted without reading the bodies")
+	}
+	if b.Rate > 0 {
+		// Requests are not made in order by workers in the open model.
+		return errors.New("values cannot be extracted with an arrival rate")
+	}
+	b.entryTmpls = make([]*entryTemplate, len(b.Entries))
+	for i, e := range b.Entries {
+		t := &entryTemplate{header: make(map[string][]*template.Template)}
+		var err error
+		if t.url, err = parseTemplate("url", e.Url); err != nil {
+			return fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		if t.body, err = parseTemplate("body", e.Body); err != nil {
+			return fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		for name, values := range e.Header {
+			tmpls := make([]*template.Template, len(values))
+			for k, v := range values {
+				if tmpls[k], err = parseTemplate(name, v); err != nil {
+					return fmt.Errorf("entry %d: %v", i+1, err)
+				}
+			}
+			t.header[name] = tmpls
+		}
+		b.entryTmpls[i] = t
+	}
+	return nil
+}
+
+// Renders the URL, body and headers of the k-th entry into opts.
+func (b *Boom) renderEntry(opts *ReqOpts, k int, vars map[string]string) error {
+	t := b.entryTmpls[k]
+	var err error
+	if opts.Url, err = render(t.url, opts.Url, vars); err != nil {
+		return err
+	}
+	if opts.Body, err = render(t.body, opts.Body, vars); err != nil {
+		return err
+	}
+	opts.Header = opts.Header.Clone()
+	for name, tmpls := range t.header {
+		for i, tmpl := range tmpls {
+			if opts.Header[name][i], err = render(tmpl, opts.Header[name][i], vars); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
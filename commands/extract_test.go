@@ -0,0 +1,124 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExtraction(t *testing.T) {
+	body := []byte(`{"token":"abc","data":{"items":[{"id":7},{"id":"x","tags":["a"]}]},"none":null}`)
+	tests := []struct {
+		e     Extraction
+		value string
+		found bool
+	}{
+		{Extraction{Regexp: regexp.MustCompile(`"token":"(.*?)"`)}, "abc", true},
+		{Extraction{Regexp: regexp.MustCompile(`items`)}, "items", true},
+		{Extraction{Regexp: regexp.MustCompile(`"secret":"(.*?)"`)}, "", false},
+		{Extraction{JSONPath: "token"}, "abc", true},
+		{Extraction{JSONPath: "data.items.0.id"}, "7", true},
+		{Extraction{JSONPath: "data.items.1.tags"}, `["a"]`, true},
+		{Extraction{JSONPath: "data.items.2.id"}, "", false},
+		{Extraction{JSONPath: "token.id"}, "", false},
+		{Extraction{JSONPath: "none"}, "", false},
+	}
+	for _, tt := range tests {
+		if v, ok := tt.e.extract(body); v != tt.value || ok != tt.found {
+			t.Errorf("Expected %q, %v for %+v, %q, %v is found", tt.value, tt.found, tt.e, v, ok)
+		}
+	}
+	if _, ok := (&Extraction{JSONPath: "token"}).extract([]byte("not json")); ok {
+		t.Errorf("Expected no value in a body that is not JSON")
+	}
+}
+
+const testExtractScenario = `{"steps": [
+	{"name": "login", "method": "POST", "url": "%[1]s/login",
+	 "extract": {"token": {"regex": "\"token\":\"(.*?)\""}, "id": {"json": "user.id"}}},
+	{"name": "profile", "url": "%[1]s/users/{{.id}}",
+	 "headers": {"Authorization": "Bearer {{.token}}"}}
+]}`
+
+func TestRun_Extract(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		logins int
+		paths  []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/login" {
+			logins++
+			// The second login fails to return a token.
+			if logins != 2 {
+				fmt.Fprintf(w, `{"token":"t%d","user":{"id":%d}}`, logins, logins*10)
+			}
+			return
+		}
+		if want := fmt.Sprintf("/users/%d", logins*10); r.URL.Path != want || r.Header.Get("Authorization") != fmt.Sprintf("Bearer t%d", logins) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	steps, err := ReadScenario(strings.NewReader(fmt.Sprintf(testExtractScenario, server.URL)))
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    steps[0].Url,
+		},
+		Entries: steps,
+		N:       5,
+		C:       1,
+		Output:  "quiet",
+		Writer:  ioutil.Discard,
+	}
+	rpt := boom.Run()
+	// The iteration of the failed extraction is aborted, the next
+	// request starts over.
+	want := "/login /users/10 /login /login /users/30"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("Expected the requests %q, %q is found", want, got)
+	}
+	if rpt.StatusCodeDist[http.StatusOK] != 4 || rpt.Errors[errExtract] != 1 {
+		t.Errorf("Expected 4 successes and 1 extraction error, %v and %v are found", rpt.StatusCodeDist, rpt.Errors)
+	}
+	if e := rpt.Entries[0]; e.Count != 3 || e.ErrorRate != float64(1)/3 {
+		t.Errorf("Unexpected login step %+v", e)
+	}
+
+	for _, s := range []string{
+		`{"steps": [{"url": "http://host/", "extract": {"id": {}}}]}`,
+		`{"steps": [{"url": "http://host/", "extract": {"id": {"regex": "(", "json": "id"}}}]}`,
+		`{"steps": [{"url": "http://host/", "extract": {"id": {"regex": "("}}}]}`,
+	} {
+		if _, err := ReadScenario(strings.NewReader(s)); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Maximum length of the body kept with the first failure.
+const failureBodySize = 1024
+
+// Failure is the first request that failed, either with a response
+// whose status is not a success or without a response.
+type Failure struct {
+	// Method and URL of the request.
+	Request string `json:"request"`
+	// Status line, headers and start of the body of the response.
+	Status string      `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	// Error of the request, if it got no response.
+	Error string `json:"error,omitempty"`
+	// ID of the request, if it was sent in a header.
+	RequestID string `json:"request_id,omitempty"`
+
+	body capped
+}
+
+func newFailure(req *http.Request, resp *http.Response, err error) *Failure {
+	if resp != nil && resp.Request != nil {
+		// The last request, if redirects were followed.
+		req = resp.Request
+	}
+	f := &Failure{
+		Request: fmt.Sprintf("%s %s", req.Method, req.URL),
+		body:    capped{max: failureBodySize},
+	}
+	if resp != nil {
+		f.Status = fmt.Sprintf("%s %s", resp.Proto, resp.Status)
+		f.Header = resp.Header
+	} else if err != nil {
+		f.Error = err.Error()
+	}
+	return f
+}
+
+// Prints the first failure, the headers and start of the body of its
+// response are indented.
+func (r *Report) printFailure() {
+	f := r.FirstFailure
+	fmt.Fprintf(r.w, "\nFirst failure:\n")
+	fmt.Fprintf(r.w, "  %s\n", f.Request)
+	if f.RequestID != "" {
+		fmt.Fprintf(r.w, "  Request ID: %s\n", f.RequestID)
+	}
+	if f.Status == "" {
+		fmt.Fprintf(r.w, "  %s\n", f.Error)
+		return
+	}
+	fmt.Fprintf(r.w, "  %s\n", f.Status)
+	var buf bytes.Buffer
+	f.Header.Write(&buf)
+	if f.Body != "" {
+		buf.WriteString("\r\n")
+		buf.WriteString(f.Body)
+	}
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\r\n"), "\n") {
+		if line = strings.TrimRight(line, "\r"); line == "" {
+			fmt.Fprintln(r.w)
+		} else {
+			fmt.Fprintf(r.w, "  %s\n", line)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFirstFailure(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") == "" {
+			return
+		}
+		w.Header().Set("X-Test", "boom")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("a", 2000)))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+		},
+		Urls:   []string{server.URL, server.URL + "/item?fail=1"},
+		N:      10,
+		C:      2,
+		Writer: &buf,
+	}
+	rpt := boom.Run()
+	f := rpt.FirstFailure
+	if f == nil {
+		t.Fatalf("Expected the first failure to be kept")
+	}
+	if f.Request != "GET "+server.URL+"/item?fail=1" || f.Status != "HTTP/1.1 500 Internal Server Error" {
+		t.Errorf("Expected the failed request and its status, %+v is found", f)
+	}
+	if f.Header.Get("X-Test") != "boom" || len(f.Body) != failureBodySize {
+		t.Errorf("Expected the headers and the first 1KB of the body, %v and %v bytes are found", f.Header, len(f.Body))
+	}
+	if !strings.Contains(buf.String(), "\nFirst failure:\n  GET "+server.URL+"/item?fail=1\n  HTTP/1.1 500 Internal Server Error\n") {
+		t.Errorf("Expected the first failure to be printed, %v is found", buf.String())
+	}
+}
+
+func TestFirstFailure_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      2,
+		C:      1,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if f := rpt.FirstFailure; f == nil || f.Status != "" || !strings.Contains(f.Error, "refused") {
+		t.Errorf("Expected the error of the request, %+v is found", f)
+	}
+}
+
+func TestFirstFailure_Disabled(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:              2,
+		C:              1,
+		NoFirstFailure: true,
+		Output:         "json",
+		Writer:         ioutil.Discard,
+	}
+	if rpt := boom.Run(); rpt.FirstFailure != nil {
+		t.Errorf("Expected no failure to be kept, %+v is found", rpt.FirstFailure)
+	}
+}
+
+func TestFirstFailure_RequestID(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		ids = make(map[string]bool)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids[r.Header.Get("X-Request-Id")] = true
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		RequestIDHeader: "X-Request-Id",
+		RequestIDSeq:    true,
+		N:               10,
+		C:               2,
+		Output:          "csv-detail",
+		Writer:          &buf,
+	}
+	rpt := boom.Run()
+	if len(ids) != 10 {
+		t.Errorf("Expected 10 unique request IDs, %v is found", ids)
+	}
+	for id := range ids {
+		if !regexp.MustCompile(`^[0-9a-f]{8}-([1-9]|10)$`).MatchString(id) {
+			t.Errorf("Expected a prefixed sequence number, %q is found", id)
+		}
+	}
+	if f := rpt.FirstFailure; f == nil || !ids[f.RequestID] {
+		t.Errorf("Expected the ID of the first failure, %+v is found", f)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 11 || !strings.HasSuffix(lines[0], ",request_id") {
+		t.Fatalf("Expected a request_id column, %v is found", buf.String())
+	}
+	for _, line := range lines[1:] {
+		if cols := strings.Split(line, ","); !ids[cols[len(cols)-1]] {
+			t.Errorf("Expected the ID of the request, %q is found", line)
+		}
+	}
+}
+
+func TestRequestDetail_RequestID(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		ids = make(map[string]bool)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids[r.Header.Get("X-Request-Id")] = true
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		RequestIDHeader: "X-Request-Id",
+		N:               10,
+		C:               2,
+		IncludeLats:     true,
+		Output:          "json",
+		Writer:          ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if len(rpt.Requests) != 10 {
+		t.Fatalf("Expected 10 request details, %d are found", len(rpt.Requests))
+	}
+	for _, d := range rpt.Requests {
+		if !ids[d.RequestID] {
+			t.Errorf("Expected the ID of the request, %+v is found", d)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// GraphQLBody returns the JSON body of a GraphQL request of the query,
+// with the variables if any. They must be a JSON object.
+func GraphQLBody(query, vars string) (string, error) {
+	body := struct {
+		Query     string          `json:"query"`
+		Variables json.RawMessage `json:"variables,omitempty"`
+	}{Query: query}
+	if vars != "" {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(vars), &m); err != nil {
+			return "", errors.New("graphql variables must be a JSON object")
+		}
+		body.Variables = json.RawMessage(vars)
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// graphqlError is the errors array of a GraphQL response, GraphQL
+// servers reply with a success status whether the query failed or not.
+type graphqlError struct {
+	// Number of errors and message of the first one.
+	count   int
+	message string
+}
+
+func (e *graphqlError) Error() string {
+	if e.count == 0 {
+		return "graphql: " + e.message
+	}
+	return fmt.Sprintf("graphql: %d errors, %s", e.count, e.message)
+}
+
+// Decodes the GraphQL response of the body, returns an error if it has
+// errors or is not JSON.
+func checkGraphQL(body io.Reader) error {
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return &graphqlError{message: "the response is not JSON"}
+	}
+	if len(resp.Errors) > 0 {
+		return &graphqlError{count: len(resp.Errors), message: resp.Errors[0].Message}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGraphQLBody(t *testing.T) {
+	body, err := GraphQLBody("query($id: ID!) {\n  user(id: $id) { name }\n}\n", `{"id": 1}`)
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	want := `{"query":"query($id: ID!) {\n  user(id: $id) { name }\n}\n","variables":{"id":1}}`
+	if body != want {
+		t.Errorf("Expected %s, %s is found", want, body)
+	}
+	if body, _ := GraphQLBody("{ me }", ""); body != `{"query":"{ me }"}` {
+		t.Errorf("Expected no variables, %s is found", body)
+	}
+	if _, err := GraphQLBody("{ me }", `[1]`); err == nil {
+		t.Errorf("Expected variables other than an object to be rejected")
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	var n int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n % 4 {
+		case 0:
+			w.Write([]byte(`{"data": null, "errors": [{"message": "boom"}, {"message": "again"}]}`))
+		case 1:
+			w.Write([]byte("<html>"))
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": [{"message": "bad"}]}`))
+		default:
+			w.Write([]byte(`{"data": {"me": "x"}}`))
+		}
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   `{"query":"{ me }"}`,
+		},
+		N:             8,
+		C:             1,
+		GraphQLErrors: true,
+		Output:        "quiet",
+		Writer:        ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.Errors[errGraphQL] != 4 {
+		t.Errorf("Expected 4 graphql errors, %v is found", rpt.Errors)
+	}
+	if s := rpt.ErrorSamples[errGraphQL]; !strings.HasPrefix(s, "graphql: ") {
+		t.Errorf("Expected a graphql error sample, %q is found", s)
+	}
+	if rpt.StatusCodeDist[http.StatusOK] != 2 || rpt.StatusCodeDist[http.StatusBadRequest] != 2 {
+		t.Errorf("Expected the failed statuses not to be decoded, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.ErrorRate != 0.5 {
+		t.Errorf("Expected an error rate of 0.5, %v is found", rpt.ErrorRate)
+	}
+}
+
+func TestClassifyError_GraphQL(t *testing.T) {
+	if c := classifyError(&graphqlError{count: 1, message: "boom"}); c != errGraphQL {
+		t.Errorf("Expected %v, %v is found", errGraphQL, c)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"time"
+)
+
+// Returns the gzip-compressed body.
+func gzipBody(body string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Compresses the body of the requests once, unless it is a template.
+// Compressed bodies are then sent with their Content-Encoding.
+func (b *Boom) prepareGzip() error {
+	if b.Req.Header == nil {
+		b.Req.Header = make(http.Header)
+	}
+	b.Req.Header.Set("Content-Encoding", "gzip")
+	if b.bodyTmpl != nil {
+		return nil
+	}
+	b.rawBody = int64(len(b.Req.Body))
+	var err error
+	b.Req.Body, err = gzipBody(b.Req.Body)
+	return err
+}
+
+// Compresses the rendered body of a request, the size of the body before
+// compression and the time it took are set on the job.
+func (b *Boom) compress(j *job, opts *ReqOpts) error {
+	start := time.Now()
+	j.rawBody = int64(len(opts.Body))
+	var err error
+	opts.Body, err = gzipBody(opts.Body)
+	j.compress = time.Since(start)
+	return err
+}
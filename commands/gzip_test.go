@@ -0,0 +1,121 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Decompresses the body and replies with its length, or 400.
+type gunzipHandler struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (h *gunzipHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Encoding") != "gzip" || r.ContentLength <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	zr, err := gzip.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	h.bodies = append(h.bodies, string(b))
+	h.mu.Unlock()
+	w.Write([]byte(strconv.Itoa(len(b))))
+}
+
+func TestGzipBody(t *testing.T) {
+	h := &gunzipHandler{}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	body := strings.Repeat(`{"event": "click"}`, 100)
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   body,
+		},
+		N:        4,
+		C:        2,
+		GzipBody: true,
+		Output:   "quiet",
+		Writer:   ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.StatusCodeDist[http.StatusOK] != 4 {
+		t.Fatalf("Expected 4 decompressed bodies, %v is found", rpt.StatusCodeDist)
+	}
+	for _, b := range h.bodies {
+		if b != body {
+			t.Errorf("Expected the body to be decompressed, %q is found", b)
+		}
+	}
+	if rpt.SizeSentRaw != int64(4*len(body)) || rpt.SizeSent <= 0 || rpt.SizeSent >= rpt.SizeSentRaw {
+		t.Errorf("Expected %v raw bytes and less sent, %v and %v are found", 4*len(body), rpt.SizeSentRaw, rpt.SizeSent)
+	}
+	if rpt.Compression != 0 {
+		t.Errorf("Expected the body to be compressed once, %v is found", rpt.Compression)
+	}
+}
+
+func TestGzipBody_Template(t *testing.T) {
+	h := &gunzipHandler{}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   `{"id": {{seq}}}`,
+		},
+		N:        3,
+		C:        1,
+		GzipBody: true,
+		Output:   "quiet",
+		Writer:   ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if len(h.bodies) != 3 {
+		t.Fatalf("Expected 3 decompressed bodies, %v is found", rpt.StatusCodeDist)
+	}
+	seen := make(map[string]bool)
+	for _, b := range h.bodies {
+		if !strings.HasPrefix(b, `{"id": `) || seen[b] {
+			t.Errorf("Expected a rendered body, %q is found", b)
+		}
+		seen[b] = true
+	}
+	if rpt.Compression <= 0 {
+		t.Errorf("Expected the compression time to be reported")
+	}
+}
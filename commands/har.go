@@ -0,0 +1,194 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Headers of a recorded request that are not replayed, either hop-by-hop
+// or set by the transport.
+var harSkippedHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Host":                true,
+	"Content-Length":      true,
+}
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// LoadHAR reads the requests of the entries of a HAR file.
+func LoadHAR(path string) ([]*ReqOpts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadHAR(f)
+}
+
+// ReadHAR reads the requests of the entries of a HAR document, in the
+// order they were recorded. Hop-by-hop headers, HTTP/2 pseudo-headers
+// and the headers set by the transport are not kept.
+func ReadHAR(r io.Reader) ([]*ReqOpts, error) {
+	var har harFile
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("invalid HAR, %v", err)
+	}
+	if len(har.Log.Entries) == 0 {
+		return nil, errors.New("HAR has no entries")
+	}
+	reqs := make([]*ReqOpts, 0, len(har.Log.Entries))
+	for i, e := range har.Log.Entries {
+		u, err := url.ParseRequestURI(e.Request.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || e.Request.Method == "" {
+			return nil, fmt.Errorf("HAR entry %d has an invalid request", i+1)
+		}
+		opts := &ReqOpts{
+			Method: strings.ToUpper(e.Request.Method),
+			Url:    e.Request.URL,
+			Header: make(http.Header),
+		}
+		for _, h := range e.Request.Headers {
+			name := http.CanonicalHeaderKey(h.Name)
+			if strings.HasPrefix(name, ":") || harSkippedHeaders[name] {
+				continue
+			}
+			opts.Header.Add(name, h.Value)
+		}
+		if pd := e.Request.PostData; pd != nil {
+			opts.Body = pd.Text
+			if opts.Header.Get("Content-Type") == "" && pd.MimeType != "" {
+				opts.Header.Set("Content-Type", pd.MimeType)
+			}
+		}
+		reqs = append(reqs, opts)
+	}
+	return reqs, nil
+}
+
+// Sets the request of the job to the n-th entry of the sequence of the
+// client, counting from 0, so that each one goes through the sequence in
+// order, over and over. The entries are rendered with the variables
+// extracted so far in the iteration, if they are templates.
+func (b *Boom) setEntry(j *job, n int, vars map[string]string) {
+	k := n % len(b.Entries)
+	e := b.Entries[k]
+	opts := *b.Req
+	opts.Method, opts.Url, opts.Header, opts.Body = e.Method, e.Url, e.Header, e.Body
+	j.req, j.err = nil, nil
+	if b.entryTmpls != nil {
+		j.err = b.renderEntry(&opts, k, vars)
+	}
+	if j.err == nil {
+		j.req = opts.Request()
+	}
+	j.entry = k + 1
+	j.extract, j.vars = e.Extract, vars
+}
+
+// EntryReport summarizes the requests made for an entry of the sequence.
+type EntryReport struct {
+	// Name of the entry, if any, and its method and URL.
+	Name      string  `json:"name,omitempty"`
+	Request   string  `json:"request"`
+	Count     int     `json:"count"`
+	Average   float64 `json:"average"`
+	P50       float64 `json:"p50"`
+	P99       float64 `json:"p99"`
+	ErrorRate float64 `json:"error_rate"`
+
+	errors int
+	total  float64
+	lh     *latencyHistogram
+}
+
+func (r *Report) setEntries(entries []*ReqOpts) {
+	r.Entries = nil
+	for _, e := range entries {
+		r.Entries = append(r.Entries, &EntryReport{Name: e.Name, Request: e.Method + " " + e.Url, lh: newLatencyHistogram()})
+	}
+}
+
+func (r *Report) addToEntry(res *result) {
+	e := r.Entries[res.entry-1]
+	e.Count++
+	if res.err != nil {
+		e.errors++
+		return
+	}
+	e.total += res.duration.Seconds()
+	e.lh.add(res.duration.Seconds())
+}
+
+// Computes the summary of each entry, the entries without results
+// are kept so that their numbers match the sequence.
+func (r *Report) finalizeEntries() {
+	for _, e := range r.Entries {
+		if e.Count == 0 {
+			continue
+		}
+		if n := e.Count - e.errors; n > 0 {
+			e.Average = e.total / float64(n)
+			e.P50 = e.lh.percentile(50)
+			e.P99 = e.lh.percentile(99)
+		}
+		e.ErrorRate = float64(e.errors) / float64(e.Count)
+	}
+}
+
+// Prints the summary of each entry.
+func (r *Report) printEntries() {
+	fmt.Fprintf(r.w, "\nEntries:\n")
+	for i, e := range r.Entries {
+		label := e.Request
+		if e.Name != "" {
+			label = e.Name + ", " + e.Request
+		}
+		fmt.Fprintf(r.w, "  [%d] %s:\t%d requests, average %4.4f secs, p50 %4.4f secs, p99 %4.4f secs, %4.2f%% errors\n",
+			i+1, label, e.Count, e.Average, e.P50, e.P99, e.ErrorRate*100)
+	}
+}
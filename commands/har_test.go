@@ -0,0 +1,108 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testHAR = `{"log": {"entries": [
+	{"request": {"method": "get", "url": "%[1]s/page", "headers": [
+		{"name": "Accept", "value": "text/html"},
+		{"name": "connection", "value": "keep-alive"},
+		{"name": "Host", "value": "example.com"},
+		{"name": ":authority", "value": "example.com"}
+	]}},
+	{"request": {"method": "POST", "url": "%[1]s/api", "headers": [
+		{"name": "Content-Length", "value": "7"}
+	], "postData": {"mimeType": "application/json", "text": "{\"a\":1}"}}}
+]}}`
+
+func TestReadHAR(t *testing.T) {
+	reqs, err := ReadHAR(strings.NewReader(fmt.Sprintf(testHAR, "http://example.com")))
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("Expected 2 entries, %v are found", len(reqs))
+	}
+	if r := reqs[0]; r.Method != "GET" || r.Url != "http://example.com/page" || r.Body != "" {
+		t.Errorf("Unexpected first entry %+v", r)
+	}
+	if h := reqs[0].Header; len(h) != 1 || h.Get("Accept") != "text/html" {
+		t.Errorf("Expected only the Accept header to be kept, %v is found", h)
+	}
+	if r := reqs[1]; r.Method != "POST" || r.Body != `{"a":1}` || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Content-Length") != "" {
+		t.Errorf("Unexpected second entry %+v", r)
+	}
+
+	for _, s := range []string{`{}`, `{"log": {"entries": [{"request": {"method": "GET", "url": "/rel"}}]}}`, `not json`} {
+		if _, err := ReadHAR(strings.NewReader(s)); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestRun_Entries(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path+" "+string(body))
+		mu.Unlock()
+		if r.URL.Path == "/api" {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+	defer server.Close()
+
+	entries, _ := ReadHAR(strings.NewReader(fmt.Sprintf(testHAR, server.URL)))
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    entries[0].Url,
+		},
+		Entries: entries,
+		N:       6,
+		C:       1,
+		Output:  "quiet",
+		Writer:  ioutil.Discard,
+	}
+	rpt := boom.Run()
+	want := []string{"GET /page ", `POST /api {"a":1}`}
+	for i, p := range paths {
+		if p != want[i%2] {
+			t.Errorf("Expected request %d to be %q, %q is found", i+1, want[i%2], p)
+		}
+	}
+	if len(rpt.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, %v are found", len(rpt.Entries))
+	}
+	if e := rpt.Entries[1]; e.Request != "POST "+server.URL+"/api" || e.Count != 3 {
+		t.Errorf("Unexpected second entry %+v", e)
+	}
+	if rpt.StatusCodeDist[http.StatusTeapot] != 3 || rpt.StatusCodeDist[http.StatusOK] != 3 {
+		t.Errorf("Expected 3 responses of each entry, %v is found", rpt.StatusCodeDist)
+	}
+}
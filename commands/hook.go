@@ -0,0 +1,100 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import "time"
+
+// Number of results queued for OnResult, results are dropped rather
+// than blocking the collection once the queue is full.
+const hookQueueSize = 1024
+
+// Result is a completed request, as passed to OnResult.
+type Result struct {
+	// Sequence number of the request, in the order it was issued.
+	Seq int
+	// Index of the worker that made the request.
+	Worker     int
+	Url        string
+	Start      time.Time
+	Duration   time.Duration
+	StatusCode int
+	Proto      string
+	// Bytes of the response body received, and of the request body sent.
+	ContentLength int64
+	Sent          int64
+	// Error of the request, if it failed, the other fields are then
+	// those known before it did.
+	Err error
+}
+
+// hook passes each result to a callback, from a goroutine of its own so
+// that a slow callback delays neither the collection nor the workers.
+type hook struct {
+	fn func(Result)
+	// URL of the results not picked from a list.
+	url   string
+	queue chan Result
+	done  chan struct{}
+	// Number of results dropped since the queue was full, only updated
+	// by the collection.
+	dropped int
+}
+
+func newHook(fn func(Result), url string) *hook {
+	h := &hook{
+		fn:    fn,
+		url:   url,
+		queue: make(chan Result, hookQueueSize),
+		done:  make(chan struct{}),
+	}
+	go h.loop()
+	return h
+}
+
+func (h *hook) observe(res *result) {
+	r := Result{
+		Seq:           res.seq,
+		Worker:        res.worker,
+		Url:           res.url,
+		Start:         res.start,
+		Duration:      res.duration,
+		StatusCode:    res.statusCode,
+		Proto:         res.proto,
+		ContentLength: res.contentLength,
+		Sent:          res.sent,
+		Err:           res.err,
+	}
+	if r.Url == "" {
+		r.Url = h.url
+	}
+	select {
+	case h.queue <- r:
+	default:
+		h.dropped++
+	}
+}
+
+func (h *hook) loop() {
+	defer close(h.done)
+	for r := range h.queue {
+		h.fn(r)
+	}
+}
+
+// Waits for the queued results to be passed to the callback.
+func (h *hook) close() {
+	close(h.queue)
+	<-h.done
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOnResult(t *testing.T) {
+	var got []Result
+	rpt, err := Run(context.Background(), Config{
+		Url:       "http://example.invalid/missing",
+		N:         20,
+		C:         2,
+		Transport: &stubTransport{},
+		OnResult: func(r Result) {
+			got = append(got, r)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 20 {
+		t.Fatalf("Expected 20 results, %v are found", len(got))
+	}
+	seqs := make(map[int]bool)
+	workers := make(map[int]bool)
+	for _, r := range got {
+		seqs[r.Seq] = true
+		workers[r.Worker] = true
+		if r.StatusCode != 404 || r.ContentLength != 5 || r.Url != "http://example.invalid/missing" || r.Start.IsZero() || r.Err != nil {
+			t.Errorf("Expected a 404 response of 5 bytes, %+v is found", r)
+		}
+	}
+	if len(seqs) != 20 {
+		t.Errorf("Expected a result per request, %v are found", seqs)
+	}
+	if len(workers) > 2 || !workers[0] && !workers[1] {
+		t.Errorf("Expected the results of workers 0 and 1, %v are found", workers)
+	}
+	if rpt.DroppedResults != 0 {
+		t.Errorf("Expected no dropped result, %v is found", rpt.DroppedResults)
+	}
+}
+
+// lastTransport closes its channel once it answered the last request,
+// the results left to collect are then fewer than those dropped.
+type lastTransport struct {
+	stubTransport
+	sent int64
+	n    int64
+	last chan struct{}
+}
+
+func (l *lastTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := l.stubTransport.RoundTrip(req)
+	if atomic.AddInt64(&l.sent, 1) == l.n {
+		close(l.last)
+	}
+	return resp, err
+}
+
+func TestOnResult_Dropped(t *testing.T) {
+	const n = 3 * hookQueueSize
+	tr := &lastTransport{n: n, last: make(chan struct{})}
+	var count int
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "http://example.invalid/",
+		},
+		N:         n,
+		C:         4,
+		Transport: tr,
+		Writer:    ioutil.Discard,
+		// Slower than the run, which does not wait for it.
+		OnResult: func(r Result) {
+			<-tr.last
+			count++
+		},
+	}
+	rpt, err := boom.RunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The callback holds one result and the queue is full, beyond the
+	// results still buffered or in flight once the last one is sent.
+	if min := n - hookQueueSize - 1 - boom.C*(resultsPerWorker+1); rpt.DroppedResults < min {
+		t.Errorf("Expected at least %v dropped results, %v is found", min, rpt.DroppedResults)
+	}
+	if count+rpt.DroppedResults != n {
+		t.Errorf("Expected %v results passed or dropped, %v and %v are found", n, count, rpt.DroppedResults)
+	}
+	if rpt.StatusCodeDist[200] != n {
+		t.Errorf("Expected %v responses in the report, %v is found", n, rpt.StatusCodeDist)
+	}
+}
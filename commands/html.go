@@ -0,0 +1,150 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+)
+
+// Page of the html output. It has no external dependency, the charts are
+// drawn from the report embedded as JSON.
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>boom report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { padding: 0.2em 1em; border-bottom: 1px solid #ddd; text-align: left; }
+td.num { text-align: right; font-family: monospace; }
+svg rect { fill: #4a7fb5; }
+svg rect:hover { fill: #e07b39; }
+svg text { font-size: 11px; fill: #555; }
+</style>
+</head>
+<body>
+<h1>boom report</h1>
+{{if .Interrupted}}<p>Interrupted after {{.Count}} requests.</p>{{end}}
+{{if .DeadlineHit}}<p>Deadline hit after {{.Count}} requests, {{.Cancelled}} in-flight requests cancelled.</p>{{end}}
+<h2>Summary</h2>
+<table>
+<tr><td>Total</td><td class="num">{{printf "%4.4f" .Total.Seconds}} secs</td></tr>
+<tr><td>Slowest</td><td class="num">{{printf "%4.4f" .Slowest}} secs</td></tr>
+<tr><td>Fastest</td><td class="num">{{printf "%4.4f" .Fastest}} secs</td></tr>
+<tr><td>Average</td><td class="num">{{printf "%4.4f" .Average}} secs</td></tr>
+<tr><td>Std deviation</td><td class="num">{{printf "%4.4f" .StdDev}} secs</td></tr>
+<tr><td>Requests/sec</td><td class="num">{{printf "%4.4f" .RPS}}</td></tr>
+<tr><td>Error rate</td><td class="num">{{printf "%.2f%%" .ErrorRatePct}}</td></tr>
+{{if .SizeTotal}}<tr><td>Total data received</td><td class="num">{{.SizeTotal}} bytes</td></tr>{{end}}
+</table>
+<h2>Status code distribution</h2>
+<table>
+<tr><th>Status</th><th>Responses</th></tr>
+{{range .StatusCodes}}<tr><td>{{.Code}}</td><td class="num">{{.Count}}</td></tr>
+{{end}}</table>
+{{if .Errors}}<h2>Errors</h2>
+<table>
+<tr><th>Error</th><th>Count</th><th>Example</th></tr>
+{{range .ErrorRows}}<tr><td>{{.Category}}</td><td class="num">{{.Count}}</td><td>{{.Sample}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Response time histogram</h2>
+<svg id="histogram" width="720" height="260"></svg>
+<h2>Latency distribution</h2>
+<svg id="percentiles" width="720" height="260"></svg>
+<script>
+var report = {{.JSON}};
+
+function bars(id, items, label, value, title) {
+  var svg = document.getElementById(id), ns = "http://www.w3.org/2000/svg";
+  var w = +svg.getAttribute("width"), h = +svg.getAttribute("height") - 20;
+  var max = 0;
+  items.forEach(function(it) { max = Math.max(max, value(it)); });
+  var bw = w / Math.max(items.length, 1);
+  items.forEach(function(it, i) {
+    var bh = max > 0 ? value(it) / max * (h - 10) : 0;
+    var r = document.createElementNS(ns, "rect");
+    r.setAttribute("x", i * bw + 2);
+    r.setAttribute("y", h - bh);
+    r.setAttribute("width", Math.max(bw - 4, 1));
+    r.setAttribute("height", bh);
+    var t = document.createElementNS(ns, "title");
+    t.textContent = title(it);
+    r.appendChild(t);
+    svg.appendChild(r);
+    var l = document.createElementNS(ns, "text");
+    l.setAttribute("x", i * bw + 2);
+    l.setAttribute("y", h + 15);
+    l.textContent = label(it);
+    svg.appendChild(l);
+  });
+}
+
+bars("histogram", report.histogram || [],
+  function(b) { return b.mark.toFixed(3); },
+  function(b) { return b.count; },
+  function(b) { return "<= " + b.mark.toFixed(4) + " secs: " + b.count + " responses"; });
+bars("percentiles", report.latency_distribution || [],
+  function(p) { return p.percentage + "%"; },
+  function(p) { return p.latency; },
+  function(p) { return p.percentage + "% in " + p.latency.toFixed(4) + " secs"; });
+</script>
+</body>
+</html>
+`))
+
+type htmlStatus struct {
+	Code  int
+	Count int
+}
+
+type htmlError struct {
+	Category string
+	Count    int
+	Sample   string
+}
+
+// Prints the report as a self-contained HTML page.
+func (r *Report) printHTML() {
+	rpt := *r
+	if !r.includeLats {
+		rpt.Lats = nil
+	}
+	var codes []htmlStatus
+	for code, n := range r.StatusCodeDist {
+		codes = append(codes, htmlStatus{code, n})
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	var errs []htmlError
+	for _, c := range errorCategories {
+		if n := r.Errors[c]; n > 0 {
+			errs = append(errs, htmlError{categoryName(c), n, r.ErrorSamples[c]})
+		}
+	}
+	data := struct {
+		*Report
+		JSON         *Report
+		StatusCodes  []htmlStatus
+		ErrorRows    []htmlError
+		Count        int
+		ErrorRatePct float64
+	}{r, &rpt, codes, errs, r.resCount, r.ErrorRate * 100}
+	if err := htmlTemplate.Execute(r.w, data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"sync"
+	"time"
+)
+
+// Lateness the limiter catches up with, so that sleep overshoots
+// don't lower the rate.
+const limiterBurst = 10 * time.Millisecond
+
+// limiter is a token bucket, safe for concurrent use. Callers wait
+// for their slot, slots are spread evenly at the rate limit.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	// Set if all the missed slots are caught up with, so that the slots
+	// keep to the schedule whatever the lateness of the callers.
+	catchUp bool
+}
+
+func newLimiter(qps int) *limiter {
+	l := &limiter{}
+	l.setRate(qps)
+	// As a ticker would, the first slot is after an interval.
+	l.next = time.Now().Add(l.interval)
+	return l
+}
+
+func (l *limiter) setRate(qps int) {
+	l.mu.Lock()
+	l.interval = time.Duration(float64(time.Second) / float64(qps))
+	l.mu.Unlock()
+}
+
+// Reserves the next slot and returns its time.
+func (l *limiter) reserve() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if min := time.Now().Add(-limiterBurst); !l.catchUp && l.next.Before(min) {
+		// Unused slots don't accumulate beyond the burst.
+		l.next = min
+	}
+	t := l.next
+	l.next = l.next.Add(l.interval)
+	return t
+}
+
+// Waits for the next slot. Returns false if stop is closed or the
+// deadline is hit before.
+func (l *limiter) wait(stop <-chan struct{}, deadline <-chan time.Time) bool {
+	_, ok := l.waitSlot(stop, deadline)
+	return ok
+}
+
+// Waits for the next slot as wait does, and returns its time.
+func (l *limiter) waitSlot(stop <-chan struct{}, deadline <-chan time.Time) (time.Time, bool) {
+	slot := l.reserve()
+	d := time.Until(slot)
+	if d <= 0 {
+		return slot, true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return slot, true
+	case <-deadline:
+		return slot, false
+	case <-stop:
+		return slot, false
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter_HighRate(t *testing.T) {
+	var (
+		wg    sync.WaitGroup
+		count int64
+	)
+	l := newLimiter(20000)
+	deadline := time.After(500 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		<-deadline
+		close(done)
+	}()
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l.wait(done, nil) {
+				atomic.AddInt64(&count, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	// 10000 slots in 500ms, the first one after an interval.
+	if count < 9500 || count > 10050 {
+		t.Errorf("Expected about 10000 slots, %v is found", count)
+	}
+}
+
+func TestLimiter_NoBurst(t *testing.T) {
+	l := newLimiter(100)
+	time.Sleep(200 * time.Millisecond)
+	// Unused slots beyond the burst are lost, 5 slots take about 30ms.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.wait(nil, nil)
+	}
+	if d := time.Since(start); d < 25*time.Millisecond {
+		t.Errorf("Expected slots to be spread after idling, %v is found", d)
+	}
+}
+
+func TestLimiter_CatchUp(t *testing.T) {
+	l := newLimiter(100)
+	l.catchUp = true
+	first := l.next
+	time.Sleep(200 * time.Millisecond)
+	// Missed slots are all caught up with, on schedule.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		slot, ok := l.waitSlot(nil, nil)
+		if want := first.Add(time.Duration(i) * 10 * time.Millisecond); !ok || !slot.Equal(want) {
+			t.Errorf("Expected slot %d at %v, %v is found", i, want, slot)
+		}
+	}
+	if d := time.Since(start); d > 40*time.Millisecond {
+		t.Errorf("Expected the missed slots right away, %v is found", d)
+	}
+}
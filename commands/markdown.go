@@ -0,0 +1,90 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Escapes the pipes of the table cells.
+var mdEscaper = strings.NewReplacer("|", "\\|")
+
+// Prints the report as GitHub-flavored Markdown, with the precision
+// of the text summary.
+func (r *Report) printMarkdown() {
+	fmt.Fprintf(r.w, "## Summary\n\n")
+	fmt.Fprintf(r.w, "| Metric | Value |\n| --- | ---: |\n")
+	fmt.Fprintf(r.w, "| Total | %4.4f secs |\n", r.Total.Seconds())
+	if r.latCount > 0 {
+		fmt.Fprintf(r.w, "| Slowest | %4.4f secs |\n", r.Slowest)
+		fmt.Fprintf(r.w, "| Fastest | %4.4f secs |\n", r.Fastest)
+		fmt.Fprintf(r.w, "| Average | %4.4f secs |\n", r.Average)
+		fmt.Fprintf(r.w, "| Std deviation | %4.4f secs |\n", r.StdDev)
+	}
+	fmt.Fprintf(r.w, "| Requests/sec | %4.4f |\n", r.RPS)
+	fmt.Fprintf(r.w, "| Error rate | %.2f%% |\n", r.ErrorRate*100)
+	if r.SizeTotal > 0 {
+		fmt.Fprintf(r.w, "| Total data received | %d bytes |\n", r.SizeTotal)
+	}
+
+	if len(r.LatencyDistribution) > 0 {
+		fmt.Fprintf(r.w, "\n## Latency distribution\n\n")
+		fmt.Fprintf(r.w, "| Percentile | Latency |\n| ---: | ---: |\n")
+		for _, ld := range r.LatencyDistribution {
+			fmt.Fprintf(r.w, "| %v%% | %4.4f secs |\n", ld.Percentage, ld.Latency)
+		}
+	}
+	if len(r.CorrectedLatencyDistribution) > 0 {
+		fmt.Fprintf(r.w, "\n## Corrected latency distribution\n\n")
+		fmt.Fprintf(r.w, "Latencies from the intended start of the requests.\n\n")
+		fmt.Fprintf(r.w, "| Percentile | Latency |\n| ---: | ---: |\n")
+		for _, ld := range r.CorrectedLatencyDistribution {
+			fmt.Fprintf(r.w, "| %v%% | %4.4f secs |\n", ld.Percentage, ld.Latency)
+		}
+	}
+
+	if len(r.StatusCodeDist) > 0 {
+		var codes []int
+		for code := range r.StatusCodeDist {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		fmt.Fprintf(r.w, "\n## Status code distribution\n\n")
+		fmt.Fprintf(r.w, "| Status | Responses | Min | Average | p95 |\n| --- | ---: | ---: | ---: | ---: |\n")
+		for _, code := range codes {
+			st := r.StatusCodeStats[code]
+			fmt.Fprintf(r.w, "| %d | %d | %4.4f secs | %4.4f secs | %4.4f secs |\n",
+				code, r.StatusCodeDist[code], st.Min, st.Average, st.P95)
+		}
+	}
+
+	if len(r.Histogram) > 0 {
+		fmt.Fprintf(r.w, "\n## Response time histogram\n\n```\n")
+		r.printHistogramBars()
+		fmt.Fprintf(r.w, "```\n")
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(r.w, "\n## Errors\n\n")
+		fmt.Fprintf(r.w, "| Error | Count | Example |\n| --- | ---: | --- |\n")
+		for _, c := range errorCategories {
+			if num := r.Errors[c]; num > 0 {
+				fmt.Fprintf(r.w, "| %s | %d | %s |\n", categoryName(c), num, mdEscaper.Replace(r.ErrorSamples[c]))
+			}
+		}
+	}
+}
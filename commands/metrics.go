@@ -0,0 +1,152 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the latency histogram buckets, in seconds.
+var metricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics serve the live counters of a run in the Prometheus text
+// format. The counters are those of the report, written out by the
+// collection for each scrape so that they match the summary.
+type metrics struct {
+	// Scrapes waiting for the counters, answered by the collection.
+	scrapes chan chan []byte
+	// Counters once all the results are collected, set before done is
+	// closed.
+	final []byte
+	done  chan struct{}
+
+	// Number of requests in flight, updated atomically by the workers.
+	inflight int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		scrapes: make(chan chan []byte),
+		done:    make(chan struct{}),
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	reply := make(chan []byte, 1)
+	select {
+	case m.scrapes <- reply:
+		w.Write(<-reply)
+	case <-m.done:
+		w.Write(m.final)
+	}
+}
+
+// Adds a latency to the histogram buckets of the metrics.
+func (r *Report) addMetricsLatency(d float64) {
+	if r.metricsCounts == nil {
+		r.metricsCounts = make([]int64, len(metricsBuckets))
+	}
+	for i, b := range metricsBuckets {
+		if d <= b {
+			r.metricsCounts[i]++
+			break
+		}
+	}
+}
+
+// Returns the metrics of the results aggregated so far.
+func (r *Report) writeMetrics() []byte {
+	var buf bytes.Buffer
+	classes := make(map[string]int64)
+	for code, n := range r.StatusCodeDist {
+		classes[fmt.Sprintf("%dxx", code/100)] += int64(n)
+	}
+	errs := make(map[string]int64, len(r.Errors))
+	for c, n := range r.Errors {
+		errs[c] = int64(n)
+	}
+
+	fmt.Fprintf(&buf, "# HELP boom_requests_total Responses received, by status class.\n")
+	fmt.Fprintf(&buf, "# TYPE boom_requests_total counter\n")
+	for _, k := range sortedKeys(classes) {
+		fmt.Fprintf(&buf, "boom_requests_total{class=%q} %d\n", k, classes[k])
+	}
+	fmt.Fprintf(&buf, "# HELP boom_errors_total Requests failed without a response, by type.\n")
+	fmt.Fprintf(&buf, "# TYPE boom_errors_total counter\n")
+	for _, k := range sortedKeys(errs) {
+		fmt.Fprintf(&buf, "boom_errors_total{type=%q} %d\n", k, errs[k])
+	}
+	fmt.Fprintf(&buf, "# HELP boom_request_duration_seconds Latency of the responses.\n")
+	fmt.Fprintf(&buf, "# TYPE boom_request_duration_seconds histogram\n")
+	var cum int64
+	for i, b := range metricsBuckets {
+		if r.metricsCounts != nil {
+			cum += r.metricsCounts[i]
+		}
+		fmt.Fprintf(&buf, "boom_request_duration_seconds_bucket{le=\"%g\"} %d\n", b, cum)
+	}
+	fmt.Fprintf(&buf, "boom_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", r.latCount)
+	fmt.Fprintf(&buf, "boom_request_duration_seconds_sum %g\n", r.AvgTotal)
+	fmt.Fprintf(&buf, "boom_request_duration_seconds_count %d\n", r.latCount)
+	fmt.Fprintf(&buf, "# HELP boom_inflight_requests Requests in flight.\n")
+	fmt.Fprintf(&buf, "# TYPE boom_inflight_requests gauge\n")
+	fmt.Fprintf(&buf, "boom_inflight_requests %d\n", atomic.LoadInt64(&r.metrics.inflight))
+	fmt.Fprintf(&buf, "# HELP boom_bytes_received_total Size of the response bodies.\n")
+	fmt.Fprintf(&buf, "# TYPE boom_bytes_received_total counter\n")
+	fmt.Fprintf(&buf, "boom_bytes_received_total %d\n", r.SizeTotal)
+	return buf.Bytes()
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricsServer serves the metrics while the run goes on.
+type metricsServer struct {
+	srv *http.Server
+	ln  net.Listener
+}
+
+func serveMetrics(addr string, m *metrics) (*metricsServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	s := &metricsServer{srv: &http.Server{Handler: mux}, ln: ln}
+	go s.srv.Serve(ln)
+	return s, nil
+}
+
+// Waits for in-progress scrapes, then closes the server.
+func (s *metricsServer) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,101 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Returns the metrics served for the report.
+func scrape(m *metrics) string {
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	ch := make(chan *result)
+	rpt := newReport(0, ch, "quiet", ioutil.Discard)
+	rpt.metrics = newMetrics()
+	rpt.metrics.inflight = 2
+	go rpt.collect()
+	ch <- &result{statusCode: 200, duration: 3 * time.Millisecond, contentLength: 10}
+	ch <- &result{statusCode: 204, duration: 20 * time.Millisecond, contentLength: -1}
+	ch <- &result{statusCode: 503, duration: time.Millisecond, contentLength: 5}
+	ch <- &result{err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}
+
+	// Answered by the collection, then once it is over.
+	live := scrape(rpt.metrics)
+	close(ch)
+	<-rpt.done
+	for _, out := range []string{live, scrape(rpt.metrics)} {
+		for _, line := range []string{
+			`boom_requests_total{class="2xx"} 2`,
+			`boom_requests_total{class="5xx"} 1`,
+			`boom_errors_total{type="connection_refused"} 1`,
+			`boom_request_duration_seconds_bucket{le="0.005"} 2`,
+			`boom_request_duration_seconds_bucket{le="0.025"} 3`,
+			`boom_request_duration_seconds_bucket{le="+Inf"} 3`,
+			`boom_request_duration_seconds_count 3`,
+			`boom_inflight_requests 2`,
+			`boom_bytes_received_total 15`,
+		} {
+			if !strings.Contains(out, line+"\n") {
+				t.Errorf("Expected %q in the metrics, %q is found", line, out)
+			}
+		}
+	}
+}
+
+func TestMetrics_Run(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:           10,
+		C:           2,
+		MetricsAddr: addr,
+		Output:      "json",
+		Writer:      ioutil.Discard,
+	}
+	if rpt := boom.Run(); rpt == nil {
+		t.Fatalf("Expected a report")
+	}
+	if out := scrape(boom.metrics); !strings.Contains(out, "boom_request_duration_seconds_count 10\n") {
+		t.Errorf("Expected 10 requests in the metrics, %q is found", out)
+	}
+	// The endpoint is shut down at the end of the run.
+	if _, err := http.Get("http://" + addr + "/metrics"); err == nil {
+		t.Errorf("Expected the metrics endpoint to be closed")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MultipartField is a field of a multipart/form-data body, either a
+// value or the content of a file.
+type MultipartField struct {
+	Name  string
+	Value string
+	// Path of the file of the field, if any, its content is then the
+	// value of the field.
+	File string
+}
+
+// Multipart is a multipart/form-data body. Its files are read for each
+// request as it is sent, rather than held in memory.
+type Multipart struct {
+	boundary string
+	segments []segment
+	size     int64
+}
+
+// segment is a part of the body, either bytes or the first size bytes
+// of a file.
+type segment struct {
+	data []byte
+	file string
+	size int64
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// NewMultipart returns the body of the fields, with a random boundary.
+// The size of the files is that of when it is called.
+func NewMultipart(fields []MultipartField) (*Multipart, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	m := &Multipart{boundary: w.Boundary()}
+	for _, f := range fields {
+		if f.File == "" {
+			if err := w.WriteField(f.Name, f.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		fi, err := os.Stat(f.File)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a file", f.File)
+		}
+		ctype := mime.TypeByExtension(filepath.Ext(f.File))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(f.Name), quoteEscaper.Replace(filepath.Base(f.File))))
+		h.Set("Content-Type", ctype)
+		if _, err := w.CreatePart(h); err != nil {
+			return nil, err
+		}
+		m.add(segment{data: append([]byte(nil), buf.Bytes()...)})
+		m.add(segment{file: f.File, size: fi.Size()})
+		buf.Reset()
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	m.add(segment{data: buf.Bytes()})
+	return m, nil
+}
+
+func (m *Multipart) add(s segment) {
+	if s.file == "" {
+		s.size = int64(len(s.data))
+	}
+	m.segments = append(m.segments, s)
+	m.size += s.size
+}
+
+// ContentType returns the content-type of the body, with its boundary.
+func (m *Multipart) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// Len returns the size of the body, in bytes.
+func (m *Multipart) Len() int64 {
+	return m.size
+}
+
+// Returns a new reader of the body, the files are opened as they are
+// reached.
+func (m *Multipart) body() io.ReadCloser {
+	return &multipartBody{segments: m.segments}
+}
+
+type multipartBody struct {
+	segments []segment
+	cur      io.Reader
+	f        *os.File
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	for len(b.segments) > 0 {
+		if b.cur == nil {
+			s := b.segments[0]
+			if s.file == "" {
+				b.cur = bytes.NewReader(s.data)
+			} else {
+				f, err := os.Open(s.file)
+				if err != nil {
+					return 0, err
+				}
+				b.f, b.cur = f, io.LimitReader(f, s.size)
+			}
+		}
+		n, err := b.cur.Read(p)
+		if err == io.EOF {
+			b.Close()
+			b.cur, b.segments = nil, b.segments[1:]
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+// Closes the file being read, if any.
+func (b *multipartBody) Close() error {
+	if b.f == nil {
+		return nil
+	}
+	err := b.f.Close()
+	b.f = nil
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultipart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+	ioutil.WriteFile(path, content, 0644)
+	m, err := NewMultipart([]MultipartField{{Name: "title", Value: "a \"b\""}, {Name: "photo", File: path}})
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+
+	fail := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != m.Len() || len(r.TransferEncoding) > 0 {
+			fail <- "the body is expected not to be chunked"
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			fail <- err.Error()
+			return
+		}
+		if r.FormValue("title") != `a "b"` {
+			fail <- "unexpected title " + r.FormValue("title")
+		}
+		f, h, err := r.FormFile("photo")
+		if err != nil {
+			fail <- err.Error()
+			return
+		}
+		defer f.Close()
+		b, _ := ioutil.ReadAll(f)
+		if h.Filename != "photo.jpg" || h.Header.Get("Content-Type") != "image/jpeg" || !bytes.Equal(b, content) {
+			fail <- "unexpected file " + h.Filename
+		}
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method:    "POST",
+			Url:       server.URL,
+			Multipart: m,
+		},
+		N:      4,
+		C:      2,
+		Output: "quiet",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	close(fail)
+	for msg := range fail {
+		t.Error(msg)
+	}
+	if rpt.SizeSent != 4*m.Len() {
+		t.Errorf("Expected %v bytes sent, %v is found", 4*m.Len(), rpt.SizeSent)
+	}
+	if rpt.StatusCodeDist[http.StatusOK] != 4 {
+		t.Errorf("Expected 4 responses, %v is found", rpt.StatusCodeDist)
+	}
+}
+
+func TestMultipart_NotAFile(t *testing.T) {
+	if _, err := NewMultipart([]MultipartField{{Name: "f", File: t.TempDir()}}); err == nil {
+		t.Errorf("Expected a directory to be rejected")
+	}
+}
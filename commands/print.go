@@ -15,176 +15,1557 @@
 package commands
 
 import (
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const (
 	barChar = "∎"
+
+	// Default and maximum number of histogram buckets.
+	defaultBuckets = 10
+	maxBuckets     = 100
 )
 
+// Report holds the statistics of a run. The JSON keys are part of the
+// "json" output format and should be kept stable. Latencies are in seconds.
 type Report struct {
-	AvgTotal   float64
-	Fastest    float64
-	Slowest    float64
-	Average    float64
-	RPS        float64
-	SuccessRPS float64
+	AvgTotal   float64 `json:"-"`
+	Fastest    float64 `json:"fastest"`
+	Slowest    float64 `json:"slowest"`
+	Average    float64 `json:"average"`
+	StdDev     float64 `json:"stddev"`
+	Variance   float64 `json:"variance"`
+	RPS        float64 `json:"rps"`
+	SuccessRPS float64 `json:"success_rps"`
+	// Fraction of the completed requests that failed.
+	ErrorRate float64 `json:"error_rate"`
 
 	results chan *result
-	Total   time.Duration
+	// Total duration of the run, in nanoseconds in the JSON output.
+	Total time.Duration `json:"total_ns"`
+
+	StatusCodeDist map[int]int `json:"status_code_dist"`
+	// Latency statistics per status code.
+	StatusCodeStats map[int]*StatusStats `json:"status_code_stats"`
+	// Sorted status codes and classes, with their share of the responses.
+	StatusCodes   []StatusCount  `json:"status_codes"`
+	StatusClasses []ClassCount   `json:"status_classes"`
+	ProtocolDist  map[string]int `json:"protocol_dist"`
+	// Number of connections per address family, "IPv4" or "IPv6".
+	Families map[string]int `json:"address_families,omitempty"`
+	// Number of connections per local address, if set.
+	LocalAddrs map[string]int `json:"local_addrs,omitempty"`
+	// Lookup of the host made at startup, if any, or else the number of
+	// connections per server address if the host is resolved by each one.
+	Resolution  *Resolution    `json:"resolution,omitempty"`
+	ServerAddrs map[string]int `json:"server_addrs,omitempty"`
+	// Number of TLS handshakes per negotiated version and cipher suite.
+	TLSVersions  map[string]int `json:"tls_versions,omitempty"`
+	CipherSuites map[string]int `json:"cipher_suites,omitempty"`
+	// Number of requests per URL, if a list of URLs is used.
+	UrlDist             map[string]int        `json:"url_dist,omitempty"`
+	LatencyDistribution []LatencyDistribution `json:"latency_distribution"`
+	Histogram           []Bucket              `json:"histogram"`
+	// Latency distribution of the successful requests from the time they
+	// were due, if latencies are corrected for coordinated omission.
+	CorrectedLatencyDistribution []LatencyDistribution `json:"corrected_latency_distribution,omitempty"`
+	// Intended share of the requests per URL, if the URLs are weighted.
+	UrlWeights map[string]float64 `json:"url_weights,omitempty"`
+	// Number of requests per User-Agent, if a list of at most 10 is used.
+	UserAgentDist map[string]int `json:"user_agent_dist,omitempty"`
+	// Sorted latencies, only part of the JSON output if requested.
+	Lats []float64 `json:"lats,omitempty"`
+	// Number of errors per category, with a message of each category.
+	// The number of errors per message is only kept if requested.
+	Errors       map[string]int    `json:"errors"`
+	ErrorSamples map[string]string `json:"error_samples,omitempty"`
+	RawErrors    map[string]int    `json:"raw_errors,omitempty"`
+	SizeTotal    int64             `json:"size_total"`
+	SizeSent     int64             `json:"size_sent"`
+	// Size of the bodies sent before compression, if compressed, and the
+	// average time spent compressing one, in seconds.
+	SizeSentRaw int64   `json:"size_sent_raw,omitempty"`
+	Compression float64 `json:"compression_avg,omitempty"`
+	// Number of responses whose body was cut at the maximum size.
+	Truncated int `json:"truncated"`
+	// Number of requests whose body was sent without a 100 Continue
+	// response, once the wait for it timed out.
+	ContinueTimeouts int `json:"continue_timeouts,omitempty"`
+	// First request that failed, if kept.
+	FirstFailure *Failure `json:"first_failure,omitempty"`
+	// Number of responses saved to files.
+	Saved int `json:"saved_responses,omitempty"`
+	// Number of responses not saved as the files were written slower
+	// than they came.
+	SaveDropped int `json:"save_dropped,omitempty"`
+	// Number of responses with a status other than the expected ones,
+	// if any are set. They are not part of SuccessRPS.
+	FailedStatus int `json:"failed_status"`
+	// Number of responses failing the body assertion, if any, and the
+	// start of the first one of them.
+	AssertFailures int    `json:"assert_failures"`
+	AssertExample  string `json:"assert_example,omitempty"`
+	// Latency per stage of the successful requests.
+	Breakdown *Breakdown `json:"latency_breakdown,omitempty"`
+	// Statistics per interval of the run, if requested.
+	TimeSeries []*Interval `json:"time_series,omitempty"`
+	// Outcome of the SLA checks, if any.
+	SLA []*SLACheck `json:"sla,omitempty"`
+	// Number of retried attempts, in total and per reason.
+	Retries     int            `json:"retries"`
+	RetryErrors map[string]int `json:"retry_errors,omitempty"`
+	// Number of redirects followed, in total and at most by a request.
+	Redirects    int `json:"redirects"`
+	MaxRedirects int `json:"max_redirects"`
+	// Number of connections dialed during the run.
+	NewConns int `json:"new_connections"`
+	// Number of responses carrying a Set-Cookie header.
+	SetCookies int `json:"set_cookies"`
+	// Average time spent signing a request, in seconds.
+	Signing float64 `json:"signing_avg,omitempty"`
+	// Number of Digest challenges answered, their round trips are not
+	// part of the latency.
+	DigestChallenges int `json:"digest_challenges,omitempty"`
+	// Number of warmup requests excluded from the report.
+	Warmup int `json:"warmup"`
+	// Set if the run was stopped before completion.
+	Interrupted bool `json:"interrupted"`
+	// Set if the run was hard-stopped by its deadline.
+	DeadlineHit bool `json:"deadline_hit"`
+	// Number of in-flight requests cancelled when the run was stopped,
+	// they are not part of the report.
+	Cancelled int `json:"cancelled,omitempty"`
+	// Number of results not passed to OnResult, its queue being full.
+	DroppedResults int `json:"dropped_results,omitempty"`
+	// Set if the run was aborted once an error threshold was crossed.
+	Aborted *Aborted `json:"aborted,omitempty"`
+	// User and system CPU time consumed by boom during the run, in
+	// seconds, to tell whether the load generator is the bottleneck.
+	SelfCPU float64 `json:"self_cpu_seconds,omitempty"`
+	// Intended and achieved rates of a constant arrival rate run, the
+	// peak number of in-flight requests and the number of requests
+	// skipped while at the in-flight cap.
+	Rate         int     `json:"rate,omitempty"`
+	AchievedRate float64 `json:"achieved_rate,omitempty"`
+	PeakInflight int     `json:"peak_inflight,omitempty"`
+	Skipped      int     `json:"skipped,omitempty"`
+	// Think time of the workers between their requests, if any, and the
+	// number of requests per second completed by each worker.
+	Think     time.Duration `json:"think_ns,omitempty"`
+	WorkerRPS float64       `json:"worker_rps,omitempty"`
+	// Summary of each step of a step-load run.
+	Steps []*StepReport `json:"steps,omitempty"`
+	// Summary of each entry of the sequence of requests, if any.
+	Entries []*EntryReport `json:"entries,omitempty"`
+	// Paths of an access log with the highest average latencies, and
+	// the number of lines of the log that could not be parsed.
+	SlowestPaths []*PathStats `json:"slowest_paths,omitempty"`
+	LogSkipped   int          `json:"log_lines_skipped,omitempty"`
+	// Ramp-up period, and number of requests issued during it.
+	Ramp         time.Duration `json:"ramp_ns"`
+	RampRequests int           `json:"ramp_requests"`
+	// Options of the run, to tell whether reports are comparable.
+	Options *RunOptions `json:"options,omitempty"`
+	// Every request, ordered by start time, if latencies are included
+	// in the "json" output.
+	Requests []*RequestDetail `json:"requests,omitempty"`
+
+	// Number of requests to make, zero if unknown, and
+	// number of results received.
+	size     int
+	resCount int
+
+	output      string
+	includeLats bool
+	pctls       []float64
+	buckets     int
+	bucketWidth time.Duration
+	histScale   string
+	w           io.Writer
+
+	// Number of workers of the run.
+	workers int
+
+	// Length of the time series intervals, zero if disabled.
+	interval time.Duration
+
+	// Network of the connections if an address family is forced.
+	network string
+
+	// Hard deadline of the run, if any.
+	maxDuration time.Duration
+	// Maximum number of bytes read per body, if any.
+	maxBody int64
+	// Set if the requests are counted per User-Agent.
+	countUserAgents bool
+	// Set if the requests have an ID, part of the detailed outputs.
+	requestIDs bool
+	// Set if the results are read from a file, without their timings.
+	replayed bool
+	// Directory of the saved responses, and the first error saving them.
+	saveDir string
+	saveErr error
+
+	// Measurement name and default URL tag of the influx output.
+	measurement string
+	url         string
+
+	// Expected status codes, any 2xx status is a success if empty.
+	expected []int
+	// Set if the number of errors per message is kept.
+	verboseErrors bool
+	// Set if the responses that are not a success count as errors.
+	non2xxErrors bool
+	sla          *SLA
+	// Sinks fed with the results as they are collected.
+	sinks []sink
+	// Live metrics served from the aggregates, if any, and the latencies
+	// counted per bucket of their histogram.
+	metrics       *metrics
+	metricsCounts []int64
+	// Results of the current interval of the live summaries, if any,
+	// and the function printing the summary of each interval.
+	live       *window
+	onInterval func(string)
+	// Error thresholds of the run, if any, and the function stopping
+	// it once one is crossed.
+	abort   *abortCheck
+	onAbort func()
+
+	warmup         time.Duration
+	warmupRequests int
+	steps          []Step
+	// Latency per path of an access log.
+	paths map[string]*PathStats
+	// Start of the earliest request after the warmup.
+	firstStart time.Time
+
+	// Number of successful latencies. If streaming, they are
+	// aggregated into lh rather than appended to Lats.
+	latCount   int
+	successCnt int
+	stages     breakdown
+	// Running mean and sum of squared deviations of the latencies, as
+	// of Welford's algorithm.
+	mean float64
+	m2   float64
+	lh   *latencyHistogram
+	// Closed once all the results are collected.
+	done chan struct{}
+
+	// Total signing time and number of signed requests.
+	signTotal time.Duration
+	signCount int
+	// Total compression time and number of compressed bodies.
+	compressTotal time.Duration
+	compressCount int
+	// Set if latencies are corrected, with the corrected latencies of
+	// the successful requests.
+	correct       bool
+	correctedLats []float64
+	correctedLh   *latencyHistogram
+
+	// Start of the run and the raw results, kept for the detailed
+	// CSV output only.
+	start   time.Time
+	details []*result
+}
+
+// sink receives the results as they are collected, warmup included.
+// It is called by a single goroutine.
+type sink interface {
+	observe(res *result)
+}
+
+// StepReport summarizes the requests issued during a step.
+type StepReport struct {
+	Qps       int           `json:"qps"`
+	Duration  time.Duration `json:"duration_ns"`
+	Count     int           `json:"count"`
+	RPS       float64       `json:"rps"`
+	P50       float64       `json:"p50"`
+	P99       float64       `json:"p99"`
+	ErrorRate float64       `json:"error_rate"`
+	// Set if the run ended before the end of the step.
+	Partial bool `json:"partial"`
+
+	errors int
+	lh     *latencyHistogram
+}
+
+// StatusCount is the number of responses of a status code, and their
+// percentage of all the responses.
+type StatusCount struct {
+	Code    int     `json:"code"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// ClassCount is the number of responses of a status class, e.g. "2xx",
+// and their percentage of all the responses.
+type ClassCount struct {
+	Class   string  `json:"class"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// StatusStats summarizes the latencies of the responses of a status code.
+type StatusStats struct {
+	Min     float64 `json:"min"`
+	Average float64 `json:"average"`
+	P95     float64 `json:"p95"`
+
+	sum float64
+	lh  *latencyHistogram
+}
+
+// Interval summarizes the requests completed during an interval of the
+// run, intervals start at an offset from the start of the run.
+type Interval struct {
+	Start  time.Duration `json:"start_ns"`
+	Count  int           `json:"count"`
+	RPS    float64       `json:"rps"`
+	Errors int           `json:"errors"`
+	P50    float64       `json:"p50"`
+	P99    float64       `json:"p99"`
+
+	lats []float64
+}
+
+// Maximum number of intervals printed in the text summary.
+const maxPrintedIntervals = 60
 
-	StatusCodeDist map[int]int
-	Lats           []float64
-	Errors         map[string]int
-	SizeTotal      int64
+// LatencyDistribution is an entry of the percentile table.
+type LatencyDistribution struct {
+	Percentage float64 `json:"percentage"`
+	Latency    float64 `json:"latency"`
+}
 
-	output string
+// Bucket is a response time histogram bucket, counting the
+// latencies lower or equal to Mark.
+type Bucket struct {
+	Mark  float64 `json:"mark"`
+	Count int     `json:"count"`
 }
 
-func newReport(size int, results chan *result, output string) *Report {
+// Percentiles printed in the latency distribution if none are provided.
+var defaultPercentiles = []float64{10, 25, 50, 75, 90, 95, 99}
+
+func newReport(size int, results chan *result, output string, w io.Writer) *Report {
+	if w == nil {
+		w = os.Stdout
+	}
 	return &Report{
-		StatusCodeDist: make(map[int]int),
-		results:        results,
-		output:         output,
-		Errors:         make(map[string]int),
+		StatusCodeDist:  make(map[int]int),
+		StatusCodeStats: make(map[int]*StatusStats),
+		ProtocolDist:    make(map[string]int),
+		TLSVersions:     make(map[string]int),
+		Families:        make(map[string]int),
+		LocalAddrs:      make(map[string]int),
+		ServerAddrs:     make(map[string]int),
+		CipherSuites:    make(map[string]int),
+		UrlDist:         make(map[string]int),
+		UserAgentDist:   make(map[string]int),
+		paths:           make(map[string]*PathStats),
+		size:            size,
+		results:         results,
+		output:          output,
+		pctls:           defaultPercentiles,
+		buckets:         defaultBuckets,
+		w:               w,
+		Errors:          make(map[string]int),
+		ErrorSamples:    make(map[string]string),
+		RetryErrors:     make(map[string]int),
+		done:            make(chan struct{}),
 	}
 }
 
-func (r *Report) finalize(total time.Duration) {
-	successCnt := 0
+// Aggregates the results until the results channel is closed. The
+// summary of each interval is printed as it ends, if requested, the
+// last one once the results are over. Scrapes of the live metrics, if
+// served, are answered in between.
+func (r *Report) collect() {
+	defer close(r.done)
+	var tick <-chan time.Time
+	if r.live != nil {
+		r.live.start = time.Now()
+		t := time.NewTicker(r.live.length)
+		defer t.Stop()
+		tick = t.C
+	}
+	var scrapes chan chan []byte
+	if r.metrics != nil {
+		scrapes = r.metrics.scrapes
+	}
 	for {
 		select {
-		case res := <-r.results:
-			if res.err != nil {
-				r.Errors[res.err.Error()]++
-			} else {
-				r.Lats = append(r.Lats, res.duration.Seconds())
-				r.AvgTotal += res.duration.Seconds()
-				r.StatusCodeDist[res.statusCode]++
-				if res.contentLength > 0 {
-					r.SizeTotal += res.contentLength
+		case res, ok := <-r.results:
+			if !ok {
+				if r.live != nil && r.live.count > 0 {
+					r.onInterval(r.live.flush(time.Now()))
 				}
-				if res.statusCode >= 200 && res.statusCode < 300 {
-					successCnt++
+				if r.metrics != nil {
+					r.metrics.final = r.writeMetrics()
+					close(r.metrics.done)
 				}
+				return
 			}
-		default:
-			r.Total = total
-			r.RPS = float64(len(r.Lats)) / r.Total.Seconds()
-			r.SuccessRPS = float64(successCnt) / r.Total.Seconds()
-			r.Average = r.AvgTotal / float64(len(r.Lats))
-			r.print()
-			return
+			r.collectResult(res)
+		case now := <-tick:
+			r.onInterval(r.live.flush(now))
+		case reply := <-scrapes:
+			reply <- r.writeMetrics()
 		}
 	}
 }
 
-func (r *Report) print() {
+// Passes a result to the sinks and aggregates it.
+func (r *Report) collectResult(res *result) {
+	for _, s := range r.sinks {
+		s.observe(res)
+	}
+	if r.live != nil {
+		r.live.add(res)
+	}
+	if r.abort != nil && r.Aborted == nil && !r.isWarmup(res) {
+		if reason := r.abort.add(r.isFailure(res)); reason != "" {
+			r.Aborted = &Aborted{At: res.start.Add(res.duration).Sub(r.start), Reason: reason}
+			r.onAbort()
+		}
+	}
+	r.add(res)
+	if !r.keepsDetails() {
+		resultPool.Put(res)
+	}
+}
+
+// Returns true if the raw results are kept for the output.
+func (r *Report) keepsDetails() bool {
+	return r.output == "csv-detail" || r.output == "influx" || r.output == "json" && r.includeLats
+}
+
+// Aggregates a result, either collected or read from a results file.
+func (r *Report) add(res *result) {
+	r.resCount++
+	if res.start.Sub(r.start) < r.Ramp {
+		r.RampRequests++
+	}
+	if r.isWarmup(res) {
+		r.Warmup++
+		return
+	}
+	if r.firstStart.IsZero() || res.start.Before(r.firstStart) {
+		r.firstStart = res.start
+	}
+	if r.keepsDetails() {
+		r.details = append(r.details, res)
+	}
+	if len(r.steps) > 0 {
+		if i := stepAt(r.steps, res.start.Sub(r.start)); i >= 0 {
+			st := r.Steps[i]
+			st.Count++
+			if res.err != nil {
+				st.errors++
+			} else {
+				st.lh.add(res.duration.Seconds())
+			}
+		}
+	}
+	if res.entry > 0 {
+		r.addToEntry(res)
+	}
+	if res.path != "" {
+		r.addToPath(res)
+	}
+	if r.interval > 0 {
+		r.addToInterval(res)
+	}
+	if res.url != "" {
+		r.UrlDist[res.url]++
+	}
+	if r.countUserAgents && res.userAgent != "" {
+		r.UserAgentDist[res.userAgent]++
+	}
+	for _, reason := range res.retries {
+		r.Retries++
+		r.RetryErrors[reason]++
+	}
+	if res.compress > 0 {
+		r.compressTotal += res.compress
+		r.compressCount++
+	}
+	if res.signing > 0 {
+		r.signTotal += res.signing
+		r.signCount++
+	}
+	if res.family != "" {
+		r.Families[res.family]++
+	}
+	if res.localAddr != "" {
+		r.LocalAddrs[res.localAddr]++
+	}
+	if res.serverAddr != "" {
+		r.ServerAddrs[res.serverAddr]++
+	}
+	if res.tlsVersion != 0 {
+		r.TLSVersions[tls.VersionName(res.tlsVersion)]++
+		r.CipherSuites[tls.CipherSuiteName(res.cipherSuite)]++
+	}
+	if res.challenged {
+		r.DigestChallenges++
+	}
+	r.NewConns += res.dials
+	r.Redirects += res.redirects
+	if res.redirects > r.MaxRedirects {
+		r.MaxRedirects = res.redirects
+	}
+	if res.err != nil {
+		r.addError(res.err)
+	} else {
+		if r.lh != nil {
+			r.lh.add(res.duration.Seconds())
+		} else {
+			r.Lats = append(r.Lats, res.duration.Seconds())
+		}
+		if r.correct {
+			if r.correctedLh != nil {
+				r.correctedLh.add(res.corrected.Seconds())
+			} else {
+				r.correctedLats = append(r.correctedLats, res.corrected.Seconds())
+			}
+		}
+		r.latCount++
+		r.AvgTotal += res.duration.Seconds()
+		if r.metrics != nil {
+			r.addMetricsLatency(res.duration.Seconds())
+		}
+		r.addDeviation(res.duration.Seconds())
+		if !r.replayed {
+			r.stages.add(res.timings)
+			r.stages.addLatency(res.timings.reused, res.duration.Seconds())
+		}
+		r.StatusCodeDist[res.statusCode]++
+		r.addStatusLatency(res.statusCode, res.duration.Seconds())
+		r.ProtocolDist[res.proto]++
+		if res.setCookie {
+			r.SetCookies++
+		}
+		if res.contentLength > 0 {
+			r.SizeTotal += res.contentLength
+		}
+		r.SizeSent += res.sent
+		r.SizeSentRaw += res.rawSent
+		if res.truncated {
+			r.Truncated++
+		}
+		if res.continueTimeout {
+			r.ContinueTimeouts++
+		}
+		if res.assertFailed {
+			r.AssertFailures++
+			if r.AssertFailures == 1 {
+				r.AssertExample = res.snippet
+			}
+		}
+		if !r.isSuccess(res.statusCode) {
+			if len(r.expected) > 0 {
+				r.FailedStatus++
+			}
+		} else if !res.assertFailed {
+			r.successCnt++
+		}
+	}
+}
+
+// Returns true if the result counts as failed in the error rate.
+func (r *Report) isFailure(res *result) bool {
+	if res.err != nil {
+		return true
+	}
+	return r.non2xxErrors && (!r.isSuccess(res.statusCode) || res.assertFailed)
+}
+
+// Returns true if the status is expected, or is 2xx if no
+// status is expected.
+func (r *Report) isSuccess(code int) bool {
+	if len(r.expected) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range r.expected {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) setSteps(steps []Step) {
+	r.steps = steps
+	r.Steps = nil
+	for _, s := range steps {
+		r.Steps = append(r.Steps, &StepReport{Qps: s.Qps, Duration: s.Duration, lh: newLatencyHistogram()})
+	}
+}
+
+// Computes the summary of each step, only the steps with
+// results are kept.
+func (r *Report) finalizeSteps() {
+	var steps []*StepReport
+	var end time.Duration
+	for _, st := range r.Steps {
+		start := end
+		end += st.Duration
+		if st.Count == 0 {
+			continue
+		}
+		elapsed := st.Duration
+		if end > r.Total {
+			st.Partial = true
+			elapsed = r.Total - start
+		}
+		st.RPS = float64(st.Count-st.errors) / elapsed.Seconds()
+		st.P50 = st.lh.percentile(50)
+		st.P99 = st.lh.percentile(99)
+		st.ErrorRate = float64(st.errors) / float64(st.Count)
+		steps = append(steps, st)
+	}
+	r.Steps = steps
+}
+
+// Adds the result to the interval it completed in.
+func (r *Report) addToInterval(res *result) {
+	i := int(res.start.Add(res.duration).Sub(r.start) / r.interval)
+	if i < 0 {
+		i = 0
+	}
+	for len(r.TimeSeries) <= i {
+		r.TimeSeries = append(r.TimeSeries, &Interval{Start: time.Duration(len(r.TimeSeries)) * r.interval})
+	}
+	iv := r.TimeSeries[i]
+	iv.Count++
+	if res.err != nil {
+		iv.Errors++
+	} else {
+		iv.lats = append(iv.lats, res.duration.Seconds())
+	}
+}
+
+// Computes the rate and percentiles of each interval, the last one
+// may be cut short by the end of the run.
+func (r *Report) finalizeTimeSeries() {
+	for _, iv := range r.TimeSeries {
+		elapsed := r.interval
+		if end := iv.Start + r.interval; end > r.Total && r.Total > iv.Start {
+			elapsed = r.Total - iv.Start
+		}
+		iv.RPS = float64(iv.Count) / elapsed.Seconds()
+		sort.Float64s(iv.lats)
+		iv.P50 = percentile(iv.lats, 50)
+		iv.P99 = percentile(iv.lats, 99)
+		iv.lats = nil
+	}
+}
+
+// Counts the error in its category, keeping its message as sample
+// if it is the first one of the category.
+func (r *Report) addError(err error) {
+	c := classifyError(err)
+	if r.Errors[c] == 0 {
+		r.ErrorSamples[c] = err.Error()
+	}
+	r.Errors[c]++
+	if r.verboseErrors {
+		if r.RawErrors == nil {
+			r.RawErrors = make(map[string]int)
+		}
+		r.RawErrors[err.Error()]++
+	}
+}
+
+// Aggregates the latency into the statistics of the status code.
+func (r *Report) addStatusLatency(code int, lat float64) {
+	st := r.StatusCodeStats[code]
+	if st == nil {
+		st = &StatusStats{lh: newLatencyHistogram()}
+		r.StatusCodeStats[code] = st
+	}
+	st.lh.add(lat)
+	st.sum += lat
+}
+
+// Computes the statistics of each status code, and the sorted
+// distributions of the codes and classes.
+func (r *Report) finalizeStatusStats() {
+	for _, st := range r.StatusCodeStats {
+		st.Min = st.lh.min
+		st.Average = st.sum / float64(st.lh.count)
+		st.P95 = st.lh.percentile(95)
+	}
+	codes := make([]int, 0, len(r.StatusCodeDist))
+	for code := range r.StatusCodeDist {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	percent := func(n int) float64 {
+		return float64(n) / float64(r.latCount) * 100
+	}
+	r.StatusCodes, r.StatusClasses = nil, nil
+	for _, code := range codes {
+		n := r.StatusCodeDist[code]
+		r.StatusCodes = append(r.StatusCodes, StatusCount{code, n, percent(n)})
+		class := fmt.Sprintf("%dxx", code/100)
+		if last := len(r.StatusClasses) - 1; last >= 0 && r.StatusClasses[last].Class == class {
+			r.StatusClasses[last].Count += n
+			r.StatusClasses[last].Percent = percent(r.StatusClasses[last].Count)
+		} else {
+			r.StatusClasses = append(r.StatusClasses, ClassCount{class, n, percent(n)})
+		}
+	}
+}
+
+// Returns the number of failed requests, that got no response.
+func (r *Report) failedCount() int {
+	var n int
+	for _, c := range r.Errors {
+		n += c
+	}
+	return n
+}
+
+// AllFailed returns true if requests were made and none of them got a
+// response.
+func (r *Report) AllFailed() bool {
+	return r.latCount == 0 && len(r.Errors) > 0
+}
+
+// Updates the running variance with the latency of a new request.
+func (r *Report) addDeviation(lat float64) {
+	d := lat - r.mean
+	r.mean += d / float64(r.latCount)
+	r.m2 += d * (lat - r.mean)
+}
+
+// Returns true if the result is one of a warmup request.
+func (r *Report) isWarmup(res *result) bool {
+	return res.seq < r.warmupRequests || res.start.Sub(r.start) < r.warmup
+}
+
+// Waits for all the results to be collected, then computes the report.
+func (r *Report) finalize(total time.Duration) {
+	<-r.done
+	r.Total = total
+	// Rates are computed over the window following the warmup.
+	window := total
+	if r.Warmup > 0 && !r.firstStart.IsZero() {
+		window = r.start.Add(total).Sub(r.firstStart)
+	}
+	// The rates and averages stay zero rather than NaN, e.g. if every
+	// request failed, so that the JSON output is valid.
+	if secs := window.Seconds(); secs > 0 {
+		r.RPS = float64(r.latCount) / secs
+		r.SuccessRPS = float64(r.successCnt) / secs
+	}
+	if r.latCount > 0 {
+		r.Average = r.AvgTotal / float64(r.latCount)
+	}
+	failed := r.failedCount()
+	if secs := window.Seconds(); r.Think > 0 && r.workers > 0 && secs > 0 {
+		r.WorkerRPS = float64(failed+r.latCount) / float64(r.workers) / secs
+	}
+	if completed := failed + r.latCount; completed > 0 {
+		if r.non2xxErrors {
+			failed += r.latCount - r.successCnt
+		}
+		r.ErrorRate = float64(failed) / float64(completed)
+	}
+	if r.latCount > 0 {
+		r.Variance = r.m2 / float64(r.latCount)
+		r.StdDev = math.Sqrt(r.Variance)
+	}
+	if r.Rate > 0 && r.Total > 0 {
+		r.AchievedRate = float64(r.resCount) / r.Total.Seconds()
+	}
+	if r.signCount > 0 {
+		r.Signing = r.signTotal.Seconds() / float64(r.signCount)
+	}
+	if r.compressCount > 0 {
+		r.Compression = r.compressTotal.Seconds() / float64(r.compressCount)
+	}
+	r.finalizeSteps()
+	r.finalizeEntries()
+	r.finalizePaths()
+	r.finalizeTimeSeries()
+	r.finalizeStatusStats()
+	r.Breakdown = r.stages.finalize()
+	r.finalizeRequests()
+	r.summarize()
+}
+
+// Lists the requests of the "json" output, with latencies included.
+func (r *Report) finalizeRequests() {
+	if r.output != "json" || !r.includeLats {
+		return
+	}
+	sort.Sort(byStart(r.details))
+	r.Requests = make([]*RequestDetail, len(r.details))
+	for i, res := range r.details {
+		d := &RequestDetail{
+			Seq:           res.seq + 1,
+			Worker:        res.worker,
+			StartOffset:   res.start.Sub(r.start).Seconds(),
+			Duration:      res.duration.Seconds(),
+			StatusCode:    res.statusCode,
+			ContentLength: res.contentLength,
+			RequestID:     res.requestID,
+		}
+		if res.err != nil {
+			d.Error = res.err.Error()
+		}
+		r.Requests[i] = d
+	}
+}
+
+// Computes the statistics of the latencies and checks the SLA.
+func (r *Report) summarize() {
 	sort.Float64s(r.Lats)
 
-	if r.output == "csv" {
+	if r.latCount > 0 {
+		if r.lh != nil {
+			r.Fastest = r.lh.min
+			r.Slowest = r.lh.max
+		} else {
+			r.Fastest = r.Lats[0]
+			r.Slowest = r.Lats[len(r.Lats)-1]
+		}
+		r.Histogram = r.histogram()
+		r.LatencyDistribution = r.latencies(r.percentile)
+		if r.correct {
+			sort.Float64s(r.correctedLats)
+			r.CorrectedLatencyDistribution = r.latencies(r.correctedPercentile)
+		}
+	}
+	r.evaluateSLA()
+}
+
+// Print prints the report to its Writer, in its output type. Run prints
+// it once the run ends, RunContext and Replay leave it to the caller.
+func (r *Report) Print() {
+	switch r.output {
+	case "csv":
 		r.printCSV()
 		return
+	case "csv-detail":
+		r.printCSVDetail()
+		return
+	case "influx":
+		r.printInflux()
+		return
+	case "html":
+		r.printHTML()
+		return
+	case "md":
+		r.printMarkdown()
+		return
+	case "json":
+		r.printJSON()
+		return
+	}
+
+	if r.Resolution != nil && r.output != "quiet" {
+		r.printResolution()
 	}
 
-	if len(r.Lats) > 0 {
-		r.Fastest = r.Lats[0]
-		r.Slowest = r.Lats[len(r.Lats)-1]
+	if r.AllFailed() && r.output != "quiet" {
+		fmt.Fprintf(r.w, "\nSummary:\n")
+		fmt.Fprintf(r.w, "  Total:\t%4.4f secs.\n", r.Total.Seconds())
+		fmt.Fprintf(r.w, "  Error rate:\t%.2f%%\n", r.ErrorRate*100)
+		fmt.Fprintf(r.w, "  Succeeded:\t0 of %d requests.\n", r.failedCount())
+	}
+
+	if r.latCount > 0 {
 		if r.output != "quiet" {
-			fmt.Printf("\nSummary:\n")
-			fmt.Printf("  Total:\t%4.4f secs.\n", r.Total.Seconds())
-			fmt.Printf("  Slowest:\t%4.4f secs.\n", r.Slowest)
-			fmt.Printf("  Fastest:\t%4.4f secs.\n", r.Fastest)
-			fmt.Printf("  Average:\t%4.4f secs.\n", r.Average)
-			fmt.Printf("  Requests/sec:\t%4.4f\n", r.RPS)
+			fmt.Fprintf(r.w, "\nSummary:\n")
+			fmt.Fprintf(r.w, "  Total:\t%4.4f secs.\n", r.Total.Seconds())
+			fmt.Fprintf(r.w, "  Slowest:\t%4.4f secs.\n", r.Slowest)
+			fmt.Fprintf(r.w, "  Fastest:\t%4.4f secs.\n", r.Fastest)
+			fmt.Fprintf(r.w, "  Average:\t%4.4f secs.\n", r.Average)
+			fmt.Fprintf(r.w, "  Std deviation:\t%4.4f secs.\n", r.StdDev)
+			fmt.Fprintf(r.w, "  Requests/sec:\t%4.4f\n", r.RPS)
+			fmt.Fprintf(r.w, "  Error rate:\t%.2f%%\n", r.ErrorRate*100)
+			if len(r.expected) > 0 {
+				matches := float64(r.latCount-r.FailedStatus) / float64(r.latCount) * 100
+				fmt.Fprintf(r.w, "  Expected status matches:\t%.1f%%\n", matches)
+			}
+			if r.Breakdown != nil && (r.NewConns > 0 || r.Breakdown.ReuseRatio > 0) {
+				// Connections are not traced with a custom Transport.
+				fmt.Fprintf(r.w, "  Connections:\t%d established, %.2f%% requests on reused connections.\n", r.NewConns, r.Breakdown.ReuseRatio*100)
+			}
+			if r.SelfCPU > 0 && r.Total > 0 {
+				fmt.Fprintf(r.w, "  Self CPU:\t%4.4f secs user+system, %.0f%% of a core.\n", r.SelfCPU, r.SelfCPU/r.Total.Seconds()*100)
+			}
+			if r.Redirects > 0 {
+				fmt.Fprintf(r.w, "  Redirects:\t%d, at most %d per request.\n", r.Redirects, r.MaxRedirects)
+			}
+			if len(r.Families) > 1 || r.network != "" && len(r.Families) > 0 {
+				r.printFamilies()
+			}
+			if r.Signing > 0 {
+				fmt.Fprintf(r.w, "  Signing:\t%4.4f secs per request, not part of the latency.\n", r.Signing)
+			}
+			if r.DigestChallenges > 0 {
+				fmt.Fprintf(r.w, "  Digest challenges:\t%d, not part of the latency.\n", r.DigestChallenges)
+			}
+			if r.SetCookies > 0 {
+				fmt.Fprintf(r.w, "  Set-Cookie responses:\t%d.\n", r.SetCookies)
+			}
+			if r.Warmup > 0 {
+				fmt.Fprintf(r.w, "  Warmup:\t%d requests discarded.\n", r.Warmup)
+			}
+			if r.Rate > 0 {
+				fmt.Fprintf(r.w, "  Rate:\tintended %d req/s, achieved %4.4f req/s.\n", r.Rate, r.AchievedRate)
+				fmt.Fprintf(r.w, "  Peak in-flight:\t%d requests.\n", r.PeakInflight)
+				if r.Skipped > 0 {
+					fmt.Fprintf(r.w, "  Skipped:\t%d requests at the in-flight cap.\n", r.Skipped)
+				}
+			}
+			if r.Think > 0 {
+				fmt.Fprintf(r.w, "  Think time:\t%v, %4.4f req/s per worker.\n", r.Think, r.WorkerRPS)
+			}
+			if r.Ramp > 0 {
+				fmt.Fprintf(r.w, "  Ramp-up:\t%4.4f secs, %d requests.\n", r.Ramp.Seconds(), r.RampRequests)
+				if r.Total > r.Ramp {
+					// The run may stop before the ramp-up is over.
+					fmt.Fprintf(r.w, "  Steady state:\t%4.4f secs.\n", (r.Total - r.Ramp).Seconds())
+				}
+			}
 			if r.SizeTotal > 0 {
-				fmt.Printf("  Total Data Recieved:\t%d bytes.\n", r.SizeTotal)
-				fmt.Printf("  Response Size per Request:\t%d bytes.\n", r.SizeTotal/int64(len(r.Lats)))
+				fmt.Fprintf(r.w, "  Total Data Recieved:\t%d bytes.\n", r.SizeTotal)
+				fmt.Fprintf(r.w, "  Response Size per Request:\t%d bytes.\n", r.SizeTotal/int64(r.latCount))
+			}
+			if r.SizeSent > 0 {
+				fmt.Fprintf(r.w, "  Total Data Sent:\t%d bytes, %4.4f MB/s.\n", r.SizeSent, float64(r.SizeSent)/(1<<20)/r.Total.Seconds())
+			}
+			if r.SizeSentRaw > 0 {
+				fmt.Fprintf(r.w, "  Gzip body:\t%d bytes per request, %d bytes compressed.\n", r.SizeSentRaw/int64(r.latCount), r.SizeSent/int64(r.latCount))
+			}
+			if r.Compression > 0 {
+				fmt.Fprintf(r.w, "  Compression:\t%4.4f secs per request, not part of the latency.\n", r.Compression)
+			}
+			if r.saveDir != "" {
+				r.printSaved()
+			}
+			if r.LogSkipped > 0 {
+				fmt.Fprintf(r.w, "  Log lines skipped:\t%d, not parsed.\n", r.LogSkipped)
+			}
+			if r.Truncated > 0 {
+				fmt.Fprintf(r.w, "  Truncated responses:\t%d, bodies read up to %d bytes.\n", r.Truncated, r.maxBody)
+			}
+			if r.ContinueTimeouts > 0 {
+				fmt.Fprintf(r.w, "  Continue timeouts:\t%d, bodies sent without a 100 Continue.\n", r.ContinueTimeouts)
+			}
+			if len(r.Steps) > 0 {
+				r.printSteps()
+			}
+			if len(r.TimeSeries) > 0 {
+				r.printTimeSeries()
+			}
+			if len(r.Entries) > 0 {
+				r.printEntries()
+			}
+			if len(r.SlowestPaths) > 0 {
+				r.printSlowestPaths()
 			}
 			r.printStatusCodes()
+			if _, h1 := r.ProtocolDist["HTTP/1.1"]; len(r.ProtocolDist) > 1 || !h1 {
+				r.printProtocols()
+			}
+			if len(r.TLSVersions) > 0 {
+				r.printTLS()
+			}
+			if len(r.LocalAddrs) > 0 {
+				r.printLocalAddrs()
+			}
+			if len(r.ServerAddrs) > 0 {
+				r.printServerAddrs()
+			}
 			r.printHistogram()
 			r.printLatencies()
+			if r.Breakdown != nil {
+				r.printBreakdown()
+			}
 		}
 	}
 
+	if len(r.UrlDist) > 0 && r.output != "quiet" {
+		r.printUrls()
+	}
+
+	if len(r.UserAgentDist) > 0 && r.output != "quiet" {
+		r.printUserAgents()
+	}
+
 	if len(r.Errors) > 0 {
 		r.printErrors()
 	}
+
+	if r.AssertFailures > 0 {
+		r.printAssertFailures()
+	}
+
+	if r.Retries > 0 {
+		r.printRetries()
+	}
+
+	if len(r.SLA) > 0 {
+		r.printSLA()
+	}
+
+	if r.Interrupted {
+		if r.size > 0 {
+			fmt.Fprintf(r.w, "\nInterrupted after %d of %d requests.\n", r.resCount, r.size)
+		} else {
+			fmt.Fprintf(r.w, "\nInterrupted after %d requests.\n", r.resCount)
+		}
+	}
+	if r.DeadlineHit {
+		if r.size > 0 {
+			fmt.Fprintf(r.w, "\nDeadline of %v hit after %d of %d requests, %d in-flight requests cancelled.\n", r.maxDuration, r.resCount, r.size, r.Cancelled)
+		} else {
+			fmt.Fprintf(r.w, "\nDeadline of %v hit after %d requests, %d in-flight requests cancelled.\n", r.maxDuration, r.resCount, r.Cancelled)
+		}
+	}
+	if r.Aborted != nil {
+		fmt.Fprintf(r.w, "\nAborted: error threshold exceeded at t=%v, %s.\n", r.Aborted.At.Round(time.Millisecond), r.Aborted.Reason)
+	}
+	if r.DroppedResults > 0 {
+		fmt.Fprintf(r.w, "\n%d results dropped by the result callback, it did not keep up.\n", r.DroppedResults)
+	}
+
+	if r.FirstFailure != nil && r.output != "quiet" {
+		r.printFailure()
+	}
 }
 
 func (r *Report) printCSV() {
 	for i, val := range r.Lats {
-		fmt.Printf("%v,%4.4f\n", i+1, val)
+		fmt.Fprintf(r.w, "%v,%4.4f\n", i+1, val)
 	}
 }
 
-// Prints percentile latencies.
-func (r *Report) printLatencies() {
-	pctls := []int{10, 25, 50, 75, 90, 95, 99}
-	data := make([]float64, len(pctls))
-	j := 0
-	for i := 0; i < len(r.Lats) && j < len(pctls); i++ {
-		current := i * 100 / len(r.Lats)
-		if current >= pctls[j] {
-			data[j] = r.Lats[i]
-			j++
+// Prints a row per request, ordered by start time, including
+// failed requests. Start offsets are those of the monotonic clock of
+// the run, in seconds.
+func (r *Report) printCSVDetail() {
+	sort.Sort(byStart(r.details))
+	w := csv.NewWriter(r.w)
+	header := []string{"seq", "start_offset", "duration", "status_code", "content_length", "error", "worker"}
+	if r.requestIDs {
+		header = append(header, "request_id")
+	}
+	w.Write(header)
+	for _, res := range r.details {
+		var errStr string
+		if res.err != nil {
+			errStr = res.err.Error()
+		}
+		row := []string{
+			strconv.Itoa(res.seq + 1),
+			fmt.Sprintf("%4.4f", res.start.Sub(r.start).Seconds()),
+			fmt.Sprintf("%4.4f", res.duration.Seconds()),
+			strconv.Itoa(res.statusCode),
+			strconv.FormatInt(res.contentLength, 10),
+			errStr,
+			strconv.Itoa(res.worker),
+		}
+		if r.requestIDs {
+			row = append(row, res.requestID)
 		}
+		w.Write(row)
 	}
-	fmt.Printf("\nLatency distribution:\n")
-	for i := 0; i < len(pctls); i++ {
-		if data[i] > 0 {
-			fmt.Printf("  %v%% in %4.4f secs.\n", pctls[i], data[i])
+	w.Flush()
+}
+
+// Prints a line-protocol point per request, ordered by start time and
+// timestamped with it. Durations are in nanoseconds.
+func (r *Report) printInflux() {
+	sort.Sort(byStart(r.details))
+	m := influxMeasurementEscaper.Replace(r.measurement)
+	for _, res := range r.details {
+		u := res.url
+		if u == "" {
+			u = r.url
 		}
+		fmt.Fprint(r.w, m)
+		if u != "" {
+			// Tags with an empty value are invalid, the tag is left out.
+			fmt.Fprintf(r.w, ",url=%s", influxEscaper.Replace(u))
+		}
+		fmt.Fprintf(r.w, " duration=%di,status=%di,bytes=%di",
+			res.duration.Nanoseconds(), res.statusCode, res.contentLength)
+		if res.err != nil {
+			fmt.Fprintf(r.w, ",error=\"%s\"", influxFieldEscaper.Replace(res.err.Error()))
+		}
+		if res.requestID != "" {
+			fmt.Fprintf(r.w, ",request_id=\"%s\"", influxFieldEscaper.Replace(res.requestID))
+		}
+		fmt.Fprintf(r.w, " %d\n", res.start.UnixNano())
 	}
 }
 
-func (r *Report) printHistogram() {
-	bc := 10
-	buckets := make([]float64, bc+1)
-	counts := make([]int, bc+1)
+// Escape the measurement names of the line protocol, where an equal
+// sign is allowed.
+var influxMeasurementEscaper = strings.NewReplacer(",", "\\,", " ", "\\ ")
+
+// Escape the tag values of the line protocol.
+var influxEscaper = strings.NewReplacer(",", "\\,", " ", "\\ ", "=", "\\=")
+
+// Escape the string field values of the line protocol.
+var influxFieldEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+
+// RequestDetail is a request of the "json" output, as a row of the
+// "csv-detail" one. Its sequence number counts from 1 in the order the
+// requests were issued, as the IDs of -request-id-format seq do. Its
+// start is an offset from the start of the run and its duration, both
+// in seconds.
+type RequestDetail struct {
+	Seq           int     `json:"seq"`
+	Worker        int     `json:"worker"`
+	StartOffset   float64 `json:"start_offset"`
+	Duration      float64 `json:"duration"`
+	StatusCode    int     `json:"status_code"`
+	ContentLength int64   `json:"content_length"`
+	Error         string  `json:"error,omitempty"`
+	RequestID     string  `json:"request_id,omitempty"`
+}
+
+type byStart []*result
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byStart) Less(i, j int) bool { return s[i].start.Before(s[j].start) }
+
+// Prints the whole report as a single JSON document.
+func (r *Report) printJSON() {
+	if err := r.WriteJSON(r.w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// WriteJSON writes the report as the "json" output does, it can be read
+// back with ReadReport.
+func (r *Report) WriteJSON(w io.Writer) error {
+	rpt := *r
+	if !r.includeLats {
+		rpt.Lats = nil
+	}
+	b, err := json.MarshalIndent(&rpt, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// Computes percentile latencies, with the percentile function of the
+// latencies, corrected or not. Zero latencies are kept, e.g. those of
+// a replayed run with a coarse clock.
+func (r *Report) latencies(pct func(p float64) float64) []LatencyDistribution {
+	var res []LatencyDistribution
+	for _, p := range r.pctls {
+		res = append(res, LatencyDistribution{Percentage: p, Latency: pct(p)})
+	}
+	return res
+}
+
+// Returns the p-th percentile of the successful latencies.
+func (r *Report) percentile(p float64) float64 {
+	if r.lh != nil {
+		return r.lh.percentile(p)
+	}
+	return percentile(r.Lats, p)
+}
+
+// Returns the p-th percentile of the corrected latencies.
+func (r *Report) correctedPercentile(p float64) float64 {
+	if r.correctedLh != nil {
+		return r.correctedLh.percentile(p)
+	}
+	return percentile(r.correctedLats, p)
+}
+
+// Returns the p-th percentile of the sorted latencies using the
+// nearest-rank method. p may be fractional, e.g. 99.9.
+func percentile(lats []float64, p float64) float64 {
+	if len(lats) == 0 {
+		return 0
+	}
+	// Tolerate rounding errors, e.g. 99.9 / 100 * 1000 > 999.
+	rank := int(math.Ceil(p/100*float64(len(lats)) - 1e-9))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(lats) {
+		rank = len(lats)
+	}
+	return lats[rank-1]
+}
+
+// Prints percentile latencies, and the corrected ones if any.
+func (r *Report) printLatencies() {
+	if len(r.CorrectedLatencyDistribution) == 0 {
+		fmt.Fprintf(r.w, "\nLatency distribution:\n")
+	} else {
+		fmt.Fprintf(r.w, "\nLatency distribution, uncorrected (service time):\n")
+	}
+	for _, ld := range r.LatencyDistribution {
+		fmt.Fprintf(r.w, "  %v%% in %4.4f secs.\n", ld.Percentage, ld.Latency)
+	}
+	if len(r.CorrectedLatencyDistribution) > 0 {
+		fmt.Fprintf(r.w, "\nLatency distribution, corrected (from the intended start):\n")
+		for _, ld := range r.CorrectedLatencyDistribution {
+			fmt.Fprintf(r.w, "  %v%% in %4.4f secs.\n", ld.Percentage, ld.Latency)
+		}
+	}
+}
+
+// Computes the response time histogram buckets. If a bucket width
+// is set, the number of buckets is derived from the latency range.
+// Buckets on a log scale ignore the bucket width.
+func (r *Report) histogram() []Bucket {
+	if r.Slowest-r.Fastest <= r.Slowest*1e-9 {
+		// All the latencies are the same, or about, there is no range
+		// to split into buckets.
+		return r.countBuckets([]float64{r.Slowest})
+	}
+	if r.histScale == "log" && r.Fastest > 0 {
+		return r.logHistogram()
+	}
+	bc := r.buckets
 	bs := (r.Slowest - r.Fastest) / float64(bc)
+	if w := r.bucketWidth.Seconds(); w > 0 {
+		bc = int(math.Ceil((r.Slowest - r.Fastest) / w))
+		if bc < 1 {
+			bc = 1
+		}
+		bs = w
+		if bc > maxBuckets {
+			bc = maxBuckets
+			bs = (r.Slowest - r.Fastest) / float64(bc)
+		}
+	}
+	buckets := make([]float64, bc+1)
 	for i := 0; i < bc; i++ {
 		buckets[i] = r.Fastest + bs*float64(i)
 	}
+	buckets[bc] = math.Max(r.Fastest+bs*float64(bc), r.Slowest)
+	return r.countBuckets(buckets)
+}
+
+// Computes histogram buckets on a log scale, between the fastest and
+// slowest latencies.
+func (r *Report) logHistogram() []Bucket {
+	bc := r.buckets
+	factor := math.Pow(r.Slowest/r.Fastest, 1/float64(bc))
+	buckets := make([]float64, bc+1)
+	for i := 0; i < bc; i++ {
+		buckets[i] = r.Fastest * math.Pow(factor, float64(i))
+	}
 	buckets[bc] = r.Slowest
+	return r.countBuckets(buckets)
+}
+
+// Counts the latencies of each bucket, up to its mark.
+func (r *Report) countBuckets(buckets []float64) []Bucket {
+	counts := make([]int, len(buckets))
 	var bi int
-	var max int
+	if r.lh != nil {
+		r.lh.each(func(v float64, n int) {
+			for v > buckets[bi] && bi < len(buckets)-1 {
+				bi++
+			}
+			counts[bi] += n
+		})
+	}
 	for i := 0; i < len(r.Lats); {
 		if r.Lats[i] <= buckets[bi] {
 			i++
 			counts[bi]++
-			if max < counts[bi] {
-				max = counts[bi]
-			}
 		} else if bi < len(buckets)-1 {
 			bi++
 		}
 	}
-	fmt.Printf("\nResponse time histogram:\n")
+	res := make([]Bucket, len(buckets))
 	for i := 0; i < len(buckets); i++ {
+		res[i] = Bucket{Mark: buckets[i], Count: counts[i]}
+	}
+	return res
+}
+
+func (r *Report) printHistogram() {
+	fmt.Fprintf(r.w, "\nResponse time histogram:\n")
+	r.printHistogramBars()
+}
+
+func (r *Report) printHistogramBars() {
+	var max int
+	for _, b := range r.Histogram {
+		if max < b.Count {
+			max = b.Count
+		}
+	}
+	for _, b := range r.Histogram {
 		// Normalize bar lengths.
 		var barLen int
 		if max > 0 {
-			barLen = counts[i] * 40 / max
+			barLen = b.Count * 40 / max
+		}
+		if r.histScale == "log" {
+			fmt.Fprintf(r.w, "  %9s [%v]\t|%v\n", formatLatency(b.Mark), b.Count, strings.Repeat(barChar, barLen))
+		} else {
+			fmt.Fprintf(r.w, "  %4.3f [%v]\t|%v\n", b.Mark, b.Count, strings.Repeat(barChar, barLen))
 		}
-		fmt.Printf("  %4.3f [%v]\t|%v\n", buckets[i], counts[i], strings.Repeat(barChar, barLen))
 	}
 }
 
+// Formats a latency in seconds, in milliseconds if it is shorter than a
+// second.
+func formatLatency(secs float64) string {
+	if secs < 1 {
+		return fmt.Sprintf("%.3fms", secs*1000)
+	}
+	return fmt.Sprintf("%.3fs", secs)
+}
+
 // Prints status code distribution.
 func (r *Report) printStatusCodes() {
-	fmt.Printf("\nStatus code distribution:\n")
-	for code, num := range r.StatusCodeDist {
-		fmt.Printf("  [%d]\t%d responses\n", code, num)
+	fmt.Fprintf(r.w, "\nStatus code distribution:\n")
+	for _, sc := range r.StatusCodes {
+		st := r.StatusCodeStats[sc.Code]
+		fmt.Fprintf(r.w, "  [%d]\t%d responses (%.2f%%), min %4.4f secs, avg %4.4f secs, p95 %4.4f secs\n",
+			sc.Code, sc.Count, sc.Percent, st.Min, st.Average, st.P95)
+	}
+	fmt.Fprintln(r.w)
+	for _, sc := range r.StatusClasses {
+		fmt.Fprintf(r.w, "  [%s]\t%d responses (%.2f%%)\n", sc.Class, sc.Count, sc.Percent)
+	}
+}
+
+// Prints the summary of each step.
+func (r *Report) printSteps() {
+	fmt.Fprintf(r.w, "\nSteps:\n")
+	for i, st := range r.Steps {
+		var partial string
+		if st.Partial {
+			partial = " (partial)"
+		}
+		fmt.Fprintf(r.w, "  [%d] %d qps for %4.4f secs%s:\t%d requests, %4.4f req/s, p50 %4.4f secs, p99 %4.4f secs, %4.2f%% errors\n",
+			i+1, st.Qps, st.Duration.Seconds(), partial, st.Count, st.RPS, st.P50, st.P99, st.ErrorRate*100)
+	}
+}
+
+// Prints the statistics of the first intervals.
+func (r *Report) printTimeSeries() {
+	fmt.Fprintf(r.w, "\nTime series:\n")
+	for i, iv := range r.TimeSeries {
+		if i == maxPrintedIntervals {
+			fmt.Fprintf(r.w, "  ... %d more intervals, see the JSON output.\n", len(r.TimeSeries)-i)
+			break
+		}
+		fmt.Fprintf(r.w, "  [%4.1f secs]\t%d requests, %4.4f req/s, %d errors, p50 %4.4f secs, p99 %4.4f secs\n",
+			iv.Start.Seconds(), iv.Count, iv.RPS, iv.Errors, iv.P50, iv.P99)
+	}
+}
+
+// Prints protocol distribution.
+func (r *Report) printProtocols() {
+	fmt.Fprintf(r.w, "\nProtocol distribution:\n")
+	protos := make([]string, 0, len(r.ProtocolDist))
+	for proto := range r.ProtocolDist {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+	for _, proto := range protos {
+		fmt.Fprintf(r.w, "  [%s]\t%d responses\n", proto, r.ProtocolDist[proto])
+	}
+}
+
+// Prints the number of connections per address family, on a single line.
+func (r *Report) printFamilies() {
+	var families []string
+	for _, f := range []string{"IPv4", "IPv6"} {
+		if n := r.Families[f]; n > 0 {
+			families = append(families, fmt.Sprintf("%s %d", f, n))
+		}
+	}
+	fmt.Fprintf(r.w, "  Connections per family:\t%s.\n", strings.Join(families, ", "))
+}
+
+// Prints the number of connections per local address.
+func (r *Report) printLocalAddrs() {
+	fmt.Fprintf(r.w, "\nLocal addresses:\n")
+	addrs := make([]string, 0, len(r.LocalAddrs))
+	for addr := range r.LocalAddrs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		fmt.Fprintf(r.w, "  [%s]\t%d connections\n", addr, r.LocalAddrs[addr])
+	}
+}
+
+// Prints the number of responses saved, how many were dropped and why
+// saving failed if it did.
+func (r *Report) printSaved() {
+	fmt.Fprintf(r.w, "  Saved responses:\t%d in %s", r.Saved, r.saveDir)
+	if r.SaveDropped > 0 {
+		fmt.Fprintf(r.w, ", %d dropped", r.SaveDropped)
+	}
+	if r.saveErr != nil {
+		fmt.Fprintf(r.w, ", %v", r.saveErr)
+	}
+	fmt.Fprintln(r.w, ".")
+}
+
+// Prints the addresses the host resolved to at startup.
+func (r *Report) printResolution() {
+	res := r.Resolution
+	if len(res.Addrs) > 1 {
+		fmt.Fprintf(r.w, "\nResolved %s to %s, connecting to %s.\n", res.Host, strings.Join(res.Addrs, ", "), res.Addr)
+	} else {
+		fmt.Fprintf(r.w, "\nResolved %s to %s.\n", res.Host, res.Addr)
+	}
+}
+
+// Prints the number of connections per server address.
+func (r *Report) printServerAddrs() {
+	fmt.Fprintf(r.w, "\nServer addresses:\n")
+	addrs := make([]string, 0, len(r.ServerAddrs))
+	for addr := range r.ServerAddrs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		fmt.Fprintf(r.w, "  [%s]\t%d connections\n", addr, r.ServerAddrs[addr])
+	}
+}
+
+// Prints the number of handshakes per TLS version and cipher suite.
+func (r *Report) printTLS() {
+	fmt.Fprintf(r.w, "\nTLS handshakes:\n")
+	for _, dist := range []map[string]int{r.TLSVersions, r.CipherSuites} {
+		names := make([]string, 0, len(dist))
+		for name := range dist {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(r.w, "  [%s]\t%d connections\n", name, dist[name])
+		}
+	}
+}
+
+// Sets the intended share of the requests of each URL, from their
+// weights if any. A URL listed more than once gets the sum of its shares.
+func (r *Report) setUrlWeights(urls []string, weights []float64) {
+	if len(weights) == 0 {
+		return
+	}
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	r.UrlWeights = make(map[string]float64)
+	for i, u := range urls {
+		r.UrlWeights[u] += weights[i] / sum
 	}
 }
 
+// Prints the number of requests per URL, and their share of the
+// requests along with the intended one if the URLs are weighted.
+func (r *Report) printUrls() {
+	urls := make([]string, 0, len(r.UrlDist))
+	for u := range r.UrlDist {
+		urls = append(urls, u)
+	}
+	for u := range r.UrlWeights {
+		if _, ok := r.UrlDist[u]; !ok {
+			urls = append(urls, u)
+		}
+	}
+	sort.Strings(urls)
+	var total int
+	for _, n := range r.UrlDist {
+		total += n
+	}
+	fmt.Fprintf(r.w, "\nURL distribution:\n")
+	for _, u := range urls {
+		if r.UrlWeights == nil {
+			fmt.Fprintf(r.w, "  [%d]\t%s\n", r.UrlDist[u], u)
+			continue
+		}
+		fmt.Fprintf(r.w, "  [%d]\t%s\t%4.2f%% of the requests, %4.2f%% intended\n",
+			r.UrlDist[u], u, float64(r.UrlDist[u])/float64(total)*100, r.UrlWeights[u]*100)
+	}
+}
+
+// Prints the number of requests per User-Agent.
+func (r *Report) printUserAgents() {
+	agents := make([]string, 0, len(r.UserAgentDist))
+	for ua := range r.UserAgentDist {
+		agents = append(agents, ua)
+	}
+	sort.Strings(agents)
+	fmt.Fprintf(r.w, "\nUser-Agent distribution:\n")
+	for _, ua := range agents {
+		fmt.Fprintf(r.w, "  [%d]\t%s\n", r.UserAgentDist[ua], ua)
+	}
+}
+
+func (r *Report) printAssertFailures() {
+	fmt.Fprintf(r.w, "\nBody assertion failures:\n")
+	fmt.Fprintf(r.w, "  [%d]\t%q\n", r.AssertFailures, r.AssertExample)
+}
+
+func (r *Report) printRetries() {
+	fmt.Fprintf(r.w, "\nRetries:\t%d\n", r.Retries)
+	reasons := make([]string, 0, len(r.RetryErrors))
+	for reason := range r.RetryErrors {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(r.w, "  [%d]\t%s\n", r.RetryErrors[reason], reason)
+	}
+}
+
+// Prints the number of errors per category, with a sample message, and
+// per message if requested.
 func (r *Report) printErrors() {
-	fmt.Printf("\nError distribution:\n")
-	for error, num := range r.Errors {
-		fmt.Printf("  [%d]\t%s\n", num, error)
+	fmt.Fprintf(r.w, "\nError distribution:\n")
+	for _, c := range errorCategories {
+		if num := r.Errors[c]; num > 0 {
+			fmt.Fprintf(r.w, "  [%d]\t%s, e.g. %s\n", num, categoryName(c), r.ErrorSamples[c])
+		}
+	}
+	if len(r.RawErrors) > 0 {
+		fmt.Fprintf(r.w, "\nRaw error distribution:\n")
+		msgs := make([]string, 0, len(r.RawErrors))
+		for msg := range r.RawErrors {
+			msgs = append(msgs, msg)
+		}
+		sort.Strings(msgs)
+		for _, msg := range msgs {
+			fmt.Fprintf(r.w, "  [%d]\t%s\n", r.RawErrors[msg], msg)
+		}
 	}
 }
@@ -0,0 +1,842 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// Compares the output with the golden file, or updates it.
+func checkGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected the output of %v:\n%s\n%s is found", path, want, got)
+	}
+}
+
+func newTestReport(output string, includeLats bool, results ...*result) (*Report, *bytes.Buffer) {
+	var buf bytes.Buffer
+	ch := make(chan *result, len(results))
+	for _, res := range results {
+		ch <- res
+	}
+	close(ch)
+	rpt := newReport(len(results), ch, output, &buf)
+	rpt.includeLats = includeLats
+	return rpt, &buf
+}
+
+// Collects the results and prints the report, as a run does.
+func finalizeReport(rpt *Report, total time.Duration) {
+	go rpt.collect()
+	rpt.finalize(total)
+	rpt.Print()
+}
+
+func TestPrintJSON(t *testing.T) {
+	rpt, buf := newTestReport("json", false,
+		&result{statusCode: 200, duration: 100 * time.Millisecond, contentLength: 10},
+		&result{statusCode: 404, duration: 300 * time.Millisecond, contentLength: 10},
+		&result{err: errors.New("boom")},
+	)
+	finalizeReport(rpt, time.Second)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is expected to be valid JSON, %v", err)
+	}
+	for _, k := range []string{"fastest", "slowest", "average", "rps", "success_rps", "total_ns",
+		"status_code_dist", "latency_distribution", "histogram", "errors", "size_total"} {
+		if _, ok := got[k]; !ok {
+			t.Errorf("Key %v is expected in the JSON output", k)
+		}
+	}
+	if _, ok := got["lats"]; ok {
+		t.Errorf("Key lats is not expected in the JSON output")
+	}
+	if v := got["size_total"].(float64); v != 20 {
+		t.Errorf("Expected size_total to be 20, %v is found", v)
+	}
+}
+
+func TestPrintJSONIncludeLats(t *testing.T) {
+	rpt, buf := newTestReport("json", true,
+		&result{statusCode: 200, duration: 100 * time.Millisecond},
+		&result{statusCode: 200, duration: 200 * time.Millisecond},
+	)
+	finalizeReport(rpt, time.Second)
+
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is expected to be valid JSON, %v", err)
+	}
+	if len(got.Lats) != 2 {
+		t.Errorf("Expected 2 latencies, %v is found", len(got.Lats))
+	}
+}
+
+func TestPrintRampNotOver(t *testing.T) {
+	rpt, buf := newTestReport("", false,
+		&result{statusCode: 200, duration: 100 * time.Millisecond},
+	)
+	rpt.Ramp = 2 * time.Second
+	finalizeReport(rpt, time.Second)
+	if out := buf.String(); !strings.Contains(out, "Ramp-up:") || strings.Contains(out, "Steady state:") {
+		t.Errorf("Expected no steady state before the end of the ramp, %q is found", out)
+	}
+}
+
+func TestPrintJSONRequests(t *testing.T) {
+	start := time.Now()
+	rpt, buf := newTestReport("json", true,
+		&result{seq: 0, statusCode: 200, start: start.Add(1500 * time.Millisecond), duration: time.Second, contentLength: 5, worker: 2},
+		&result{seq: 2, err: errors.New("dial error"), start: start.Add(500 * time.Millisecond), duration: 2 * time.Second, contentLength: -1, worker: 1},
+		&result{seq: 1, statusCode: 404, start: start, duration: 3 * time.Second, worker: 0},
+	)
+	rpt.start = start
+	finalizeReport(rpt, 4*time.Second)
+
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is expected to be valid JSON, %v", err)
+	}
+	want := []RequestDetail{
+		{Seq: 2, Worker: 0, StartOffset: 0, Duration: 3, StatusCode: 404},
+		{Seq: 3, Worker: 1, StartOffset: 0.5, Duration: 2, ContentLength: -1, Error: "dial error"},
+		{Seq: 1, Worker: 2, StartOffset: 1.5, Duration: 1, StatusCode: 200, ContentLength: 5},
+	}
+	if len(got.Requests) != len(want) {
+		t.Fatalf("Expected %v requests, %v are found", len(want), len(got.Requests))
+	}
+	for i, d := range got.Requests {
+		if *d != want[i] {
+			t.Errorf("Expected request %d to be %+v, %+v is found", i, want[i], d)
+		}
+	}
+
+	rpt, buf = newTestReport("json", false, &result{statusCode: 200, start: start, duration: time.Second})
+	finalizeReport(rpt, time.Second)
+	if strings.Contains(buf.String(), `"requests"`) {
+		t.Errorf("Expected no requests without the latencies, %s is found", buf)
+	}
+}
+
+func TestPrintCSVDetail(t *testing.T) {
+	start := time.Now()
+	rpt, buf := newTestReport("csv-detail", false,
+		&result{seq: 0, statusCode: 200, start: start.Add(time.Second), duration: time.Second, contentLength: 5},
+		&result{seq: 1, err: errors.New("dial error"), start: start, duration: 2 * time.Second, contentLength: -1, worker: 1},
+	)
+	rpt.start = start
+	finalizeReport(rpt, 3*time.Second)
+
+	want := "seq,start_offset,duration,status_code,content_length,error,worker\n" +
+		"2,0.0000,2.0000,0,-1,dial error,1\n" +
+		"1,1.0000,1.0000,200,5,,0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Unexpected CSV output:\n%v", got)
+	}
+	if strings.Contains(buf.String(), "Summary") {
+		t.Errorf("Summary is not expected in the CSV output")
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var results []*result
+	for i := 1; i <= 1000; i++ {
+		results = append(results, &result{statusCode: 200, duration: time.Duration(i) * time.Millisecond})
+	}
+	rpt, buf := newTestReport("", false, results...)
+	rpt.pctls = []float64{50, 99.9}
+	finalizeReport(rpt, time.Second)
+
+	want := []LatencyDistribution{{50, 0.5}, {99.9, 0.999}}
+	if len(rpt.LatencyDistribution) != len(want) {
+		t.Fatalf("Expected %v percentiles, %v is found", len(want), len(rpt.LatencyDistribution))
+	}
+	for i, ld := range rpt.LatencyDistribution {
+		if ld != want[i] {
+			t.Errorf("Expected percentile %v, %v is found", want[i], ld)
+		}
+	}
+	if !strings.Contains(buf.String(), "99.9% in 0.9990 secs.") {
+		t.Errorf("Expected the 99.9th percentile to be printed")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		lats []float64
+		p    float64
+		want float64
+	}{
+		{nil, 50, 0},
+		{[]float64{0.5}, 1, 0.5},
+		{[]float64{0.5}, 50, 0.5},
+		{[]float64{0.5}, 100, 0.5},
+		{[]float64{0, 0, 1}, 50, 0},
+		{[]float64{0, 0, 1}, 99, 1},
+		{[]float64{1, 2}, 50, 1},
+		{[]float64{1, 2}, 50.1, 2},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 10, 1},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 11, 2},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 90, 9},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 99, 10},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 99.9, 10},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.lats, tt.p); got != tt.want {
+			t.Errorf("Expected the %vth percentile of %v to be %v, %v is found", tt.p, tt.lats, tt.want, got)
+		}
+	}
+}
+
+func TestPercentiles_SmallSample(t *testing.T) {
+	var results []*result
+	for i := 0; i < 10; i++ {
+		// A coarse clock, the fastest requests took no time.
+		results = append(results, &result{statusCode: 200, duration: time.Duration(i) * 10 * time.Millisecond})
+	}
+	rpt, buf := newTestReport("", false, results...)
+	p99 := 80 * time.Millisecond
+	rpt.sla = &SLA{P99: &p99}
+	finalizeReport(rpt, time.Second)
+
+	want := []LatencyDistribution{{10, 0}, {25, 0.02}, {50, 0.04}, {75, 0.07}, {90, 0.08}, {95, 0.09}, {99, 0.09}}
+	if len(rpt.LatencyDistribution) != len(want) {
+		t.Fatalf("Expected %v percentiles, %v is found", want, rpt.LatencyDistribution)
+	}
+	for i, ld := range rpt.LatencyDistribution {
+		if ld != want[i] {
+			t.Errorf("Expected percentile %v, %v is found", want[i], ld)
+		}
+	}
+	if !strings.Contains(buf.String(), "10% in 0.0000 secs.") {
+		t.Errorf("Expected the zero 10th percentile to be printed, %q is found", buf.String())
+	}
+	// The SLA checks the 99th percentile of the distribution.
+	if c := rpt.SLA[0]; c.Value != 0.09 || c.Pass {
+		t.Errorf("Expected the p99 SLA to fail at 0.09, %+v is found", c)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	var results []*result
+	for i := 1; i <= 100; i++ {
+		results = append(results, &result{statusCode: 200, duration: time.Duration(i) * time.Millisecond})
+	}
+	rpt, _ := newTestReport("quiet", false, results...)
+	rpt.buckets = 40
+	finalizeReport(rpt, time.Second)
+	if len(rpt.Histogram) != 41 {
+		t.Errorf("Expected 41 bucket marks, %v is found", len(rpt.Histogram))
+	}
+
+	rpt, _ = newTestReport("quiet", false, results...)
+	rpt.bucketWidth = 5 * time.Millisecond
+	finalizeReport(rpt, time.Second)
+	// (100ms - 1ms) / 5ms rounded up.
+	if len(rpt.Histogram) != 21 {
+		t.Errorf("Expected 21 bucket marks, %v is found", len(rpt.Histogram))
+	}
+	var total int
+	for _, b := range rpt.Histogram {
+		total += b.Count
+	}
+	if total != 100 {
+		t.Errorf("Expected histogram to count 100 latencies, %v is found", total)
+	}
+}
+
+func TestHistogramSameLatencies(t *testing.T) {
+	var results []*result
+	for i := 0; i < 50; i++ {
+		results = append(results, &result{statusCode: 200, duration: 2 * time.Millisecond})
+	}
+	for _, scale := range []string{"", "log"} {
+		rpt, _ := newTestReport("quiet", false, results...)
+		rpt.histScale = scale
+		finalizeReport(rpt, time.Second)
+		if len(rpt.Histogram) != 1 || rpt.Histogram[0].Count != 50 || rpt.Histogram[0].Mark != 0.002 {
+			t.Errorf("Expected a single bucket of 50 latencies, %v is found", rpt.Histogram)
+		}
+	}
+
+	// Fewer latencies than buckets, the buckets are kept.
+	rpt, _ := newTestReport("quiet", false,
+		&result{statusCode: 200, duration: time.Millisecond},
+		&result{statusCode: 200, duration: 3 * time.Millisecond},
+	)
+	finalizeReport(rpt, time.Second)
+	if len(rpt.Histogram) != rpt.buckets+1 {
+		t.Errorf("Expected %v buckets, %v is found", rpt.buckets+1, rpt.Histogram)
+	}
+}
+
+func TestHistogramCounts(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		var results []*result
+		n := 1 + rng.Intn(300)
+		for j := 0; j < n; j++ {
+			// Some identical latencies, others over several decades.
+			d := time.Duration(math.Pow(10, rng.Float64()*4*float64(rng.Intn(2)))) * time.Millisecond
+			results = append(results, &result{statusCode: 200, duration: d})
+		}
+		rpt, _ := newTestReport("quiet", false, results...)
+		rpt.buckets = 1 + rng.Intn(maxBuckets)
+		switch rng.Intn(4) {
+		case 0:
+			rpt.histScale = "log"
+		case 1:
+			rpt.bucketWidth = time.Duration(1+rng.Intn(1000)) * time.Millisecond
+		case 2:
+			rpt.lh = newLatencyHistogram()
+		}
+		finalizeReport(rpt, time.Second)
+		var total int
+		for _, b := range rpt.Histogram {
+			total += b.Count
+		}
+		if total != n || len(rpt.Histogram) > maxBuckets+1 {
+			t.Fatalf("Expected %v buckets at most counting %v latencies, %v is found", maxBuckets+1, n, rpt.Histogram)
+		}
+	}
+}
+
+func TestHistogramLogScale(t *testing.T) {
+	// A latency per decade from 1ms to 10s, and a few more at 1ms.
+	var results []*result
+	for _, d := range []time.Duration{1, 1, 1, 10, 100, 1000, 10000} {
+		results = append(results, &result{statusCode: 200, duration: d * time.Millisecond})
+	}
+	rpt, buf := newTestReport("", false, results...)
+	rpt.buckets = 4
+	rpt.histScale = "log"
+	finalizeReport(rpt, 20*time.Second)
+
+	want := []Bucket{{0.001, 3}, {0.01, 1}, {0.1, 1}, {1, 1}, {10, 1}}
+	if len(rpt.Histogram) != len(want) {
+		t.Fatalf("Expected %v bucket marks, %v is found", len(want), rpt.Histogram)
+	}
+	for i, b := range rpt.Histogram {
+		if math.Abs(b.Mark-want[i].Mark) > want[i].Mark*1e-9 || b.Count != want[i].Count {
+			t.Errorf("Expected bucket %v, %v is found", want[i], b)
+		}
+	}
+	for _, s := range []string{"    1.000ms [3]\t|", "  100.000ms [1]\t|", "     1.000s [1]\t|", "    10.000s [1]\t|"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected %q in the histogram, %q is found", s, buf.String())
+		}
+	}
+}
+
+func TestStreamStats(t *testing.T) {
+	var results []*result
+	for i := 1; i <= 1000; i++ {
+		results = append(results, &result{statusCode: 200, duration: time.Duration(i) * time.Millisecond})
+	}
+	rpt, _ := newTestReport("quiet", false, results...)
+	rpt.lh = newLatencyHistogram()
+	finalizeReport(rpt, time.Second)
+
+	if len(rpt.Lats) != 0 {
+		t.Errorf("Latencies are not expected to be kept, %v are found", len(rpt.Lats))
+	}
+	if rpt.Fastest != 0.001 || rpt.Slowest != 1 {
+		t.Errorf("Expected fastest and slowest to be 0.001 and 1, %v and %v are found", rpt.Fastest, rpt.Slowest)
+	}
+	var total int
+	for _, b := range rpt.Histogram {
+		total += b.Count
+	}
+	if total != 1000 {
+		t.Errorf("Expected histogram to count 1000 latencies, %v is found", total)
+	}
+	for _, ld := range rpt.LatencyDistribution {
+		want := ld.Percentage / 100
+		if d := ld.Latency - want; d > want*0.005 || d < -want*0.005 {
+			t.Errorf("Expected p%v to be close to %v, %v is found", ld.Percentage, want, ld.Latency)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(3, time.Hour, &buf)
+	p.Start()
+	p.increment(nil)
+	p.increment(errors.New("boom"))
+	p.Finish()
+	if got := buf.String(); !strings.HasPrefix(got, "\r2 / 3 requests,") || !strings.HasSuffix(got, ", 1 errors\n") {
+		t.Errorf("Unexpected progress line %q", got)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	start := time.Now()
+	results := []*result{
+		{seq: 0, statusCode: 500, start: start, duration: time.Second, contentLength: 10},
+		{seq: 1, statusCode: 200, start: start.Add(time.Second), duration: time.Second, contentLength: 10},
+		{seq: 2, err: errors.New("boom"), start: start.Add(2 * time.Second), duration: time.Second},
+		{seq: 3, statusCode: 200, start: start.Add(3 * time.Second), duration: time.Second, contentLength: 10},
+	}
+	rpt, buf := newTestReport("", false, results...)
+	rpt.start = start
+	rpt.warmupRequests = 1
+	rpt.warmup = 2500 * time.Millisecond
+	finalizeReport(rpt, 4*time.Second)
+
+	if rpt.Warmup != 3 {
+		t.Errorf("Expected 3 warmup requests, found %v", rpt.Warmup)
+	}
+	if len(rpt.Lats) != 1 || len(rpt.Errors) != 0 || rpt.SizeTotal != 10 || rpt.StatusCodeDist[500] != 0 {
+		t.Errorf("Warmup results are not expected in the report")
+	}
+	if rpt.RPS != 1 {
+		t.Errorf("Expected 1 request/sec after the warmup, found %v", rpt.RPS)
+	}
+	if !strings.Contains(buf.String(), "Warmup:\t3 requests discarded.") {
+		t.Errorf("Expected the warmup requests to be printed")
+	}
+}
+
+func TestSteps(t *testing.T) {
+	start := time.Now()
+	var results []*result
+	for i := 0; i < 10; i++ {
+		results = append(results, &result{statusCode: 200, start: start.Add(time.Duration(i) * 100 * time.Millisecond), duration: 10 * time.Millisecond})
+	}
+	for i := 0; i < 10; i++ {
+		results = append(results, &result{statusCode: 200, start: start.Add(time.Second + time.Duration(i)*50*time.Millisecond), duration: 20 * time.Millisecond})
+	}
+	results = append(results, &result{err: errors.New("boom"), start: start.Add(1900 * time.Millisecond)})
+	rpt, buf := newTestReport("", false, results...)
+	rpt.start = start
+	rpt.setSteps([]Step{{10, time.Second}, {20, time.Second}, {40, time.Second}})
+	finalizeReport(rpt, 2*time.Second)
+
+	if len(rpt.Steps) != 2 {
+		t.Fatalf("Expected 2 steps with results, %v are found", len(rpt.Steps))
+	}
+	if st := rpt.Steps[0]; st.Count != 10 || st.RPS != 10 || st.ErrorRate != 0 || st.Partial {
+		t.Errorf("Unexpected first step %+v", st)
+	}
+	if st := rpt.Steps[1]; st.Count != 11 || st.RPS != 10 || st.ErrorRate != 1.0/11 {
+		t.Errorf("Unexpected second step %+v", st)
+	}
+	if st := rpt.Steps[1]; st.P50 < 0.0199 || st.P50 > 0.0201 {
+		t.Errorf("Expected p50 of the second step to be 0.02, %v is found", st.P50)
+	}
+	if !strings.Contains(buf.String(), "[2] 20 qps for 1.0000 secs:\t11 requests") {
+		t.Errorf("Expected the steps to be printed")
+	}
+}
+
+func TestExpectedStatus(t *testing.T) {
+	results := []*result{{statusCode: 201, duration: time.Millisecond}}
+	for i := 0; i < 3; i++ {
+		results = append(results, &result{statusCode: 200, duration: time.Millisecond})
+	}
+	rpt, buf := newTestReport("", false, results...)
+	rpt.expected = []int{200, 204}
+	finalizeReport(rpt, time.Second)
+
+	if rpt.FailedStatus != 1 {
+		t.Errorf("Expected 1 failed status, %v is found", rpt.FailedStatus)
+	}
+	if rpt.SuccessRPS != 3 {
+		t.Errorf("Expected a success RPS of 3, %v is found", rpt.SuccessRPS)
+	}
+	if rpt.StatusCodeDist[201] != 1 {
+		t.Errorf("Expected the 201 response in the distribution, %v is found", rpt.StatusCodeDist)
+	}
+	if !strings.Contains(buf.String(), "Expected status matches:\t75.0%") {
+		t.Errorf("Expected the status matches in the summary, %q is found", buf.String())
+	}
+}
+
+func TestPrintInflux(t *testing.T) {
+	start := time.Unix(1400000000, 5)
+	rpt, buf := newTestReport("influx", false,
+		&result{statusCode: 200, url: "http://a.com/x?a=1,b=2", start: start.Add(time.Millisecond), duration: 2 * time.Millisecond, contentLength: 10},
+		&result{err: errors.New(`read "x": reset`), start: start, duration: time.Millisecond, contentLength: -1},
+	)
+	rpt.measurement = "my run"
+	rpt.url = "http://b.com/ y"
+	finalizeReport(rpt, time.Second)
+
+	want := `my\ run,url=http://b.com/\ y duration=1000000i,status=0i,bytes=-1i,error="read \"x\": reset" 1400000000000000005
+my\ run,url=http://a.com/x?a\=1\,b\=2 duration=2000000i,status=200i,bytes=10i 1400000000001000005
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Expected influx output %q, %q is found", want, got)
+	}
+}
+
+func TestPrintInflux_NoURL(t *testing.T) {
+	rpt, buf := newTestReport("influx", false,
+		&result{statusCode: 200, start: time.Unix(1400000000, 0), duration: time.Millisecond, contentLength: 10},
+	)
+	rpt.measurement = "a=b,c"
+	finalizeReport(rpt, time.Second)
+
+	want := `a=b\,c duration=1000000i,status=200i,bytes=10i 1400000000000000000
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Expected influx output %q, %q is found", want, got)
+	}
+}
+
+func TestPrintHTML(t *testing.T) {
+	rpt, buf := newTestReport("html", false,
+		&result{statusCode: 200, duration: 100 * time.Millisecond},
+		&result{statusCode: 404, duration: 300 * time.Millisecond},
+		&result{err: errors.New("<boom>")},
+	)
+	finalizeReport(rpt, time.Second)
+
+	out := buf.String()
+	for _, s := range []string{
+		"<td>404</td>",
+		"<td>&lt;boom&gt;</td>",
+		`"latency_distribution":[{"percentage":10,"latency":0.1}`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the HTML output, %q is found", s, out)
+		}
+	}
+	if strings.Contains(out, "<script src") || strings.Contains(out, "<link") {
+		t.Errorf("Expected no external resource in the HTML output")
+	}
+}
+
+func TestPrintMarkdown(t *testing.T) {
+	rpt, buf := newTestReport("md", false,
+		&result{statusCode: 404, duration: 300 * time.Millisecond},
+		&result{statusCode: 200, duration: 100 * time.Millisecond},
+		&result{err: errors.New("a|b")},
+	)
+	rpt.buckets = 2
+	finalizeReport(rpt, time.Second)
+
+	out := buf.String()
+	for _, s := range []string{
+		"| Average | 0.2000 secs |\n",
+		"| 50% | 0.1000 secs |\n",
+		"| 200 | 1 | 0.1000 secs | 0.1000 secs | 0.1000 secs |\n| 404 | 1 |",
+		"```\n  0.100 [1]\t|",
+		"| other | 1 | a\\|b |\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the Markdown output, %q is found", s, out)
+		}
+	}
+}
+
+func TestTimeSeries(t *testing.T) {
+	start := time.Now()
+	var results []*result
+	for i := 0; i < 5; i++ {
+		// Completed in the first interval.
+		results = append(results, &result{statusCode: 200, start: start, duration: time.Duration(i+1) * 100 * time.Millisecond})
+	}
+	results = append(results,
+		&result{statusCode: 200, start: start.Add(time.Second), duration: 500 * time.Millisecond},
+		&result{err: errors.New("boom"), start: start.Add(1700 * time.Millisecond)},
+	)
+	rpt, buf := newTestReport("", false, results...)
+	rpt.start = start
+	rpt.interval = time.Second
+	finalizeReport(rpt, 2500*time.Millisecond)
+
+	if len(rpt.TimeSeries) != 2 {
+		t.Fatalf("Expected 2 intervals, %v is found", len(rpt.TimeSeries))
+	}
+	if iv := rpt.TimeSeries[0]; iv.Count != 5 || iv.RPS != 5 || iv.P50 != 0.3 || iv.P99 != 0.5 {
+		t.Errorf("Expected 5 requests with p50 0.3 and p99 0.5, %+v is found", iv)
+	}
+	if iv := rpt.TimeSeries[1]; iv.Start != time.Second || iv.Count != 2 || iv.Errors != 1 || iv.P99 != 0.5 {
+		t.Errorf("Expected 2 requests and 1 error in the second interval, %+v is found", iv)
+	}
+	if !strings.Contains(buf.String(), "[ 1.0 secs]\t2 requests, 2.0000 req/s, 1 errors") {
+		t.Errorf("Expected the time series in the summary, %q is found", buf.String())
+	}
+}
+
+func TestTimeSeries_Truncated(t *testing.T) {
+	start := time.Now()
+	var results []*result
+	for i := 0; i < 70; i++ {
+		results = append(results, &result{statusCode: 200, start: start.Add(time.Duration(i) * time.Second), duration: time.Millisecond})
+	}
+	rpt, buf := newTestReport("", false, results...)
+	rpt.start = start
+	rpt.interval = time.Second
+	finalizeReport(rpt, 70*time.Second)
+
+	if len(rpt.TimeSeries) != 70 {
+		t.Errorf("Expected 70 intervals, %v is found", len(rpt.TimeSeries))
+	}
+	if !strings.Contains(buf.String(), "... 10 more intervals") {
+		t.Errorf("Expected the time series to be truncated, %q is found", buf.String())
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		rpt, buf := newTestReport("", false,
+			&result{statusCode: 200, duration: 100 * time.Millisecond},
+			&result{statusCode: 200, duration: 200 * time.Millisecond},
+			&result{statusCode: 200, duration: 300 * time.Millisecond},
+			&result{statusCode: 200, duration: 600 * time.Millisecond},
+			&result{err: errors.New("boom")},
+		)
+		if stream {
+			rpt.lh = newLatencyHistogram()
+		}
+		finalizeReport(rpt, time.Second)
+
+		// Mean of 0.3, deviations of -0.2, -0.1, 0 and 0.3.
+		if math.Abs(rpt.Variance-0.035) > 1e-9 || math.Abs(rpt.StdDev-math.Sqrt(0.035)) > 1e-9 {
+			t.Errorf("Expected a variance of 0.035, %v is found", rpt.Variance)
+		}
+		if !strings.Contains(buf.String(), "Std deviation:\t0.1871 secs.") {
+			t.Errorf("Expected the std deviation in the summary, %q is found", buf.String())
+		}
+	}
+}
+
+func TestStdDev_NoSample(t *testing.T) {
+	rpt, _ := newTestReport("", false, &result{err: errors.New("boom")})
+	finalizeReport(rpt, time.Second)
+	if rpt.StdDev != 0 || rpt.Variance != 0 {
+		t.Errorf("Expected no deviation without latencies, %v is found", rpt.StdDev)
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	results := []*result{
+		{statusCode: 200, duration: time.Millisecond},
+		{statusCode: 200, duration: time.Millisecond},
+		{statusCode: 503, duration: time.Millisecond},
+		{err: errors.New("boom")},
+	}
+	rpt, buf := newTestReport("", false, results...)
+	// Less results than requested, as of an interrupted run.
+	rpt.size = 100
+	finalizeReport(rpt, time.Second)
+	if rpt.ErrorRate != 0.25 {
+		t.Errorf("Expected an error rate of 0.25, %v is found", rpt.ErrorRate)
+	}
+	if !strings.Contains(buf.String(), "Error rate:\t25.00%") {
+		t.Errorf("Expected the error rate in the summary, %q is found", buf.String())
+	}
+
+	rpt, _ = newTestReport("", false, results...)
+	rpt.non2xxErrors = true
+	finalizeReport(rpt, time.Second)
+	if rpt.ErrorRate != 0.5 {
+		t.Errorf("Expected an error rate of 0.5 with the non-2xx responses, %v is found", rpt.ErrorRate)
+	}
+}
+
+func TestAllFailed(t *testing.T) {
+	var results []*result
+	for i := 0; i < 5; i++ {
+		results = append(results, &result{err: errors.New("connection refused"), duration: time.Millisecond})
+	}
+	rpt, buf := newTestReport("", false, results...)
+	finalizeReport(rpt, time.Second)
+	if !rpt.AllFailed() || rpt.Average != 0 || rpt.RPS != 0 || rpt.ErrorRate != 1 {
+		t.Errorf("Expected every request to fail with zero statistics, %+v is found", rpt)
+	}
+	out := buf.String()
+	for _, s := range []string{"Succeeded:\t0 of 5 requests.", "Error rate:\t100.00%", "[5]\tother, e.g. connection refused"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the summary, %q is found", s, out)
+		}
+	}
+
+	// Nor NaN in the JSON output, even without any time elapsed.
+	rpt, buf = newTestReport("json", false, results...)
+	finalizeReport(rpt, 0)
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is expected to be valid JSON, %v", err)
+	}
+	if got["average"] != 0.0 || got["rps"] != 0.0 {
+		t.Errorf("Expected a zero average and rps, %v and %v are found", got["average"], got["rps"])
+	}
+}
+
+func TestAllFailed_Partial(t *testing.T) {
+	rpt, buf := newTestReport("", false,
+		&result{err: errors.New("connection refused")},
+		&result{statusCode: 200, duration: 10 * time.Millisecond},
+	)
+	finalizeReport(rpt, time.Second)
+	if rpt.AllFailed() || rpt.Average != 0.01 || rpt.ErrorRate != 0.5 {
+		t.Errorf("Expected a request to succeed, %+v is found", rpt)
+	}
+	if strings.Contains(buf.String(), "Succeeded:") || !strings.Contains(buf.String(), "Average:\t0.0100 secs.") {
+		t.Errorf("Expected the summary of the successful request, %q is found", buf.String())
+	}
+
+	// Nothing was made, nothing failed.
+	rpt, _ = newTestReport("", false)
+	finalizeReport(rpt, time.Second)
+	if rpt.AllFailed() {
+		t.Errorf("Expected no failure without any request")
+	}
+}
+
+func TestStatusCodeStats(t *testing.T) {
+	var results []*result
+	for i := 1; i <= 20; i++ {
+		results = append(results, &result{statusCode: 200, duration: time.Duration(i) * 10 * time.Millisecond})
+	}
+	results = append(results,
+		&result{statusCode: 503, duration: time.Millisecond},
+		&result{statusCode: 503, duration: 3 * time.Millisecond},
+	)
+	rpt, buf := newTestReport("", false, results...)
+	finalizeReport(rpt, time.Second)
+
+	ok := rpt.StatusCodeStats[200]
+	if ok.Min != 0.01 || math.Abs(ok.Average-0.105) > 1e-9 || math.Abs(ok.P95-0.19) > 0.001 {
+		t.Errorf("Expected min 0.01, avg 0.105 and p95 0.19 for 200, %+v is found", ok)
+	}
+	if st := rpt.StatusCodeStats[503]; st.Min != 0.001 || math.Abs(st.Average-0.002) > 1e-9 {
+		t.Errorf("Expected min 0.001 and avg 0.002 for 503, %+v is found", st)
+	}
+	if !strings.Contains(buf.String(), "[503]\t2 responses (9.09%), min 0.0010 secs, avg 0.0020 secs, p95 0.0030 secs") {
+		t.Errorf("Expected the statistics per status code, %q is found", buf.String())
+	}
+}
+
+func TestPrintStatusCodes(t *testing.T) {
+	var results []*result
+	for _, code := range []int{503, 200, 200, 204, 200, 404, 200, 201, 503, 301} {
+		results = append(results, &result{statusCode: code, duration: time.Duration(code) * time.Microsecond})
+	}
+	results = append(results, &result{err: errors.New("boom")})
+	rpt, buf := newTestReport("json", false, results...)
+	finalizeReport(rpt, time.Second)
+
+	// Percentages are of the responses, the error is left out.
+	if c := rpt.StatusClasses[0]; c.Class != "2xx" || c.Count != 6 || c.Percent != 60 {
+		t.Errorf("Expected 6 2xx responses, %+v is found", c)
+	}
+	buf.Reset()
+	rpt.printStatusCodes()
+	checkGolden(t, "status_codes", buf.Bytes())
+}
+
+// Results of the golden files of the outputs, with known latencies,
+// sizes and status codes.
+func goldenResults() []*result {
+	var results []*result
+	for i, code := range []int{200, 200, 404, 200, 500, 200, 200, 301, 200, 200} {
+		results = append(results, &result{
+			seq:           i,
+			statusCode:    code,
+			duration:      time.Duration(10*(i+1)) * time.Millisecond,
+			contentLength: int64(100 * (i%3 + 1)),
+			proto:         "HTTP/1.1",
+		})
+	}
+	return append(results, &result{seq: 10, err: errors.New("connection refused")})
+}
+
+func TestPrintGolden(t *testing.T) {
+	for _, output := range []string{"", "csv", "md"} {
+		rpt, buf := newTestReport(output, false, goldenResults()...)
+		finalizeReport(rpt, 2*time.Second)
+		name := "report_" + output
+		if output == "" {
+			name = "report_summary"
+		}
+		checkGolden(t, name, buf.Bytes())
+	}
+}
+
+func TestPrintResolution(t *testing.T) {
+	rpt, buf := newTestReport("", false,
+		&result{statusCode: 200, duration: 100 * time.Millisecond})
+	rpt.Resolution = &Resolution{Host: "example.com", Addrs: []string{"10.0.0.1", "10.0.0.2"}, Addr: "10.0.0.2"}
+	finalizeReport(rpt, time.Second)
+	if !strings.HasPrefix(buf.String(), "\nResolved example.com to 10.0.0.1, 10.0.0.2, connecting to 10.0.0.2.\n") {
+		t.Errorf("Expected the resolution to be printed first, %v is found", buf.String())
+	}
+}
+
+func TestPrintProtocols(t *testing.T) {
+	rpt, buf := newTestReport("", false,
+		&result{statusCode: 200, proto: "HTTP/2.0", duration: time.Millisecond},
+		&result{statusCode: 200, proto: "HTTP/1.1", duration: time.Millisecond},
+		&result{statusCode: 200, proto: "HTTP/1.0", duration: time.Millisecond},
+	)
+	finalizeReport(rpt, time.Second)
+	want := "\nProtocol distribution:\n  [HTTP/1.0]\t1 responses\n  [HTTP/1.1]\t1 responses\n  [HTTP/2.0]\t1 responses\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected the protocols in order, %q is found", buf.String())
+	}
+}
+
+func TestPrintRetries(t *testing.T) {
+	rpt, buf := newTestReport("", false,
+		&result{statusCode: 200, duration: time.Millisecond, retries: []string{"status 503", "timeout"}},
+		&result{statusCode: 200, duration: time.Millisecond, retries: []string{"connection_refused", "status 503"}},
+	)
+	finalizeReport(rpt, time.Second)
+	want := "\nRetries:\t4\n  [1]\tconnection_refused\n  [2]\tstatus 503\n  [1]\ttimeout\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected the retry reasons in order, %q is found", buf.String())
+	}
+}
+
+func TestPrintConnections(t *testing.T) {
+	rpt, buf := newTestReport("", false,
+		&result{statusCode: 200, duration: time.Millisecond, dials: 1},
+		&result{statusCode: 200, duration: time.Millisecond, timings: timings{reused: true}},
+	)
+	finalizeReport(rpt, time.Second)
+	if !strings.Contains(buf.String(), "  Connections:\t1 established, 50.00% requests on reused connections.\n") {
+		t.Errorf("Expected the traced connections, %q is found", buf.String())
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default refresh interval of the progress line.
+const defaultProgressInterval = time.Second
+
+// progress counts the completed requests as workers report them,
+// independently of the Report which is only populated in finalize. It
+// is the status of the run on its writer, the progress line and the
+// summaries of the intervals printed above it.
+type progress struct {
+	done   int64
+	errors int64
+
+	// Total number of requests, zero if unknown.
+	total    int
+	interval time.Duration
+	w        io.Writer
+	start    time.Time
+	stop     chan struct{}
+	stopped  chan struct{}
+	// Set if the progress line is printed, rather than only the
+	// summaries of the intervals.
+	line bool
+	// Guards the writes to w, and finished once the last progress
+	// line is printed.
+	mu       sync.Mutex
+	finished bool
+}
+
+func newProgress(total int, interval time.Duration, w io.Writer) *progress {
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	return &progress{
+		total:    total,
+		interval: interval,
+		w:        w,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		line:     true,
+	}
+}
+
+// Records a completed request, safe for concurrent use.
+func (p *progress) increment(err error) {
+	atomic.AddInt64(&p.done, 1)
+	if err != nil {
+		atomic.AddInt64(&p.errors, 1)
+	}
+}
+
+// Starts refreshing the progress line every interval.
+func (p *progress) Start() {
+	p.start = time.Now()
+	go func() {
+		defer close(p.stopped)
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.mu.Lock()
+				p.print()
+				p.mu.Unlock()
+			case <-p.stop:
+				p.mu.Lock()
+				p.print()
+				if p.line {
+					fmt.Fprintln(p.w)
+				}
+				p.finished = true
+				p.mu.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// Prints the final progress line and stops refreshing.
+func (p *progress) Finish() {
+	close(p.stop)
+	<-p.stopped
+}
+
+// Prints the summary of an interval on a line of its own, above the
+// progress line which is then printed again.
+func (p *progress) printInterval(s string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.line || p.finished {
+		fmt.Fprintln(p.w, s)
+		return
+	}
+	// Clears the progress line before it is overwritten.
+	fmt.Fprintf(p.w, "\r\033[K%s\n", s)
+	p.print()
+}
+
+// Prints the progress line, if any, with mu held.
+func (p *progress) print() {
+	if !p.line {
+		return
+	}
+	done := atomic.LoadInt64(&p.done)
+	errs := atomic.LoadInt64(&p.errors)
+	var rps float64
+	if d := time.Since(p.start).Seconds(); d > 0 {
+		rps = float64(done) / d
+	}
+	if p.total > 0 {
+		fmt.Fprintf(p.w, "\r%d / %d requests, %4.1f req/s, %d errors", done, p.total, rps, errs)
+	} else {
+		fmt.Fprintf(p.w, "\r%d requests, %4.1f req/s, %d errors", done, rps, errs)
+	}
+}
+
+// TerminalProgress returns stderr if it is a terminal and no output type
+// is set, nil otherwise. It is the Progress that Run uses by default.
+func TerminalProgress(output string) io.Writer {
+	if output == "" && isTerminal(os.Stderr) {
+		return os.Stderr
+	}
+	return nil
+}
+
+// Returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
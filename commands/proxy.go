@@ -0,0 +1,97 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxyError is the failure of a CONNECT request to the proxy, e.g.
+// a 407 if the proxy requires other credentials.
+type proxyError struct {
+	status string
+}
+
+func (e *proxyError) Error() string {
+	return "proxy CONNECT failed: " + e.status
+}
+
+// Fails the tunnel unless the proxy accepted the CONNECT request.
+func checkProxyConnect(_ context.Context, _ *url.URL, _ *http.Request, resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return &proxyError{status: resp.Status}
+	}
+	return nil
+}
+
+// Returns the proxy of the request, nil if its host bypasses the proxy.
+func (b *Boom) proxy(req *http.Request) (*url.URL, error) {
+	if bypassProxy(req.URL, b.NoProxy) {
+		return nil, nil
+	}
+	return b.Proxy, nil
+}
+
+// Tells whether the host of u matches one of the NO_PROXY-style
+// patterns: "*", a host name which also matches its subdomains, with
+// or without a leading dot, an IP address or a CIDR range. A pattern
+// with a port only matches that port.
+func bypassProxy(u *url.URL, patterns []string) bool {
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	ip := net.ParseIP(host)
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "*" {
+			return true
+		}
+		if _, ipnet, err := net.ParseCIDR(p); err == nil {
+			if ip != nil && ipnet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, pp, err := net.SplitHostPort(p); err == nil {
+			if pp != port {
+				continue
+			}
+			p = h
+		}
+		p = strings.TrimPrefix(strings.Trim(p, "[]"), ".")
+		if p == "" {
+			continue
+		}
+		if ip != nil {
+			if pip := net.ParseIP(p); pip != nil && pip.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		host = strings.ToLower(host)
+		if host == p || strings.HasSuffix(host, "."+p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBypassProxy(t *testing.T) {
+	patterns := []string{"localhost", ".internal", "example.com:8080", "10.0.0.0/8", "::1"}
+	for _, c := range []struct {
+		url    string
+		bypass bool
+	}{
+		{"http://localhost/", true},
+		{"http://a.b.internal/", true},
+		{"http://internal/", true},
+		{"http://notinternal/", false},
+		{"http://example.com:8080/", true},
+		{"http://example.com/", false},
+		{"https://10.1.2.3/", true},
+		{"http://11.1.2.3/", false},
+		{"http://[::1]:80/", true},
+		{"http://other.com/", false},
+	} {
+		u, _ := url.Parse(c.url)
+		if got := bypassProxy(u, patterns); got != c.bypass {
+			t.Errorf("Expected bypass of %v to be %v, %v is found", c.url, c.bypass, got)
+		}
+	}
+	u, _ := url.Parse("http://any.com/")
+	if !bypassProxy(u, []string{"*"}) {
+		t.Errorf("Expected * to bypass any host")
+	}
+}
+
+func TestProxy_Credentials(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Requests to the proxy have absolute URLs.
+		if r.URL.Host == "example.invalid" && r.Header.Get("Proxy-Authorization") == "Basic dXNlcjpwYXNz" {
+			atomic.AddInt64(&count, int64(1))
+		}
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(handler))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+	u.User = url.UserPassword("user", "pass")
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "http://example.invalid/",
+		},
+		N:      5,
+		C:      2,
+		Proxy:  u,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if n := atomic.LoadInt64(&count); n != 5 || rpt.StatusCodeDist[200] != 5 {
+		t.Errorf("Expected 5 requests through the proxy, %v (%v) is found", n, rpt.StatusCodeDist)
+	}
+}
+
+func TestProxy_ConnectFailed(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(handler))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "https://example.invalid/",
+		},
+		N:      3,
+		C:      1,
+		Proxy:  u,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.Errors[errProxy] != 3 {
+		t.Errorf("Expected 3 proxy errors, %v is found", rpt.Errors)
+	}
+}
+
+func TestProxy_Bypassed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	// Nothing listens on the proxy address.
+	u, _ := url.Parse("http://127.0.0.1:1")
+
+	for _, noProxy := range [][]string{{"127.0.0.1"}, nil} {
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:       3,
+			C:       1,
+			Proxy:   u,
+			NoProxy: noProxy,
+			Output:  "json",
+			Writer:  ioutil.Discard,
+		}
+		rpt := boom.Run()
+		if noProxy != nil && rpt.StatusCodeDist[200] != 3 {
+			t.Errorf("Expected 3 direct requests, %v (%v) is found", rpt.StatusCodeDist, rpt.Errors)
+		}
+		if noProxy == nil && rpt.Errors[errProxy] != 3 {
+			t.Errorf("Expected 3 proxy errors, %v is found", rpt.Errors)
+		}
+	}
+}
+
+// A minimal SOCKS5 server, RFC 1928 and 1929, accepting the credentials
+// user:pass and counting the tunnels it opens.
+type socksServer struct {
+	ln      net.Listener
+	tunnels int64
+}
+
+func newSocksServer(t *testing.T) *socksServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	// Greeting, username/password authentication is required.
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return
+	}
+	io.CopyN(ioutil.Discard, conn, int64(buf[1]))
+	conn.Write([]byte{5, 2})
+	readString := func() string {
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		b := make([]byte, n[0])
+		io.ReadFull(conn, b)
+		return string(b)
+	}
+	io.ReadFull(conn, buf[:1])
+	if user, pass := readString(), readString(); user != "user" || pass != "pass" {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	// Connect request, with an IPv4 address or a host name.
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		host = readString()
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	atomic.AddInt64(&s.tunnels, 1)
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestSocks5(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	socks := newSocksServer(t)
+	defer socks.ln.Close()
+
+	for _, c := range []struct {
+		pass  string
+		ok    int
+		proxy int
+	}{
+		{"pass", 4, 0},
+		{"wrong", 0, 4},
+	} {
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:             4,
+			C:             2,
+			Proxy:         &url.URL{Scheme: "socks5", Host: socks.ln.Addr().String(), User: url.UserPassword("user", c.pass)},
+			AllowInsecure: true,
+			Output:        "json",
+			Writer:        ioutil.Discard,
+		}
+		rpt := boom.Run()
+		if rpt.StatusCodeDist[200] != c.ok || rpt.Errors[errProxy] != c.proxy {
+			t.Errorf("Expected %v responses and %v proxy errors, %v (%v) is found", c.ok, c.proxy, rpt.StatusCodeDist, rpt.Errors)
+		}
+	}
+	if n := atomic.LoadInt64(&socks.tunnels); n < 1 || n > 2 {
+		t.Errorf("Expected a tunnel per worker, %v is found", n)
+	}
+}
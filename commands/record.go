@@ -0,0 +1,249 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Columns of a results file. The row following the header is the start
+// of the run, its seq is "start", the last one is its total duration,
+// whose seq is "total".
+var recordColumns = []string{"seq", "start", "duration", "status_code", "content_length", "sent", "proto", "error_category", "error"}
+
+// recorder writes each result to a gzipped CSV file as it is collected,
+// so that the report can be made again from the file, see Replay.
+type recorder struct {
+	f   io.WriteCloser
+	gz  *gzip.Writer
+	csv *csv.Writer
+	err error
+}
+
+func newRecorder(path string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return recordTo(f), nil
+}
+
+func recordTo(f io.WriteCloser) *recorder {
+	r := &recorder{f: f}
+	r.gz, _ = gzip.NewWriterLevel(f, gzip.BestSpeed)
+	r.csv = csv.NewWriter(r.gz)
+	r.write(recordColumns)
+	return r
+}
+
+// Writes the start of the run, before any result.
+func (r *recorder) begin(start time.Time) {
+	r.write([]string{"start", strconv.FormatInt(start.UnixNano(), 10)})
+}
+
+func (r *recorder) observe(res *result) {
+	row := []string{
+		strconv.Itoa(res.seq),
+		strconv.FormatInt(res.start.UnixNano(), 10),
+		strconv.FormatInt(int64(res.duration), 10),
+		strconv.Itoa(res.statusCode),
+		strconv.FormatInt(res.contentLength, 10),
+		strconv.FormatInt(res.sent, 10),
+		res.proto,
+		"",
+		"",
+	}
+	if res.err != nil {
+		row[7], row[8] = classifyError(res.err), res.err.Error()
+	}
+	r.write(row)
+}
+
+func (r *recorder) write(row []string) {
+	if r.err == nil {
+		r.err = r.csv.Write(row)
+	}
+}
+
+// Writes the total duration of the run, and closes the file. Returns
+// the first error writing it.
+func (r *recorder) close(total time.Duration) error {
+	r.write([]string{"total", strconv.FormatInt(int64(total), 10)})
+	r.csv.Flush()
+	if r.err == nil {
+		r.err = r.csv.Error()
+	}
+	if err := r.gz.Close(); r.err == nil {
+		r.err = err
+	}
+	if err := r.f.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// recordedError is the error of a recorded result, counted in the
+// category it was recorded with.
+type recordedError struct {
+	category string
+	msg      string
+}
+
+func (e *recordedError) Error() string {
+	return e.msg
+}
+
+// resultReader reads the results of a file written by a recorder, in
+// the order they were collected.
+type resultReader struct {
+	cr    *csv.Reader
+	line  int
+	start time.Time
+	// Total duration of the run, or else the end of the latest result
+	// if the file was not closed.
+	total  time.Duration
+	closed bool
+	end    time.Time
+}
+
+func newResultReader(r io.Reader) (*resultReader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid results file, %v", err)
+	}
+	rr := &resultReader{cr: csv.NewReader(gz), line: 2}
+	rr.cr.FieldsPerRecord = -1
+	header, err := rr.cr.Read()
+	if err != nil || len(header) != len(recordColumns) || header[0] != recordColumns[0] {
+		return nil, errors.New("invalid results file, no header")
+	}
+	row, err := rr.cr.Read()
+	if err != nil || len(row) != 2 || row[0] != "start" {
+		return nil, errors.New("invalid results file, no start")
+	}
+	ns, err := strconv.ParseInt(row[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid results file, no start")
+	}
+	rr.start = time.Unix(0, ns)
+	return rr, nil
+}
+
+// Returns the next result, or nil once all of them are read.
+func (rr *resultReader) next() (*result, error) {
+	for {
+		rr.line++
+		row, err := rr.cr.Read()
+		if err == io.EOF || err == io.ErrUnexpectedEOF && !rr.closed {
+			// The file of a run that did not end, e.g. killed, ends
+			// with its last result.
+			if !rr.closed {
+				rr.total = rr.end.Sub(rr.start)
+			}
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid results file, %v", err)
+		}
+		if len(row) == 2 && row[0] == "total" {
+			ns, err := strconv.ParseInt(row[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid results file, row %d", rr.line)
+			}
+			rr.total, rr.closed = time.Duration(ns), true
+			continue
+		}
+		res, err := parseRecord(row)
+		if err != nil {
+			return nil, fmt.Errorf("invalid results file, row %d", rr.line)
+		}
+		if end := res.start.Add(res.duration); end.After(rr.end) {
+			rr.end = end
+		}
+		return res, nil
+	}
+}
+
+func parseRecord(row []string) (*result, error) {
+	if len(row) != len(recordColumns) {
+		return nil, errors.New("invalid row")
+	}
+	var ints [6]int64
+	for i := range ints {
+		n, err := strconv.ParseInt(row[i], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ints[i] = n
+	}
+	res := &result{
+		seq:           int(ints[0]),
+		start:         time.Unix(0, ints[1]),
+		duration:      time.Duration(ints[2]),
+		statusCode:    int(ints[3]),
+		contentLength: ints[4],
+		sent:          ints[5],
+		proto:         row[6],
+	}
+	if row[7] != "" {
+		res.err = &recordedError{category: row[7], msg: row[8]}
+	}
+	return res, nil
+}
+
+// Replay makes the report of the results recorded by a run, see Record,
+// without sending any request. Only the options of the report are used,
+// e.g. Output, Percentiles, Buckets, ExpectedStatus or SLA. The latency
+// breakdown, the distributions per URL, address or TLS version and the
+// first failure are not recorded. The report is not printed.
+func (b *Boom) Replay(r io.Reader) (*Report, error) {
+	rr, err := newResultReader(r)
+	if err != nil {
+		return nil, err
+	}
+	b.rpt = b.makeReport(0, nil)
+	b.rpt.replayed = true
+	b.rpt.start = rr.start
+	for {
+		res, err := rr.next()
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			break
+		}
+		b.rpt.add(res)
+	}
+	close(b.rpt.done)
+	b.rpt.finalize(rr.total)
+	return b.rpt, nil
+}
+
+// LoadResults makes the report of a results file, see Replay.
+func (b *Boom) LoadResults(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return b.Replay(f)
+}
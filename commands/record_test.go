@@ -0,0 +1,143 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(saveHandler))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "results.csv.gz")
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+		},
+		Urls:   []string{server.URL, server.URL + "?fail=1"},
+		N:      10,
+		C:      2,
+		Record: path,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+
+	replay := &Boom{Output: "json", Percentiles: []float64{50, 99.9}, Writer: ioutil.Discard}
+	got, err := replay.LoadResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.StatusCodeDist, rpt.StatusCodeDist) {
+		t.Errorf("Expected %v, %v is found", rpt.StatusCodeDist, got.StatusCodeDist)
+	}
+	if got.Total != rpt.Total || got.Slowest != rpt.Slowest || got.Fastest != rpt.Fastest {
+		t.Errorf("Expected the total, slowest and fastest of the run, %v %v %v is found", got.Total, got.Slowest, got.Fastest)
+	}
+	if got.SizeTotal != rpt.SizeTotal || got.RPS != rpt.RPS {
+		t.Errorf("Expected %v bytes at %v req/s, %v at %v is found", rpt.SizeTotal, rpt.RPS, got.SizeTotal, got.RPS)
+	}
+	if len(got.LatencyDistribution) != 2 || got.LatencyDistribution[1].Percentage != 99.9 {
+		t.Errorf("Expected the requested percentiles, %v is found", got.LatencyDistribution)
+	}
+	if got.Breakdown != nil {
+		t.Errorf("Expected no latency breakdown, %v is found", got.Breakdown)
+	}
+}
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// Records the results to a buffer, closing the file with the total
+// duration of the run unless it is zero.
+func recordResults(t *testing.T, start time.Time, results []*result, total time.Duration) *bytes.Buffer {
+	buf := nopCloser{new(bytes.Buffer)}
+	rec := recordTo(buf)
+	rec.begin(start)
+	for _, res := range results {
+		rec.observe(res)
+	}
+	if total > 0 {
+		if err := rec.close(total); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		// As if the run was killed, the data written so far is kept.
+		rec.csv.Flush()
+		rec.gz.Close()
+	}
+	return buf.Buffer
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	results := []*result{
+		{seq: 0, start: start, duration: time.Second, statusCode: 200, contentLength: 10, proto: "HTTP/1.1"},
+		{seq: 1, start: start.Add(time.Second), duration: 2 * time.Second, statusCode: 500, contentLength: -1, proto: "HTTP/1.1"},
+		{seq: 2, start: start.Add(time.Second), duration: time.Second, err: errors.New("dial tcp: lookup a.b: no such host, \"quoted\"\nline")},
+	}
+	buf := recordResults(t, start, results, 5*time.Second)
+	boom := &Boom{Output: "json", Writer: ioutil.Discard, WarmupRequests: 1}
+	rpt, err := boom.Replay(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpt.Total != 5*time.Second || rpt.Warmup != 1 {
+		t.Errorf("Expected a 5s run with a warmup request, %v and %v are found", rpt.Total, rpt.Warmup)
+	}
+	if rpt.StatusCodeDist[500] != 1 || rpt.SizeTotal != 0 || rpt.Errors[errOther] != 1 {
+		t.Errorf("Expected a 500 response and an error, %v %v %v is found", rpt.StatusCodeDist, rpt.SizeTotal, rpt.Errors)
+	}
+	if msg := rpt.ErrorSamples[errOther]; msg != results[2].err.Error() {
+		t.Errorf("Expected the message of the error, %q is found", msg)
+	}
+
+	// The file of a run that did not end lasts until its last result.
+	buf = recordResults(t, start, results, 0)
+	rpt, err = (&Boom{Output: "json", Writer: ioutil.Discard}).Replay(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpt.Total != 3*time.Second {
+		t.Errorf("Expected a 3s run, %v is found", rpt.Total)
+	}
+}
+
+func TestReplay_Invalid(t *testing.T) {
+	if _, err := (&Boom{}).Replay(strings.NewReader("seq,start")); err == nil {
+		t.Errorf("Expected an error for a file that is not gzipped")
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("seq,start,duration,status_code,content_length,sent,proto,error_category,error\nstart,1\n0,1,x,200,0,0,HTTP/1.1,,\n"))
+	gz.Close()
+	if _, err := (&Boom{Writer: ioutil.Discard}).Replay(&buf); err == nil || err.Error() != "invalid results file, row 3" {
+		t.Errorf("Expected an invalid row, %v is found", err)
+	}
+}
@@ -15,94 +15,1291 @@
 package commands
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 )
 
+// Grace period given to in-flight requests when the run is stopped.
+const stopGracePeriod = 2 * time.Second
+
+// Size of the chunks of a chunked body, if none is set.
+const defaultChunkSize = 4 << 10
+
+// Default time to wait for a 100 Continue response.
+const defaultContinueTimeout = time.Second
+
+func (b *Boom) init() {
+	b.initOnce.Do(func() {
+		b.stop = make(chan struct{})
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	})
+}
+
+// Stop stops issuing new requests. In-flight requests are given a
+// grace period to complete, then they are cancelled and the report
+// is made over the results received so far.
+func (b *Boom) Stop() {
+	b.init()
+	b.stopOnce.Do(func() {
+		close(b.stop)
+		time.AfterFunc(stopGracePeriod, b.cancel)
+	})
+}
+
+// Stops the run once MaxDuration expires, cancelling in-flight requests
+// without a grace period.
+func (b *Boom) expire() {
+	atomic.StoreInt32(&b.expired, 1)
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+	b.cancel()
+}
+
+// Stops the run once an error threshold is crossed, as Stop does.
+func (b *Boom) abort() {
+	atomic.StoreInt32(&b.aborted, 1)
+	b.Stop()
+}
+
+// Returns true if the run was stopped.
+func (b *Boom) stopped() bool {
+	select {
+	case <-b.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Prepare validates the options and precompiles the templates of the
+// requests. It is called by Run, calling it beforehand allows to report
+// errors before the run starts.
+func (b *Boom) Prepare() error {
+	if b.prepared {
+		return nil
+	}
+	if !b.NoTemplate && len(b.Entries) == 0 && b.Log == nil {
+		// Templates are rendered once to catch errors early, e.g.
+		// unknown columns of the data feed.
+		var data map[string]string
+		if b.Data != nil {
+			data = b.Data.row(0)
+		}
+		parse := func(name, s string) (*template.Template, error) {
+			t, err := parseTemplate(name, s)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := render(t, s, data); err != nil {
+				return nil, err
+			}
+			return t, nil
+		}
+		urls := b.Urls
+		if len(urls) == 0 {
+			urls = []string{b.Req.Url}
+		}
+		b.urlTmpls = make(map[string]*template.Template)
+		for _, u := range urls {
+			t, err := parse("url", u)
+			if err != nil {
+				return err
+			}
+			b.urlTmpls[u] = t
+		}
+		var err error
+		if b.bodyTmpl, err = parse("body", b.Req.Body); err != nil {
+			return err
+		}
+		b.headerTmpls = make(map[string][]*template.Template)
+		for name, values := range b.Req.Header {
+			tmpls := make([]*template.Template, len(values))
+			var found bool
+			for i, v := range values {
+				if tmpls[i], err = parse(name, v); err != nil {
+					return err
+				}
+				found = found || tmpls[i] != nil
+			}
+			if found {
+				b.headerTmpls[name] = tmpls
+			}
+		}
+	}
+	if err := b.parseEntries(); err != nil {
+		return err
+	}
+	if b.RequestIDHeader != "" && b.RequestIDSeq {
+		b.idPrefix = uuid()[:8]
+	}
+	if len(b.UrlWeights) > 0 {
+		if len(b.UrlWeights) != len(b.Urls) {
+			return errors.New("the URLs and their weights do not match")
+		}
+		var err error
+		if b.urlAlias, err = newAliasTable(b.UrlWeights); err != nil {
+			return fmt.Errorf("invalid URL weights, %v", err)
+		}
+	}
+	for _, ip := range b.LocalAddrs {
+		// Binding fails early if the address is not assigned.
+		ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+		if err != nil {
+			return err
+		}
+		ln.Close()
+	}
+	if b.SaveDir != "" {
+		if err := os.MkdirAll(b.SaveDir, 0755); err != nil {
+			return err
+		}
+	}
+	if b.GzipBody {
+		if err := b.prepareGzip(); err != nil {
+			return err
+		}
+	}
+	if len(b.Urls) == 0 && len(b.Entries) == 0 && b.Log == nil && b.urlTmpls[b.Req.Url] == nil && b.bodyTmpl == nil && len(b.headerTmpls) == 0 {
+		// The requests are all the same, copied from this one.
+		b.baseReq = b.Req.Request()
+	}
+	b.prepared = true
+	return nil
+}
+
+// Run makes the requests and prints the report, along with the progress
+// line if stderr is a terminal and no output type is set. It returns nil
+// if the options are invalid, see Prepare.
 func (b *Boom) Run() *Report {
-	b.results = make(chan *result, b.N)
-	if b.Output == "" {
-		b.bar = newPb(b.N)
+	if b.Progress == nil {
+		b.Progress = TerminalProgress(b.Output)
+	}
+	rpt, err := b.RunContext(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if rpt != nil {
+		rpt.Print()
+	}
+	return rpt
+}
+
+// RunContext makes the requests and returns the report without printing
+// it, see Report.Print. Cancelling ctx stops the run as Stop does. The
+// error is that of the options, see Prepare, or of the metrics, statsd
+// or results file, in which case the report is returned if the run went
+// on.
+func (b *Boom) RunContext(ctx context.Context) (*Report, error) {
+	if err := b.Prepare(); err != nil {
+		return nil, err
+	}
+	b.init()
+	defer b.cancel()
+	if len(b.Steps) > 0 && b.Duration == 0 {
+		for _, s := range b.Steps {
+			b.Duration += s.Duration
+		}
+	}
+	total := b.N
+	if b.Duration > 0 {
+		// The number of requests is unknown.
+		total = 0
+	}
+	// Results are aggregated while the run goes on, rather than queued
+	// until it ends, so that memory does not grow with N.
+	b.results = make(chan *result, b.C*resultsPerWorker)
+	if b.Progress != nil {
+		b.prog = newProgress(total, b.ProgressInterval, b.Progress)
+	} else if b.Interval > 0 {
+		// The summaries of the intervals only.
+		b.prog = newProgress(total, b.ProgressInterval, os.Stderr)
+		b.prog.line = false
+	}
+	b.rpt = b.makeReport(total, b.results)
+	if b.Interval > 0 {
+		b.rpt.live = newWindow(b.Interval, time.Now())
+		b.rpt.onInterval = b.prog.printInterval
+		if b.rpt.interval == 0 {
+			b.rpt.interval = b.Interval
+		}
+	}
+	if b.AbortErrors > 0 || b.AbortErrorRate > 0 {
+		b.rpt.abort = newAbortCheck(b.AbortErrors, b.AbortErrorRate, b.AbortWindow)
+		b.rpt.onAbort = b.abort
+	}
+	b.rpt.Options = &RunOptions{Url: b.Req.Url, C: b.C, Duration: b.Duration}
+	if b.Duration == 0 {
+		b.rpt.Options.N = b.N
+	}
+	if b.Req.Digest {
+		b.digest = &digestAuth{username: b.Req.Username, password: b.Req.Password}
 	}
-	b.rpt = newReport(b.N, b.results, b.Output)
-	b.run()
-	return b.rpt
+	if b.SaveDir != "" {
+		b.saver = newSaver(b.SaveDir, b.SaveSample, b.SaveMaxBytes)
+		b.rpt.saveDir = b.SaveDir
+	}
+	if b.MetricsAddr != "" {
+		b.metrics = newMetrics()
+		srv, err := serveMetrics(b.MetricsAddr, b.metrics)
+		if err != nil {
+			return nil, err
+		}
+		defer srv.close()
+		b.rpt.metrics = b.metrics
+	}
+	if b.StatsdAddr != "" {
+		sd, err := newStatsd(b.StatsdAddr, b.StatsdPrefix, b.StatsdSample)
+		if err != nil {
+			return nil, err
+		}
+		defer sd.close()
+		b.rpt.sinks = append(b.rpt.sinks, sd)
+	}
+	if b.Record != "" {
+		rec, err := newRecorder(b.Record)
+		if err != nil {
+			return nil, err
+		}
+		b.recorder = rec
+		b.rpt.sinks = append(b.rpt.sinks, rec)
+	}
+	if b.OnResult != nil {
+		b.hook = newHook(b.OnResult, b.Req.Url)
+		b.rpt.sinks = append(b.rpt.sinks, b.hook)
+	}
+	if done := ctx.Done(); done != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-done:
+				b.Stop()
+			case <-finished:
+			}
+		}()
+	}
+	go b.rpt.collect()
+	return b.rpt, b.run()
 }
 
-func (b *Boom) worker(ch chan *http.Request) {
-	host, _, _ := net.SplitHostPort(b.Req.OriginalHost)
+// Creates the report of the results, with the options of the report.
+func (b *Boom) makeReport(total int, results chan *result) *Report {
+	rpt := newReport(total, results, b.Output, b.Writer)
+	rpt.includeLats = b.IncludeLats
+	rpt.expected = b.ExpectedStatus
+	rpt.non2xxErrors = b.Non2xxErrors
+	rpt.verboseErrors = b.VerboseErrors
+	rpt.sla = b.SLA
+	rpt.interval = b.TimeSeries
+	rpt.measurement = b.Measurement
+	if rpt.measurement == "" {
+		rpt.measurement = "boom"
+	}
+	if b.Req != nil {
+		rpt.url = b.Req.Url
+	}
+	rpt.network = b.Network
+	rpt.maxDuration = b.MaxDuration
+	rpt.maxBody = b.MaxBody
+	rpt.Resolution = b.Resolution
+	rpt.setEntries(b.Entries)
+	rpt.setUrlWeights(b.Urls, b.UrlWeights)
+	rpt.requestIDs = b.RequestIDHeader != ""
+	if n := len(b.UserAgents); n > 1 && n <= reportedUserAgents {
+		rpt.countUserAgents = true
+	}
+	if b.Log != nil {
+		rpt.LogSkipped = b.Log.Skipped
+	}
+	if len(b.Percentiles) > 0 {
+		rpt.pctls = b.Percentiles
+	}
+	if b.Buckets > 0 {
+		rpt.buckets = b.Buckets
+	}
+	rpt.bucketWidth = b.BucketWidth
+	rpt.histScale = b.HistScale
+	rpt.warmup = b.Warmup
+	rpt.warmupRequests = b.WarmupRequests
+	rpt.correct = b.CorrectLatency
+	rpt.Ramp = b.Ramp
+	rpt.setSteps(b.Steps)
+	if b.Rate == 0 {
+		rpt.Think = b.Think
+	}
+	rpt.workers = b.C
+	if b.StreamStats {
+		rpt.lh = newLatencyHistogram()
+		if rpt.correct {
+			rpt.correctedLh = newLatencyHistogram()
+		}
+	} else if total > 0 {
+		// At most a latency per request, not grown as they are collected.
+		rpt.Lats = make([]float64, 0, total)
+		if rpt.correct {
+			rpt.correctedLats = make([]float64, 0, total)
+		}
+	}
+	return rpt
+}
+
+// Creates the i-th job, or returns nil if the data feed is exhausted.
+// Only called by the goroutine sending the jobs, so URLs and rows can
+// be picked without synchronization.
+func (b *Boom) newJob(i int) *job {
+	j := &job{seq: i}
+	if n := len(b.UserAgents); n > 0 {
+		// Picked as the jobs are handed out, in a single goroutine.
+		j.userAgent = b.UserAgents[i%n]
+		if b.UserAgentOrder == "random" {
+			j.userAgent = b.UserAgents[rand.Intn(n)]
+		}
+	}
+	if len(b.Entries) > 0 {
+		b.setEntry(j, i, nil)
+		return j
+	}
+	if b.Log != nil {
+		b.setLogRequest(j, i)
+		return j
+	}
+	var data map[string]string
+	if b.Data != nil {
+		var ok bool
+		if data, ok = b.Data.pick(i, b.DataOrder == "random", !b.DataStop); !ok {
+			return nil
+		}
+	}
+	u := b.Req.Url
+	if len(b.Urls) > 0 {
+		if b.urlAlias != nil {
+			u = b.Urls[b.urlAlias.pick()]
+		} else if b.UrlOrder == "random" {
+			u = b.Urls[rand.Intn(len(b.Urls))]
+		} else {
+			u = b.Urls[i%len(b.Urls)]
+		}
+		j.url = u
+	}
+	j.req, j.err = b.build(j, u, data)
+	return j
+}
+
+// Builds the request of j to the URL u, rendering the templates with
+// the data row, if any. It has no side effects other than those of the
+// template functions, e.g. seq.
+func (b *Boom) build(j *job, u string, data map[string]string) (*http.Request, error) {
+	j.rawBody = b.rawBody
+	if len(b.Urls) == 0 && b.urlTmpls[u] == nil && b.bodyTmpl == nil && len(b.headerTmpls) == 0 {
+		if b.baseReq != nil {
+			return cloneRequest(b.baseReq), nil
+		}
+		return b.Req.Request(), nil
+	}
+	opts := *b.Req
+	var err error
+	if opts.Url, err = render(b.urlTmpls[u], u, data); err != nil {
+		return nil, err
+	}
+	if opts.Body, err = render(b.bodyTmpl, opts.Body, data); err != nil {
+		return nil, err
+	}
+	if b.GzipBody && b.bodyTmpl != nil {
+		if err := b.compress(j, &opts); err != nil {
+			return nil, err
+		}
+	}
+	if len(b.headerTmpls) > 0 {
+		opts.Header = b.Req.Header.Clone()
+		for name, tmpls := range b.headerTmpls {
+			for k, t := range tmpls {
+				v := opts.Header[name][k]
+				if opts.Header[name][k], err = render(t, v, data); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return opts.Request(), nil
+}
+
+// Copies a request built once, with a new reader of its body, so that
+// the URL is not parsed again for each request.
+func cloneRequest(base *http.Request) *http.Request {
+	req := base.Clone(context.Background())
+	if base.GetBody != nil {
+		req.Body, _ = base.GetBody()
+	}
+	return req
+}
+
+// Returns the index of the step at the offset d since the start
+// of the run, or -1 if all the steps are over.
+func stepAt(steps []Step, d time.Duration) int {
+	var end time.Duration
+	for i, s := range steps {
+		end += s.Duration
+		if d < end {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the delay before the i-th worker starts, so that workers
+// are added linearly during the ramp-up period.
+func (b *Boom) rampDelay(i int) time.Duration {
+	if b.Ramp <= 0 || b.C < 2 {
+		return 0
+	}
+	return b.Ramp * time.Duration(i) / time.Duration(b.C-1)
+}
+
+// Maximum number of User-Agent headers whose requests are counted.
+const reportedUserAgents = 10
+
+// Size of the results channel per worker, and of the
+// jobs channel if the number of requests is known.
+const (
+	resultsPerWorker = 100
+	jobsPerWorker    = 2
+)
+
+// Creates the transport of the workers from the options.
+func (b *Boom) newTransport() *http.Transport {
+	// The server name follows the Host header, unless set.
+	serverName := b.SNI
+	if serverName == "" {
+		serverName = b.Req.OriginalHost
+		if host, _, err := net.SplitHostPort(serverName); err == nil {
+			serverName = host
+		}
+	}
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: b.AllowInsecure, ServerName: host},
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: b.AllowInsecure,
+			ServerName:         serverName,
+			RootCAs:            b.RootCAs,
+			MinVersion:         b.TLSMin,
+			MaxVersion:         b.TLSMax,
+			CipherSuites:       b.CipherSuites,
+		},
+	}
+	if b.ClientCert != nil {
+		tr.TLSClientConfig.Certificates = []tls.Certificate{*b.ClientCert}
+	}
+	tr.ResponseHeaderTimeout = b.HeaderTimeout
+	tr.MaxIdleConns = b.MaxIdleConns
+	tr.MaxIdleConnsPerHost = b.MaxIdlePerHost
+	if tr.MaxIdleConnsPerHost == 0 {
+		// Keeps a connection per worker, rather than 2.
+		tr.MaxIdleConnsPerHost = b.C
+	}
+	tr.IdleConnTimeout = b.IdleConnTimeout
+	if b.ExpectContinue {
+		tr.ExpectContinueTimeout = b.continueTimeout()
 	}
-	if b.ProxyAddr != "" {
-		tr.Dial = func(network string, addr string) (conn net.Conn, err error) {
-			return net.Dial(network, b.ProxyAddr)
+	tr.DisableKeepAlives = b.DisableKeepAlive
+	if b.Proxy != nil {
+		tr.Proxy = b.proxy
+		tr.OnProxyConnectResponse = checkProxyConnect
+	}
+	if b.Network != "" || len(b.LocalAddrs) > 0 || b.ConnectTimeout > 0 {
+		tr.DialContext = b.dial
+	}
+	if b.UnixSocket != "" {
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d := net.Dialer{Timeout: b.ConnectTimeout}
+			return d.DialContext(ctx, "unix", b.UnixSocket)
 		}
 	}
-	client := &http.Client{Transport: tr}
-	for req := range ch {
-		s := time.Now()
-		resp, err := client.Do(req)
-		code := 0
-		var size int64 = -1
-		if resp != nil {
-			code = resp.StatusCode
-			if resp.ContentLength > 0 {
-				size = resp.ContentLength
+	if b.HTTP2 {
+		tr.ForceAttemptHTTP2 = true
+	}
+	if b.H2C {
+		// Prior knowledge, http:// URLs use HTTP/2 without upgrade.
+		tr.Protocols = new(http.Protocols)
+		tr.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return tr
+}
+
+// Returns the time to wait for a 100 Continue response.
+func (b *Boom) continueTimeout() time.Duration {
+	if b.ContinueTimeout <= 0 {
+		return defaultContinueTimeout
+	}
+	return b.ContinueTimeout
+}
+
+// Dials the connections within the connect timeout, over the network if
+// one is forced, from the local addresses in turn if any.
+func (b *Boom) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if b.Network != "" {
+		network = b.Network
+	}
+	d := net.Dialer{Timeout: b.ConnectTimeout}
+	if n := uint64(len(b.LocalAddrs)); n > 0 {
+		i := atomic.AddUint64(&b.localNext, 1) - 1
+		d.LocalAddr = &net.TCPAddr{IP: b.LocalAddrs[i%n]}
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// Creates the clients of the workers, once per run. Each worker has its
+// own client. Over HTTP/1.1, all of them share a transport and its pool
+// of idle connections. With HTTP/2, or if connections are closed after a
+// number of requests, each client has its own transport so that each
+// worker keeps its own connection. If a number of connections is set,
+// workers share that many clients, each one with its own transport
+// multiplexing requests over a connection. The clients share Transport,
+// if set.
+func (b *Boom) newClients() []*http.Client {
+	n := b.C
+	if b.Conns > 0 {
+		n = b.Conns
+	}
+	var shared http.RoundTripper = b.Transport
+	if shared == nil && b.Conns == 0 && !b.HTTP2 && !b.H2C && b.RequestsPerConn == 0 {
+		shared = b.newTransport()
+	}
+	clients := make([]*http.Client, n)
+	for i := range clients {
+		tr := shared
+		if tr == nil {
+			tr = b.newTransport()
+		}
+		clients[i] = &http.Client{
+			Transport:     tr,
+			CheckRedirect: b.checkRedirect,
+			Timeout:       time.Duration(b.Timeout) * time.Second,
+		}
+	}
+	return clients
+}
+
+// Context key of the redirect count of a request.
+type redirectsKey struct{}
+
+// Stops at the first response if redirects are not followed, otherwise
+// follows up to 10 redirects as the default client does, counting them.
+func (b *Boom) checkRedirect(req *http.Request, via []*http.Request) error {
+	if b.NoRedirects {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if n, ok := req.Context().Value(redirectsKey{}).(*int); ok {
+		*n = len(via)
+	}
+	return nil
+}
+
+// Runs the jobs of ch. The limiter, if any, is shared by all the workers,
+// unless the rate limit applies per worker. Each worker has its own
+// cookie jar, if any. over is closed once all the jobs are handed out.
+func (b *Boom) worker(i int, client *http.Client, ch chan *job, over chan struct{}, lim *limiter) {
+	perWorker := b.Qps > 0 && b.QpsPerWorker
+	if perWorker {
+		lim = newLimiter(b.Qps)
+		lim.catchUp = b.CorrectLatency
+	}
+	base := client
+	if b.CookieJar {
+		client = withJar(base)
+	}
+	var (
+		// Entry of the next job, and variables extracted in the iteration.
+		pos  int
+		vars map[string]string
+	)
+	for sent := 1; ; sent++ {
+		// End of the think time, if any.
+		var thought time.Time
+		if sent > 1 && b.Think > 0 {
+			if !b.think(ch, over) {
+				return
+			}
+			thought = time.Now()
+		}
+		// The slot is awaited before the job is received, so that
+		// the worker exits once jobs are over.
+		var slot time.Time
+		if perWorker {
+			var ok bool
+			if slot, ok = lim.waitSlot(b.stop, nil); !ok {
+				return
+			}
+		}
+		j, ok := <-ch
+		if !ok || b.stopped() {
+			return
+		}
+		if perWorker && b.CorrectLatency {
+			j.intended = slot
+		}
+		if !j.intended.IsZero() && j.intended.Before(thought) {
+			// The request is not due before the think time is over,
+			// the pause is not part of the corrected latency.
+			j.intended = thought
+		}
+		if len(b.Entries) > 0 {
+			// The worker goes through the sequence on its own.
+			if pos %= len(b.Entries); pos == 0 {
+				if b.IterationJar {
+					client = withJar(base)
+				}
+				if b.entryTmpls != nil {
+					vars = make(map[string]string)
+				}
 			}
-			// consume the whole body
+			b.setEntry(j, pos, vars)
+			pos++
+		}
+		b.closeConn(j, sent)
+		j.worker = i
+		b.do(client, j, lim)
+		if j.abort {
+			// The next job starts the sequence over.
+			pos = 0
+		}
+	}
+}
+
+// Waits for the think time of a worker before its next request. Returns
+// false if the run is stopped, or if no job is left once they are all
+// handed out, so that the run does not last longer than its requests.
+func (b *Boom) think(ch chan *job, over chan struct{}) bool {
+	t := time.NewTimer(b.Think)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			return true
+		case <-b.stop:
+			return false
+		case <-over:
+			if len(ch) == 0 {
+				return false
+			}
+			// The jobs left are sent after the think time.
+			over = nil
+		}
+	}
+}
+
+// Sets the User-Agent header of the request of the job, if one was
+// picked. The request may be that of an entry, set by the worker.
+func (j *job) setUserAgent() {
+	if j.userAgent != "" && j.req != nil {
+		j.req.Header.Set("User-Agent", j.userAgent)
+	}
+}
+
+// Returns a copy of the client with a new cookie jar. The client may be
+// shared, the copy uses the same transport.
+func withJar(client *http.Client) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	c := *client
+	c.Jar = jar
+	return &c
+}
+
+// Sets the ID header of the request of the job, if requested. IDs are
+// unique across the workers, as the sequence numbers of the jobs are.
+func (b *Boom) setRequestID(j *job) {
+	if b.RequestIDHeader == "" || j.req == nil {
+		return
+	}
+	if b.RequestIDSeq {
+		j.requestID = b.idPrefix + "-" + strconv.Itoa(j.seq+1)
+	} else {
+		j.requestID = uuid()
+	}
+	j.req.Header.Set(b.RequestIDHeader, j.requestID)
+}
+
+// Marks the request of the job to close its connection if it is the
+// n-th one of its client, counting from 1, and RequestsPerConn is hit.
+func (b *Boom) closeConn(j *job, n int) {
+	if b.RequestsPerConn > 0 && j.req != nil && n%b.RequestsPerConn == 0 {
+		j.req.Close = true
+	}
+}
+
+// Makes the request of the job, retrying it if needed, and sends the
+// result of the last attempt. Retries wait for a slot of the limiter,
+// if any, so that they count towards the rate limit.
+func (b *Boom) do(client *http.Client, j *job, lim *limiter) {
+	var (
+		res     *result
+		retries []string
+	)
+	j.setUserAgent()
+	b.setRequestID(j)
+	for attempt := 0; ; attempt++ {
+		if j.err != nil {
+			res = newResult()
+			res.err = j.err
+		} else {
+			res = b.send(client, j, attempt)
+		}
+		res.duration = time.Now().Sub(res.start)
+		if !j.intended.IsZero() {
+			res.corrected = res.start.Add(res.duration).Sub(j.intended)
+			if res.corrected < res.duration {
+				res.corrected = res.duration
+			}
+		}
+		reason := b.retryReason(j, res)
+		if reason == "" || attempt >= b.Retries || !b.backoff(attempt) {
+			break
+		}
+		if lim != nil && !lim.wait(b.stop, nil) {
+			break
+		}
+		if res.sample != nil {
+			// Only the last attempt is saved.
+			b.saver.release(res.sample)
+		}
+		retries = append(retries, reason)
+	}
+	if len(j.extract) > 0 {
+		j.extractFrom(res)
+	}
+	if res.err != nil && b.ctx.Err() != nil {
+		// Cancelled once the grace period or the deadline expired,
+		// not part of the report.
+		atomic.AddInt64(&b.cancelled, 1)
+		if res.sample != nil {
+			b.saver.release(res.sample)
+		}
+		return
+	}
+	if b.prog != nil {
+		b.prog.increment(res.err)
+	}
+	res.url = j.url
+	res.seq = j.seq
+	res.worker = j.worker
+	res.entry = j.entry
+	res.path = j.path
+	res.userAgent = j.userAgent
+	res.requestID = j.requestID
+	res.compress = j.compress
+	if res.sent > 0 {
+		res.rawSent = j.rawBody
+	}
+	res.retries = retries
+	if res.sample != nil {
+		res.sample.seq = j.seq
+		b.saver.save(res.sample)
+	}
+	b.results <- res
+}
+
+// Signs the request of the job if needed, sends it and reads the
+// response, checking the body if it is asserted on or keeping it if
+// values are extracted from it. Retries are sent with a copy of the
+// request and a new body. The result starts once the request is signed
+// and, if a Digest challenge was answered, once the answer is sent.
+func (b *Boom) send(client *http.Client, j *job, attempt int) *result {
+	req := j.req
+	res := newResult()
+	var tr tracer
+	ctx := context.WithValue(tr.context(b.ctx), redirectsKey{}, &res.redirects)
+	if attempt > 0 {
+		if req, res.err = resend(ctx, req); res.err != nil {
+			return res
+		}
+	} else {
+		req = req.WithContext(ctx)
+		// Retries keep the parameter of the first attempt.
+		b.bustCache(req)
+	}
+	if b.AWS != nil {
+		// Signed as of now, retries are signed again.
+		if res.err = b.AWS.sign(req, res.start); res.err != nil {
+			return res
+		}
+		now := time.Now()
+		res.signing = now.Sub(res.start)
+		res.start = now
+	}
+	if b.digest != nil {
+		b.digest.authorize(req)
+	}
+	if b.metrics != nil {
+		atomic.AddInt64(&b.metrics.inflight, 1)
+		defer atomic.AddInt64(&b.metrics.inflight, -1)
+	}
+	if b.debug != nil {
+		b.debug.req = req
+	}
+	size := req.ContentLength
+	if b.ExpectContinue && req.Body != nil && req.Body != http.NoBody {
+		req.Header.Set("Expect", "100-continue")
+	}
+	if b.Chunked {
+		b.chunk(req)
+	}
+	resp, err := client.Do(req)
+	tr.gotResponse()
+	if err == nil && b.digest != nil && resp.StatusCode == http.StatusUnauthorized {
+		if c := parseChallenges(resp); c != nil {
+			// New or stale challenge, answered once.
 			io.Copy(ioutil.Discard, resp.Body)
-			// cleanup body, so the socket can be reusable
 			resp.Body.Close()
+			b.digest.setChallenge(c)
+			res.challenged = true
+			if req, res.err = resend(ctx, req); res.err != nil {
+				return res
+			}
+			b.digest.authorize(req)
+			if b.debug != nil {
+				b.debug.req = req
+			}
+			if b.Chunked {
+				b.chunk(req)
+			}
+			res.start = time.Now()
+			resp, err = client.Do(req)
+			tr.gotResponse()
 		}
-		if b.bar != nil {
-			b.bar.Increment()
+	}
+	res.err = err
+	var failure *Failure
+	if !b.NoFirstFailure && b.ctx.Err() == nil && (resp == nil || !b.rpt.isSuccess(resp.StatusCode)) &&
+		atomic.CompareAndSwapInt32(&b.failed, 0, 1) {
+		failure = newFailure(req, resp, err)
+		failure.RequestID = j.requestID
+		b.failure = failure
+	}
+	if resp != nil {
+		res.statusCode = resp.StatusCode
+		res.proto = resp.Proto
+		if size > 0 {
+			res.sent = size
 		}
-		b.results <- &result{
-			statusCode:    code,
-			duration:      time.Now().Sub(s),
-			err:           err,
-			contentLength: size,
+		res.setCookie = len(resp.Header["Set-Cookie"]) > 0
+		if b.saver != nil {
+			res.sample = b.saver.take(resp)
 		}
+		if b.NoBodyRead {
+			// The connection is closed along with the unread body.
+			if resp.ContentLength > 0 {
+				res.contentLength = resp.ContentLength
+			}
+		} else {
+			var r io.Reader = resp.Body
+			if b.MaxBody > 0 {
+				r = io.LimitReader(resp.Body, b.MaxBody)
+			}
+			if res.sample != nil {
+				r = io.TeeReader(r, &res.sample.body)
+			}
+			if failure != nil {
+				r = io.TeeReader(r, &failure.body)
+			}
+			if b.debug != nil {
+				r = io.TeeReader(r, &b.debug.body)
+			}
+			if len(j.extract) > 0 {
+				res.body = &capped{max: extractBodySize}
+				r = io.TeeReader(r, res.body)
+			}
+			body := &countingReader{r: r}
+			if b.AssertBody != nil {
+				res.assertFailed, res.snippet = checkBody(b.AssertBody, body)
+			}
+			if b.GraphQLErrors && b.rpt.isSuccess(resp.StatusCode) {
+				res.err = checkGraphQL(body)
+			}
+			// consume the whole body, the request fails if it times out
+			var netErr net.Error
+			if _, err := io.Copy(ioutil.Discard, body); errors.As(err, &netErr) && netErr.Timeout() {
+				res.err = err
+			}
+			res.contentLength = body.n
+			if b.MaxBody == 0 && resp.ContentLength > body.n {
+				// The body ended before its declared length, which is
+				// what the server meant to send.
+				res.contentLength = resp.ContentLength
+			}
+			if failure != nil {
+				failure.Body = string(failure.body.buf)
+			}
+			if b.MaxBody > 0 && body.n == b.MaxBody {
+				// The body goes on if a byte is left, the connection
+				// is then closed along with it.
+				var p [1]byte
+				n, _ := resp.Body.Read(p[:])
+				res.truncated = n > 0
+			}
+		}
+		// cleanup body, so the socket can be reusable
+		resp.Body.Close()
+		res.timings = tr.timings(time.Now())
+		res.continueTimeout = b.ExpectContinue && tr.continueTimedOut(b.continueTimeout())
+	}
+	if b.debug != nil {
+		b.debug.resp = resp
+		b.debug.remote = tr.remoteIP()
+	}
+	res.tlsVersion, res.cipherSuite = tr.tlsState()
+	res.family = tr.family()
+	res.dials = tr.dialed()
+	if len(b.LocalAddrs) > 0 {
+		res.localAddr = tr.localIP()
+	}
+	if b.DNSEach {
+		res.serverAddr = tr.remoteIP()
+	}
+	return res
+}
+
+// Makes the request unique to caches with a random CacheBust query
+// parameter, after those of its URL, and a no-cache header if NoCache
+// is set.
+func (b *Boom) bustCache(req *http.Request) {
+	if b.CacheBust != "" {
+		q := url.QueryEscape(b.CacheBust) + "=" + uuid()
+		if req.URL.RawQuery != "" {
+			q = req.URL.RawQuery + "&" + q
+		}
+		req.URL.RawQuery = q
+	}
+	if b.NoCache {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+}
+
+// Streams the body of the request through a pipe, ChunkSize bytes at
+// a time, so that it is sent with chunked transfer encoding. The pipe
+// is closed by the transport along with the body, even if it fails.
+func (b *Boom) chunk(req *http.Request) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	size := b.ChunkSize
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	body := req.Body
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		buf := make([]byte, size)
+		for {
+			n, err := body.Read(buf)
+			if n > 0 {
+				if _, err := pw.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	// An unknown length, the body is sent chunked.
+	req.Body, req.ContentLength = pr, 0
+}
+
+// countingReader counts the bytes read from r, i.e. the decoded bytes of
+// a body whether it is chunked or compressed.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Returns a copy of the request with a new body, to send it again.
+func resend(ctx context.Context, req *http.Request) (*http.Request, error) {
+	r := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// Returns why the attempt should be retried, or an empty string if
+// it should not: connection-level failures and, if requested, 5xx
+// responses are retried.
+func (b *Boom) retryReason(j *job, res *result) string {
+	if b.Retries == 0 || j.err != nil || b.ctx.Err() != nil {
+		return ""
+	}
+	var gqlErr *graphqlError
+	if errors.As(res.err, &gqlErr) {
+		// The server replied, the query is not retried.
+		return ""
+	}
+	if res.err != nil {
+		return categoryName(classifyError(res.err))
+	}
+	if b.Retry5xx && res.statusCode >= 500 && res.statusCode < 600 {
+		return fmt.Sprintf("status %d", res.statusCode)
+	}
+	return ""
+}
+
+// Waits before the retry following the given attempt, the backoff
+// doubles with each attempt. Returns false if the run is stopped.
+func (b *Boom) backoff(attempt int) bool {
+	if b.stopped() {
+		return false
+	}
+	if b.RetryBackoff <= 0 {
+		return true
+	}
+	t := time.NewTimer(b.RetryBackoff << uint(attempt))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-b.stop:
+		return false
 	}
 }
 
-func (b *Boom) run() {
+// Makes the requests and computes the report. Returns the error of the
+// results file, if any.
+func (b *Boom) run() (err error) {
+	start := time.Now()
+	b.rpt.start = start
+	cpu := processCPU()
+	if b.recorder != nil {
+		b.recorder.begin(start)
+	}
+	if b.prog != nil {
+		b.prog.Start()
+	}
+	var deadline <-chan time.Time
+	if b.Duration > 0 {
+		deadline = time.After(b.Duration)
+	}
+	if b.MaxDuration > 0 {
+		t := time.AfterFunc(b.MaxDuration, b.expire)
+		defer t.Stop()
+	}
+	if b.Rate > 0 {
+		b.runOpen(start, deadline)
+	} else {
+		b.runClosed(start, deadline)
+	}
+	b.rpt.FirstFailure = b.failure
+	b.rpt.DeadlineHit = atomic.LoadInt32(&b.expired) == 1
+	b.rpt.Interrupted = b.stopped() && !b.rpt.DeadlineHit && atomic.LoadInt32(&b.aborted) == 0
+	b.rpt.Cancelled = int(atomic.LoadInt64(&b.cancelled))
+	// All the requests are done, no more results will be sent.
+	close(b.results)
+	if b.saver != nil {
+		b.saver.close()
+		b.rpt.Saved, b.rpt.saveErr = b.saver.saved, b.saver.err
+		b.rpt.SaveDropped = b.saver.dropped
+	}
+	if b.prog != nil {
+		if b.rpt.live != nil {
+			// The summary of the last interval is printed first.
+			<-b.rpt.done
+		}
+		b.prog.Finish()
+	}
+	total := time.Now().Sub(start)
+	b.rpt.SelfCPU = (processCPU() - cpu).Seconds()
+	if b.recorder != nil {
+		// All the results are collected once finalize returns, the
+		// file is closed beforehand so that its errors are reported.
+		<-b.rpt.done
+		if err = b.recorder.close(total); err != nil {
+			err = fmt.Errorf("recording the results failed, %v", err)
+		}
+	}
+	if b.hook != nil {
+		<-b.rpt.done
+		b.hook.close()
+		b.rpt.DroppedResults = b.hook.dropped
+	}
+	b.rpt.finalize(total)
+	return err
+}
+
+// Runs the closed model, each worker waits for a response
+// before sending its next request.
+func (b *Boom) runClosed(start time.Time, deadline <-chan time.Time) {
 	var wg sync.WaitGroup
 	wg.Add(b.C)
 
-	var throttle <-chan time.Time
-	if b.Qps > 0 {
-		throttle = time.Tick(time.Duration(1e6/(b.Qps)) * time.Microsecond)
+	// The rate limit is global, unless it applies per worker.
+	var (
+		lim  *limiter
+		step = -1
+	)
+	if b.Qps > 0 && !b.QpsPerWorker {
+		lim = newLimiter(b.Qps)
+	} else if len(b.Steps) > 0 {
+		// Created upfront so that the workers share it for retries.
+		lim = newLimiter(b.Steps[0].Qps)
+		step = 0
+	}
+	if lim != nil {
+		lim.catchUp = b.CorrectLatency
 	}
 
-	start := time.Now()
-	jobs := make(chan *http.Request, b.N)
+	var jobs chan *job
+	if b.Duration > 0 {
+		// Requests are only handed out when a worker is ready, so that
+		// none of them is queued past the deadline.
+		jobs = make(chan *job)
+	} else {
+		// A few jobs per worker are queued ahead, rather than all of
+		// them, each one holding its request.
+		jobs = make(chan *job, b.C*jobsPerWorker)
+	}
+	over := make(chan struct{})
 	// Start workers.
+	clients := b.newClients()
 	for i := 0; i < b.C; i++ {
-		go func() {
-			b.worker(jobs)
-			wg.Done()
-		}()
+		go func(i int, client *http.Client) {
+			defer wg.Done()
+			if d := b.rampDelay(i); d > 0 {
+				select {
+				case <-time.After(d):
+				case <-b.stop:
+					return
+				}
+			}
+			b.worker(i, client, jobs, over, lim)
+		}(i, clients[i%len(clients)])
 	}
 
-	// Start sending jobs to the workers.
-	for i := 0; i < b.N; i++ {
-		if b.Qps > 0 {
-			<-throttle
+	// Start sending jobs to the workers, until N requests are sent, the
+	// deadline is hit or the run is stopped. In-flight requests at the
+	// deadline are not cancelled, they complete and are part of the report.
+loop:
+	for i := 0; b.Duration > 0 || i < b.N; i++ {
+		j := b.newJob(i)
+		if j == nil {
+			break
+		}
+		if len(b.Steps) > 0 {
+			// Move on to the rate of the current step.
+			if s := stepAt(b.Steps, time.Since(start)); s != step && s >= 0 {
+				step = s
+				lim.setRate(b.Steps[s].Qps)
+			}
+		}
+		if lim != nil {
+			slot, ok := lim.waitSlot(b.stop, deadline)
+			if !ok {
+				break
+			}
+			if b.CorrectLatency {
+				j.intended = slot
+			}
+		}
+		select {
+		case jobs <- j:
+		case <-deadline:
+			break loop
+		case <-b.stop:
+			break loop
 		}
-		jobs <- b.Req.Request()
 	}
 	close(jobs)
-
+	close(over)
 	wg.Wait()
-	if b.bar != nil {
-		b.bar.Finish()
+}
+
+// Runs the open model, requests are sent at a constant rate whether
+// previous ones completed or not. At most C requests are in flight,
+// the requests due while at that cap are skipped.
+func (b *Boom) runOpen(start time.Time, deadline <-chan time.Time) {
+	var (
+		wg       sync.WaitGroup
+		inflight int64
+		// Only updated by this goroutine.
+		peak int64
+	)
+	sem := make(chan struct{}, b.C)
+	clients := b.newClients()
+	interval := time.Second / time.Duration(b.Rate)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+loop:
+	for i := 0; b.Duration > 0 || i < b.N; i++ {
+		// Late requests are sent right away to catch up with the schedule.
+		if d := time.Until(start.Add(time.Duration(i) * interval)); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-timer.C:
+			case <-deadline:
+				break loop
+			case <-b.stop:
+				break loop
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			b.rpt.Skipped++
+			continue
+		}
+		j := b.newJob(i)
+		if j == nil {
+			<-sem
+			break
+		}
+		if n := atomic.AddInt64(&inflight, 1); n > peak {
+			peak = n
+		}
+		// Each client gets every len(clients)-th request.
+		b.closeConn(j, i/len(clients)+1)
+		j.worker = i % len(clients)
+		if b.CorrectLatency {
+			j.intended = start.Add(time.Duration(i) * interval)
+		}
+		wg.Add(1)
+		go func(client *http.Client) {
+			defer wg.Done()
+			b.do(client, j, nil)
+			atomic.AddInt64(&inflight, -1)
+			<-sem
+		}(clients[i%len(clients)])
 	}
-	b.rpt.finalize(time.Now().Sub(start))
+	wg.Wait()
+	b.rpt.Rate = b.Rate
+	b.rpt.PeakInflight = int(peak)
 }
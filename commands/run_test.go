@@ -15,9 +15,25 @@
 package commands
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -46,11 +62,1366 @@ func TestN(t *testing.T) {
 	}
 }
 
+func TestCorrectLatency(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// The second request stalls the only worker, the next ones are
+		// sent late.
+		if atomic.AddInt64(&count, 1) == 2 {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:              10,
+		C:              1,
+		Qps:            20,
+		CorrectLatency: true,
+		Writer:         &buf,
+	}
+	rpt := boom.Run()
+	if len(rpt.CorrectedLatencyDistribution) == 0 {
+		t.Fatalf("Expected the corrected latencies, %v is found", rpt.CorrectedLatencyDistribution)
+	}
+	p50, corrected := rpt.LatencyDistribution[2], rpt.CorrectedLatencyDistribution[2]
+	if p50.Percentage != 50 || p50.Latency > 0.1 || corrected.Latency < 0.2 {
+		t.Errorf("Expected a corrected p50 over 0.2 secs and a raw one under 0.1 secs, %v and %v are found", corrected, p50)
+	}
+	// The stalled request itself is on time.
+	if max := rpt.CorrectedLatencyDistribution[len(rpt.CorrectedLatencyDistribution)-1]; max.Latency < 0.5 || max.Latency > 1 {
+		t.Errorf("Expected a corrected p99 of about 0.5 secs, %v is found", max)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Latency distribution, uncorrected (service time):") || !strings.Contains(out, "Latency distribution, corrected (from the intended start):") {
+		t.Errorf("Expected both latency distributions, %q is found", out)
+	}
+
+	boom = &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      2,
+		C:      1,
+		Qps:    20,
+		Writer: ioutil.Discard,
+	}
+	if rpt := boom.Run(); rpt.CorrectedLatencyDistribution != nil {
+		t.Errorf("Expected no corrected latencies by default, %v is found", rpt.CorrectedLatencyDistribution)
+	}
+}
+
+func TestNoDroppedResults(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Fail every tenth request to exercise the error path.
+		if atomic.AddInt64(&count, int64(1))%10 == 0 {
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	for i := 0; i < 5; i++ {
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:      500,
+			C:      100,
+			Output: "quiet",
+		}
+		rpt := boom.Run()
+		total := len(rpt.Lats)
+		for _, n := range rpt.Errors {
+			total += n
+		}
+		if total != 500 {
+			t.Errorf("Expected 500 results, found %v", total)
+		}
+	}
+}
+
+func TestLargeN_BoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("5M requests against a server are slow")
+	}
+	const n = 5000000
+	var count int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:           n,
+		C:           8,
+		StreamStats: true,
+		Output:      "quiet",
+		Writer:      ioutil.Discard,
+	}
+	// The heap is sampled during the run, it should not grow with N.
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var ms runtime.MemStats
+		tick := time.NewTicker(100 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				runtime.ReadMemStats(&ms)
+				if ms.HeapAlloc > peak {
+					peak = ms.HeapAlloc
+				}
+			}
+		}
+	}()
+	rpt, err := boom.RunContext(context.Background())
+	close(done)
+	<-sampled
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != n || rpt.latCount != n {
+		t.Errorf("Expected %v requests and results, %v and %v are found", n, count, rpt.latCount)
+	}
+	if peak > 64<<20 {
+		t.Errorf("Expected a heap under 64MB during the run, %vMB is found", peak>>20)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, int64(1))
+		time.Sleep(10 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		C:        2,
+		Duration: 200 * time.Millisecond,
+		Output:   "quiet",
+	}
+	s := time.Now()
+	rpt := boom.Run()
+	if d := time.Since(s); d < 200*time.Millisecond || d > time.Second {
+		t.Errorf("Expected the run to last about 200ms, %v is found", d)
+	}
+	if count < 10 {
+		t.Errorf("Expected to boom at least 10 times, found %v", count)
+	}
+	if int64(len(rpt.Lats)) != count {
+		t.Errorf("Expected %v latencies, found %v", count, len(rpt.Lats))
+	}
+}
+
+func TestInterval(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var status bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		C:        2,
+		Duration: 350 * time.Millisecond,
+		Interval: 100 * time.Millisecond,
+		Progress: &status,
+		Output:   "json",
+		Writer:   ioutil.Discard,
+	}
+	rpt := boom.Run()
+	// Three full intervals and the last partial one.
+	if n := strings.Count(status.String(), "\r\033[Klast "); n < 3 || n > 4 {
+		t.Errorf("Expected a summary per interval above the progress line, %q is found", status.String())
+	}
+	if n := len(rpt.TimeSeries); n < 3 || n > 4 {
+		t.Errorf("Expected the intervals in the time series, %v are found", n)
+	}
+}
+
+func TestAbortErrors(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// The server falls over after its first requests.
+		if atomic.AddInt64(&count, 1) > 20 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		C:              2,
+		Duration:       10 * time.Second,
+		Non2xxErrors:   true,
+		AbortErrorRate: 50,
+		AbortWindow:    20,
+		Writer:         &buf,
+	}
+	s := time.Now()
+	rpt := boom.Run()
+	if d := time.Since(s); d > 3*time.Second {
+		t.Errorf("Expected the run to be aborted early, it lasted %v", d)
+	}
+	if rpt.Aborted == nil || rpt.Interrupted {
+		t.Fatalf("Expected the run to be aborted rather than interrupted, %v and %v are found", rpt.Aborted, rpt.Interrupted)
+	}
+	if want := "% errors over the last 20 requests"; !strings.HasSuffix(rpt.Aborted.Reason, want) {
+		t.Errorf("Expected the reason to end with %q, %q is found", want, rpt.Aborted.Reason)
+	}
+	if !strings.Contains(buf.String(), "\nAborted: error threshold exceeded at t=") {
+		t.Errorf("Expected the abort to be printed, %q is found", buf.String())
+	}
+
+	boom = &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:           50,
+		C:           2,
+		AbortErrors: 1000,
+		Writer:      ioutil.Discard,
+	}
+	if rpt := boom.Run(); rpt.Aborted != nil {
+		t.Errorf("Expected no abort below the threshold, %v is found", rpt.Aborted)
+	}
+}
+
+func TestThink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      10,
+		C:      2,
+		Think:  50 * time.Millisecond,
+		Writer: &buf,
+	}
+	s := time.Now()
+	rpt := boom.Run()
+	// Each worker makes 5 requests, with 4 pauses in between and none
+	// after its last one.
+	if d := time.Since(s); d < 200*time.Millisecond || d > 400*time.Millisecond {
+		t.Errorf("Expected the run to last about 200ms, %v is found", d)
+	}
+	if len(rpt.Lats) != 10 || rpt.WorkerRPS <= 0 || rpt.WorkerRPS > 25 {
+		t.Errorf("Expected 10 requests at most 20 req/s per worker, %v and %v are found", len(rpt.Lats), rpt.WorkerRPS)
+	}
+	if !strings.Contains(buf.String(), "  Think time:\t50ms, ") {
+		t.Errorf("Expected the think time to be printed, %q is found", buf.String())
+	}
+
+	// The pauses are not part of the corrected latencies, whether the
+	// rate limit is shared or per worker.
+	for _, perWorker := range []bool{false, true} {
+		boom = &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:              10,
+			C:              1,
+			Qps:            100,
+			QpsPerWorker:   perWorker,
+			Think:          100 * time.Millisecond,
+			CorrectLatency: true,
+			Output:         "quiet",
+		}
+		rpt = boom.Run()
+		if n := len(rpt.CorrectedLatencyDistribution); n == 0 {
+			t.Fatalf("Expected the corrected latencies")
+		}
+		for _, d := range rpt.CorrectedLatencyDistribution {
+			if d.Latency > 0.05 {
+				t.Errorf("Expected corrected latencies under 50ms with a per-worker limit %v, %v is found", perWorker, d)
+			}
+		}
+	}
+
+	// The pauses end with the run.
+	boom = &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		C:        2,
+		Duration: 200 * time.Millisecond,
+		Think:    time.Second,
+		Output:   "quiet",
+	}
+	s = time.Now()
+	rpt = boom.Run()
+	if d := time.Since(s); d > 600*time.Millisecond {
+		t.Errorf("Expected the run to last about 200ms, %v is found", d)
+	}
+	if len(rpt.Lats) != 2 {
+		t.Errorf("Expected a request per worker, %v are found", len(rpt.Lats))
+	}
+}
+
+func TestStop(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      1000,
+		C:      2,
+		Writer: &buf,
+	}
+	time.AfterFunc(100*time.Millisecond, boom.Stop)
+	rpt := boom.Run()
+	if !rpt.Interrupted {
+		t.Errorf("Expected the run to be interrupted")
+	}
+	if len(rpt.Lats) == 0 || len(rpt.Lats) >= 1000 {
+		t.Errorf("Expected some but not all of the requests to complete, found %v", len(rpt.Lats))
+	}
+	if len(rpt.Errors) != 0 {
+		t.Errorf("Expected no errors, found %v", rpt.Errors)
+	}
+	if !strings.Contains(buf.String(), fmt.Sprintf("Interrupted after %d of 1000 requests.", len(rpt.Lats))) {
+		t.Errorf("Expected the interruption to be printed")
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:           10,
+		C:           2,
+		MaxDuration: 100 * time.Millisecond,
+		Writer:      &buf,
+	}
+	s := time.Now()
+	rpt := boom.Run()
+	if d := time.Since(s); d > time.Second {
+		t.Errorf("Expected the run to stop at the deadline, %v is found", d)
+	}
+	if !rpt.DeadlineHit || rpt.Interrupted {
+		t.Errorf("Expected the deadline to be hit, not an interruption")
+	}
+	if rpt.Cancelled != 2 || len(rpt.Lats) != 0 || len(rpt.Errors) != 0 {
+		t.Errorf("Expected the 2 in-flight requests to be cancelled, %v and %v are found", rpt.Cancelled, rpt.Errors)
+	}
+	if !strings.Contains(buf.String(), "Deadline of 100ms hit after 0 of 10 requests, 2 in-flight requests cancelled.") {
+		t.Errorf("Expected the deadline to be printed, %v is found", buf.String())
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:             10,
+		C:             5,
+		Conns:         1,
+		HTTP2:         true,
+		AllowInsecure: true,
+		Output:        "quiet",
+	}
+	rpt := boom.Run()
+	if rpt.ProtocolDist["HTTP/2.0"] != 10 {
+		t.Errorf("Expected 10 HTTP/2.0 responses, found %v", rpt.ProtocolDist)
+	}
+}
+
+func TestHTTP2_ConnPerWorker(t *testing.T) {
+	var accepted int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt64(&accepted, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		C:             8,
+		Duration:      300 * time.Millisecond,
+		HTTP2:         true,
+		AllowInsecure: true,
+		Output:        "quiet",
+	}
+	rpt := boom.Run()
+	// Each worker multiplexes its requests over a connection of its own.
+	if n := atomic.LoadInt64(&accepted); n != 8 || rpt.NewConns != 8 {
+		t.Errorf("Expected a connection per worker, %v accepted and %v dialed are found", n, rpt.NewConns)
+	}
+	if rpt.ProtocolDist["HTTP/2.0"] == 0 {
+		t.Errorf("Expected HTTP/2.0 responses, found %v", rpt.ProtocolDist)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	var proto string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      1,
+		C:      1,
+		H2C:    true,
+		Output: "quiet",
+	}
+	rpt := boom.Run()
+	if proto != "HTTP/2.0" || rpt.ProtocolDist["HTTP/2.0"] != 1 {
+		t.Errorf("Expected a HTTP/2.0 request, found %v", proto)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	var host string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}
+	sock := filepath.Join(t.TempDir(), "boom.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	server.Listener = ln
+	server.Start()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method:       "GET",
+			Url:          "http://app.local/",
+			OriginalHost: "app.local",
+		},
+		N:          10,
+		C:          2,
+		UnixSocket: sock,
+		Writer:     &buf,
+	}
+	boom.Run()
+	if host != "app.local" {
+		t.Errorf("Host is expected to be app.local, %v is found", host)
+	}
+	if out := buf.String(); !strings.Contains(out, "Summary:") || !strings.Contains(out, "[200]\t10 responses") {
+		t.Errorf("Expected a full report, found %v", out)
+	}
+}
+
+func TestUrls(t *testing.T) {
+	var count1, count2 int64
+	server1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count1, int64(1))
+	}))
+	defer server1.Close()
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count2, int64(1))
+	}))
+	defer server2.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+		},
+		Urls:   []string{server1.URL + "/a", server2.URL + "/b"},
+		N:      10,
+		C:      2,
+		Output: "quiet",
+	}
+	rpt := boom.Run()
+	if count1 != 5 || count2 != 5 {
+		t.Errorf("Expected to boom 5 times each URL, found %v and %v", count1, count2)
+	}
+	if rpt.UrlDist[server1.URL+"/a"] != 5 || rpt.UrlDist[server2.URL+"/b"] != 5 {
+		t.Errorf("Expected 5 requests per URL, found %v", rpt.UrlDist)
+	}
+}
+
+func TestRamp(t *testing.T) {
+	var inflight, max int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inflight, 1)
+		for {
+			m := atomic.LoadInt64(&max)
+			if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt64(&inflight, -1)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		C:        4,
+		Duration: 400 * time.Millisecond,
+		Ramp:     300 * time.Millisecond,
+		Output:   "quiet",
+	}
+	if d := boom.rampDelay(3); d != 300*time.Millisecond {
+		t.Errorf("Expected the last worker to start at the end of the ramp, %v is found", d)
+	}
+	rpt := boom.Run()
+	if rpt.RampRequests == 0 || rpt.RampRequests >= len(rpt.Lats) {
+		t.Errorf("Expected some of the requests during the ramp, found %v of %v", rpt.RampRequests, len(rpt.Lats))
+	}
+	if max != 4 {
+		t.Errorf("Expected 4 concurrent requests after the ramp, found %v", max)
+	}
+}
+
+func TestSteps_Run(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		C:      2,
+		Steps:  []Step{{20, 500 * time.Millisecond}, {100, 500 * time.Millisecond}},
+		Output: "quiet",
+	}
+	rpt := boom.Run()
+	if len(rpt.Steps) != 2 {
+		t.Fatalf("Expected 2 steps, %v are found", len(rpt.Steps))
+	}
+	if n := rpt.Steps[0].Count; n < 7 || n > 12 {
+		t.Errorf("Expected about 10 requests in the first step, found %v", n)
+	}
+	if n := rpt.Steps[1].Count; n < 40 || n > 55 {
+		t.Errorf("Expected about 50 requests in the second step, found %v", n)
+	}
+}
+
+func TestRate(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Slower than the arrival interval, requests overlap.
+		time.Sleep(50 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      40,
+		C:      100,
+		Rate:   200,
+		Output: "quiet",
+	}
+	s := time.Now()
+	rpt := boom.Run()
+	if d := time.Since(s); d > 500*time.Millisecond {
+		t.Errorf("Expected the run to last about 250ms, %v is found", d)
+	}
+	if len(rpt.Lats) != 40 || rpt.Skipped != 0 {
+		t.Errorf("Expected 40 requests and none skipped, found %v and %v", len(rpt.Lats), rpt.Skipped)
+	}
+	if rpt.PeakInflight < 5 {
+		t.Errorf("Expected overlapping requests, peak in-flight is %v", rpt.PeakInflight)
+	}
+
+	boom = &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      40,
+		C:      1,
+		Rate:   200,
+		Output: "quiet",
+	}
+	rpt = boom.Run()
+	if rpt.PeakInflight != 1 || rpt.Skipped == 0 || len(rpt.Lats)+rpt.Skipped != 40 {
+		t.Errorf("Expected requests to be skipped at the cap, found %v skipped, peak %v", rpt.Skipped, rpt.PeakInflight)
+	}
+}
+
 func TestQps(t *testing.T) {
 	var wg sync.WaitGroup
 	var count int64
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		atomic.AddInt64(&count, int64(1))
+		atomic.AddInt64(&count, int64(1))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:   20,
+		C:   2,
+		Qps: 1,
+	}
+	wg.Add(1)
+	time.AfterFunc(time.Second, func() {
+		if count > 1 {
+			t.Errorf("Expected to boom 1 times, found %v", count)
+		}
+		wg.Done()
+	})
+	go boom.Run()
+	wg.Wait()
+}
+
+func TestQps_Global(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, int64(1))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      400,
+		C:      20,
+		Qps:    400,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	start := time.Now()
+	boom.Run()
+	n := atomic.LoadInt64(&count)
+	rate := float64(n) / time.Since(start).Seconds()
+	if n != 400 {
+		t.Errorf("Expected to boom 400 times, found %v", n)
+	}
+	// The limit applies to all the workers together, not per worker.
+	if rate < 360 || rate > 440 {
+		t.Errorf("Expected a rate of about 400 req/s, %v is found", rate)
+	}
+}
+
+func TestQps_PerWorker(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, int64(1))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:            400,
+		C:            4,
+		Qps:          100,
+		QpsPerWorker: true,
+		Output:       "json",
+		Writer:       ioutil.Discard,
+	}
+	start := time.Now()
+	boom.Run()
+	n := atomic.LoadInt64(&count)
+	rate := float64(n) / time.Since(start).Seconds()
+	if rate < 360 || rate > 440 {
+		t.Errorf("Expected a rate of about 400 req/s, %v is found", rate)
+	}
+}
+
+func TestRetries_5xx(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Every other attempt fails.
+		if atomic.AddInt64(&count, int64(1))%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   "body",
+		},
+		N:        10,
+		C:        1,
+		Retries:  2,
+		Retry5xx: true,
+		Output:   "json",
+		Writer:   ioutil.Discard,
+	}
+	rpt := boom.Run()
+	n := atomic.LoadInt64(&count)
+	if n != 20 {
+		t.Errorf("Expected to boom 20 times, found %v", n)
+	}
+	if rpt.StatusCodeDist[200] != 10 || len(rpt.StatusCodeDist) != 1 {
+		t.Errorf("Expected only the last attempts to be reported, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.Retries != 10 || rpt.RetryErrors["status 503"] != 10 {
+		t.Errorf("Expected 10 retries on status 503, %v (%v) is found", rpt.Retries, rpt.RetryErrors)
+	}
+}
+
+func TestRetries_Connection(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&count, int64(1)) <= 3 {
+			// Drop the connection without a response.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:            1,
+		C:            1,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+		Output:       "json",
+		Writer:       ioutil.Discard,
+	}
+	rpt := boom.Run()
+	n := atomic.LoadInt64(&count)
+	if n != 3 {
+		t.Errorf("Expected to boom 3 times, found %v", n)
+	}
+	// Out of retries, the last attempt fails.
+	if len(rpt.Errors) != 1 || rpt.Retries != 2 {
+		t.Errorf("Expected 1 error after 2 retries, %v and %v are found", rpt.Errors, rpt.Retries)
+	}
+	if rpt.StatusCodeDist[200] != 0 {
+		t.Errorf("Expected no success, %v is found", rpt.StatusCodeDist)
+	}
+}
+
+// Handler redirecting /a to /b, /b to /c, and responding from /c.
+func redirectHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/a":
+		http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+	case "/b":
+		http.Redirect(w, r, "/c", http.StatusFound)
+	}
+}
+
+func TestRedirects_Followed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(redirectHandler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL + "/a",
+		},
+		N:      5,
+		C:      2,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.StatusCodeDist[200] != 5 || len(rpt.StatusCodeDist) != 1 {
+		t.Errorf("Expected the final status to be reported, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.Redirects != 10 || rpt.MaxRedirects != 2 {
+		t.Errorf("Expected 10 redirects, at most 2, %v (%v) is found", rpt.Redirects, rpt.MaxRedirects)
+	}
+}
+
+func TestRedirects_NotFollowed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(redirectHandler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL + "/a",
+		},
+		N:           5,
+		C:           2,
+		NoRedirects: true,
+		Output:      "json",
+		Writer:      ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.StatusCodeDist[301] != 5 || len(rpt.StatusCodeDist) != 1 {
+		t.Errorf("Expected the redirect status to be reported, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.Redirects != 0 {
+		t.Errorf("Expected no redirects, %v is found", rpt.Redirects)
+	}
+}
+
+func TestHeaderTimeout(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:             2,
+		C:             1,
+		HeaderTimeout: 50 * time.Millisecond,
+		Output:        "json",
+		Writer:        ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.Errors[errHeaderTimeout] != 2 {
+		t.Errorf("Expected 2 header timeouts, %v is found", rpt.Errors)
+	}
+}
+
+func TestNewConns(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:      200,
+		C:      4,
+		Conns:  1,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	// The idle connections of the shared client are kept, up to C.
+	if rpt.NewConns == 0 || rpt.NewConns > 4 {
+		t.Errorf("Expected at most a connection per worker, %v is found", rpt.NewConns)
+	}
+}
+
+func TestSharedTransport(t *testing.T) {
+	var accepted int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt64(&accepted, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for _, noKeep := range []bool{false, true} {
+		atomic.StoreInt64(&accepted, 0)
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:                1000,
+			C:                8,
+			DisableKeepAlive: noKeep,
+			Output:           "json",
+			Writer:           ioutil.Discard,
+		}
+		rpt := boom.Run()
+		n := atomic.LoadInt64(&accepted)
+		if noKeep {
+			if rpt.NewConns != 1000 || n != 1000 {
+				t.Errorf("Expected a connection per request without keep-alives, %v dialed and %v accepted are found", rpt.NewConns, n)
+			}
+		} else if rpt.NewConns == 0 || rpt.NewConns > 16 || n > 16 {
+			// The workers share the idle connections, up to C. A worker
+			// may dial before its last connection is back in the pool.
+			t.Errorf("Expected about a connection per worker, %v dialed and %v accepted are found", rpt.NewConns, n)
+		}
+	}
+}
+
+func TestRequestsPerConn(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		perConn   int
+		noKeep    bool
+		conns     int
+		reuseRate float64
+	}{
+		{5, false, 4, 0.8},
+		{1, false, 20, 0},
+		{0, true, 20, 0},
+	} {
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:                20,
+			C:                1,
+			RequestsPerConn:  tc.perConn,
+			DisableKeepAlive: tc.noKeep,
+			Output:           "json",
+			Writer:           ioutil.Discard,
+		}
+		rpt := boom.Run()
+		if rpt.NewConns != tc.conns {
+			t.Errorf("Expected %v connections, %v is found", tc.conns, rpt.NewConns)
+		}
+		if rpt.Breakdown.ReuseRatio != tc.reuseRate {
+			t.Errorf("Expected a reuse ratio of %v, %v is found", tc.reuseRate, rpt.Breakdown.ReuseRatio)
+		}
+	}
+}
+
+func TestDNSEach(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+		},
+		N:                10,
+		C:                2,
+		DNSEach:          true,
+		DisableKeepAlive: true,
+		Writer:           &buf,
+	}
+	rpt := boom.Run()
+	var count int
+	for _, n := range rpt.ServerAddrs {
+		count += n
+	}
+	if count != 10 {
+		t.Errorf("Expected the server address of 10 connections, %v is found", rpt.ServerAddrs)
+	}
+	if !strings.Contains(buf.String(), "Server addresses:") {
+		t.Errorf("Expected the server addresses to be printed, %v is found", buf.String())
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	var sessions, static int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("static"); err == nil && c.Value == "1" {
+			atomic.AddInt64(&static, int64(1))
+		}
+		if _, err := r.Cookie("session"); err == nil {
+			atomic.AddInt64(&sessions, int64(1))
+		} else {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method:  "GET",
+			Url:     server.URL,
+			Cookies: []*http.Cookie{{Name: "static", Value: "1"}},
+		},
+		N:         4,
+		C:         1,
+		CookieJar: true,
+		Output:    "json",
+		Writer:    ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if n := atomic.LoadInt64(&sessions); n != 3 {
+		t.Errorf("Expected 3 requests with the session cookie, %v is found", n)
+	}
+	if n := atomic.LoadInt64(&static); n != 4 {
+		t.Errorf("Expected 4 requests with the static cookie, %v is found", n)
+	}
+	if rpt.SetCookies != 1 {
+		t.Errorf("Expected 1 Set-Cookie response, %v is found", rpt.SetCookies)
+	}
+}
+
+func TestAssertBody(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&count, int64(1))%4 == 0 {
+			w.Write([]byte(`{"ok":false}`))
+		} else {
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:          8,
+		C:          2,
+		AssertBody: regexp.MustCompile(regexp.QuoteMeta(`"ok":true`)),
+		Output:     "json",
+		Writer:     ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.AssertFailures != 2 || rpt.AssertExample != `{"ok":false}` {
+		t.Errorf("Expected 2 assertion failures, %v (%q) is found", rpt.AssertFailures, rpt.AssertExample)
+	}
+	if rpt.StatusCodeDist[200] != 8 {
+		t.Errorf("Expected 8 responses, %v is found", rpt.StatusCodeDist)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	var uri, contentType, some, method, auth string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		uri = r.RequestURI
+		method = r.Method
+		contentType = r.Header.Get("Content-type")
+		some = r.Header.Get("X-some")
+		auth = r.Header.Get("Authorization")
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	header := make(http.Header)
+	header.Add("Content-type", "text/html")
+	header.Add("X-some", "value")
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method:   "PUT",
+			Url:      server.URL,
+			Header:   header,
+			Username: "username",
+			Password: "password",
+		},
+		N: 1,
+		C: 1,
+	}
+	boom.Run()
+	if uri != "/" {
+		t.Errorf("Uri is expected to be /, %v is found", uri)
+	}
+	if method != "PUT" {
+		t.Errorf("Method is expected to be PUT, %v is found", method)
+	}
+	if contentType != "text/html" {
+		t.Errorf("Content type is expected to be text/html, %v is found", contentType)
+	}
+	if some != "value" {
+		t.Errorf("X-some header is expected to be value, %v is found", some)
+	}
+	if auth != "Basic dXNlcm5hbWU6cGFzc3dvcmQ=" {
+		t.Errorf("Basic authorization is not properly set")
+	}
+}
+
+func TestRequestBearer(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token" {
+			atomic.AddInt64(&count, int64(1))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+			Bearer: "token",
+		},
+		N: 10,
+		C: 2,
+	}
+	boom.Run()
+	if n := atomic.LoadInt64(&count); n != 10 {
+		t.Errorf("Expected 10 requests with the bearer token, %v is found", n)
+	}
+}
+
+func TestRequestAWSSigned(t *testing.T) {
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") && r.Header.Get("X-Amz-Date") != "" {
+			atomic.AddInt64(&count, int64(1))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   "body",
+		},
+		N:      10,
+		C:      2,
+		AWS:    testSigner,
+		Output: "json",
+		Writer: ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if n := atomic.LoadInt64(&count); n != 10 {
+		t.Errorf("Expected 10 signed requests, %v is found", n)
+	}
+	if rpt.Signing <= 0 {
+		t.Errorf("Expected the signing time to be reported, %v is found", rpt.Signing)
+	}
+}
+
+// Returns a self-signed client certificate.
+func newClientCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "boom"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestRequestClientCert(t *testing.T) {
+	clientCert, ca := newClientCert(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(ca)
+	server.StartTLS()
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	for _, c := range []struct {
+		cert     *tls.Certificate
+		roots    *x509.CertPool
+		insecure bool
+		ok       int
+	}{
+		{nil, roots, false, 0},
+		{&clientCert, roots, false, 3},
+		{&clientCert, nil, false, 0},
+		{&clientCert, nil, true, 3},
+	} {
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:             3,
+			C:             1,
+			ClientCert:    c.cert,
+			RootCAs:       c.roots,
+			AllowInsecure: c.insecure,
+			Output:        "json",
+			Writer:        ioutil.Discard,
+		}
+		rpt := boom.Run()
+		if rpt.StatusCodeDist[200] != c.ok {
+			t.Errorf("Expected %v responses with cert %v and insecure %v, %v is found", c.ok, c.cert != nil, c.insecure, rpt.StatusCodeDist)
+		}
+	}
+}
+
+func TestTLSVersions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		min, max uint16
+		ciphers  []uint16
+		version  string
+		cipher   string
+	}{
+		{0, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, "TLS 1.2", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		// The TLS 1.3 suite depends on the AES support of the hardware.
+		{tls.VersionTLS13, 0, nil, "TLS 1.3", ""},
+	} {
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:             4,
+			C:             1,
+			TLSMin:        c.min,
+			TLSMax:        c.max,
+			CipherSuites:  c.ciphers,
+			AllowInsecure: true,
+			Output:        "json",
+			Writer:        ioutil.Discard,
+		}
+		rpt := boom.Run()
+		// A single connection is made, and reused.
+		if rpt.TLSVersions[c.version] != 1 || len(rpt.TLSVersions) != 1 {
+			t.Errorf("Expected a %v handshake, %v is found", c.version, rpt.TLSVersions)
+		}
+		if len(rpt.CipherSuites) != 1 || c.cipher != "" && rpt.CipherSuites[c.cipher] != 1 {
+			t.Errorf("Expected a %v handshake, %v is found", c.cipher, rpt.CipherSuites)
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		network string
+		ok      int
+	}{
+		{"tcp4", 3},
+		// The server only listens on IPv4.
+		{"tcp6", 0},
+	} {
+		var buf bytes.Buffer
+		boom := &Boom{
+			Req: &ReqOpts{
+				Method: "GET",
+				Url:    server.URL,
+			},
+			N:       3,
+			C:       1,
+			Network: c.network,
+			Writer:  &buf,
+		}
+		rpt := boom.Run()
+		if rpt.StatusCodeDist[200] != c.ok {
+			t.Errorf("Expected %v responses over %v, %v is found", c.ok, c.network, rpt.StatusCodeDist)
+		}
+		if c.ok > 0 && (rpt.Families["IPv4"] != 1 || !strings.Contains(buf.String(), "Connections per family:\tIPv4 1.")) {
+			t.Errorf("Expected a single IPv4 connection, %v is found", rpt.Families)
+		}
+	}
+}
+
+func TestLocalAddrs(t *testing.T) {
+	var mu sync.Mutex
+	remotes := make(map[string]bool)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		mu.Lock()
+		remotes[host] = true
+		mu.Unlock()
 	}
 	server := httptest.NewServer(http.HandlerFunc(handler))
 	defer server.Close()
@@ -60,59 +1431,64 @@ func TestQps(t *testing.T) {
 			Method: "GET",
 			Url:    server.URL,
 		},
-		N:   20,
-		C:   2,
-		Qps: 1,
+		N:          8,
+		C:          4,
+		LocalAddrs: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")},
+		Output:     "json",
+		Writer:     ioutil.Discard,
+	}
+	rpt := boom.Run()
+	// A worker may get no job, the addresses are used in turn by the
+	// connections that are made.
+	a, b := rpt.LocalAddrs["127.0.0.1"], rpt.LocalAddrs["127.0.0.2"]
+	if a+b < 1 || a+b > 4 || a-b < 0 || a-b > 1 || len(rpt.LocalAddrs) != len(remotes) {
+		t.Errorf("Expected the addresses to be used in turn, %v (%v) is found", rpt.LocalAddrs, remotes)
+	}
+
+	// An address of the documentation range is not assigned.
+	boom = &Boom{
+		Req:        &ReqOpts{Method: "GET", Url: server.URL},
+		N:          1,
+		C:          1,
+		LocalAddrs: []net.IP{net.ParseIP("192.0.2.1")},
+	}
+	if err := boom.Prepare(); err == nil {
+		t.Errorf("Expected an unassigned address to be rejected")
 	}
-	wg.Add(1)
-	time.AfterFunc(time.Second, func() {
-		if count > 1 {
-			t.Errorf("Expected to boom 1 times, found %v", count)
-		}
-		wg.Done()
-	})
-	go boom.Run()
-	wg.Wait()
 }
 
-func TestRequest(t *testing.T) {
-	var uri, contentType, some, method, auth string
+func TestRequestHeaderOverride(t *testing.T) {
+	var auth string
+	var values []string
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		uri = r.RequestURI
-		method = r.Method
-		contentType = r.Header.Get("Content-type")
-		some = r.Header.Get("X-some")
 		auth = r.Header.Get("Authorization")
+		values = r.Header["X-Multi"]
 	}
 	server := httptest.NewServer(http.HandlerFunc(handler))
 	defer server.Close()
 
 	header := make(http.Header)
-	header.Add("Content-type", "text/html")
-	header.Add("X-some", "value")
+	header.Set("Authorization", "Token abc")
+	header.Add("X-Multi", "1")
+	header.Add("X-Multi", "2")
 	boom := &Boom{
 		Req: &ReqOpts{
-			Method:   "PUT",
+			Method:   "GET",
 			Url:      server.URL,
 			Header:   header,
 			Username: "username",
 			Password: "password",
 		},
-		N: 1,
-		C: 1,
+		N:      1,
+		C:      1,
+		Output: "quiet",
 	}
 	boom.Run()
-	if uri != "/" {
-		t.Errorf("Uri is expected to be /, %v is found", uri)
-	}
-	if contentType != "text/html" {
-		t.Errorf("Content type is expected to be text/html, %v is found", contentType)
+	if auth != "Token abc" {
+		t.Errorf("Authorization is expected to be Token abc, %v is found", auth)
 	}
-	if some != "value" {
-		t.Errorf("X-some header is expected to be value, %v is found", some)
-	}
-	if auth != "Basic dXNlcm5hbWU6cGFzc3dvcmQ=" {
-		t.Errorf("Basic authorization is not properly set")
+	if len(values) != 2 || values[0] != "1" || values[1] != "2" {
+		t.Errorf("X-Multi is expected to be [1 2], %v is found", values)
 	}
 }
 
@@ -142,6 +1518,121 @@ func TestBody(t *testing.T) {
 	}
 }
 
+func TestBodyReplayed(t *testing.T) {
+	body := strings.Repeat("{\"key\": \"value\"}", 1000)
+	var count int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.ContentLength == int64(len(body)) && string(b) == body {
+			atomic.AddInt64(&count, int64(1))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   body,
+		},
+		N:      10,
+		C:      2,
+		Output: "quiet",
+	}
+	boom.Run()
+	if count != 10 {
+		t.Errorf("Expected the body to be sent 10 times, found %v", count)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	var mu sync.Mutex
+	uris := make(map[string]bool)
+	bodies := make(map[string]bool)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		uris[r.RequestURI] = true
+		bodies[string(body)] = true
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL + "/item/{{seq}}",
+			Body:   `{"id": "{{uuid}}"}`,
+		},
+		N:      10,
+		C:      2,
+		Output: "quiet",
+	}
+	boom.Run()
+	if len(uris) != 10 || len(bodies) != 10 {
+		t.Errorf("Expected 10 distinct URIs and bodies, found %v and %v", len(uris), len(bodies))
+	}
+
+	boom = &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL + "/{{nope}}",
+		},
+		N:      1,
+		C:      1,
+		Output: "quiet",
+	}
+	if err := boom.Prepare(); err == nil {
+		t.Errorf("Expected an invalid template to be rejected")
+	}
+	boom.NoTemplate = true
+	if err := boom.Prepare(); err != nil {
+		t.Errorf("Unexpected error, %v", err)
+	}
+}
+
+func TestDataFeed_Requests(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, r.URL.Path+" "+r.Header.Get("X-Email")+" "+string(body))
+		mu.Unlock()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	data, _ := ReadDataFeed(strings.NewReader("id,email\n1,a@x.com\n2,b@x.com\n"))
+	header := make(http.Header)
+	header.Set("X-Email", "{{.email}}")
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL + "/users/{{.id}}",
+			Header: header,
+			Body:   "id={{.id}}",
+		},
+		Data:     data,
+		DataStop: true,
+		N:        10,
+		C:        1,
+		Output:   "quiet",
+	}
+	boom.Run()
+	if len(got) != 2 || got[0] != "/users/1 a@x.com id=1" || got[1] != "/users/2 b@x.com id=2" {
+		t.Errorf("Unexpected requests %v", got)
+	}
+
+	boom.Req.Url = server.URL + "/{{.nope}}"
+	boom.prepared = false
+	if err := boom.Prepare(); err == nil {
+		t.Errorf("Expected an unknown column to be rejected")
+	}
+}
+
 func TestContentLengthIfExists(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Length", "20")
@@ -164,6 +1655,97 @@ func TestContentLengthIfExists(t *testing.T) {
 	}
 }
 
+func TestContentLength_NoBodyRead(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "20")
+		w.Write([]byte(strings.Repeat("a", 20)))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:          10,
+		C:          1,
+		NoBodyRead: true,
+	}
+	boom.Run()
+
+	// The declared length is counted, the body is left unread.
+	if boom.rpt.SizeTotal != 200 {
+		t.Errorf("Expected Total Data Recieved 200 bytes, found %v", boom.rpt.SizeTotal)
+	}
+}
+
+func TestContentLength_Counted(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Chunked, and compressed if accepted.
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(strings.Repeat("a", 100)))
+		gz.Close()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N: 10,
+		C: 1,
+	}
+	boom.Run()
+
+	if boom.rpt.SizeTotal != 1000 {
+		t.Errorf("Expected Total Data Recieved 1000 bytes, found %v", boom.rpt.SizeTotal)
+	}
+	if boom.rpt.NewConns != 1 {
+		t.Errorf("Expected the connection to be reused, %v connections are found", boom.rpt.NewConns)
+	}
+}
+
+func TestMaxBody(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Large enough not to be buffered along with the headers.
+		size := 1 << 20
+		if r.URL.Query().Get("short") != "" {
+			size = 10
+		}
+		w.Write([]byte(strings.Repeat("a", size)))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+		},
+		Urls:    []string{server.URL, server.URL + "?short=1"},
+		N:       10,
+		C:       1,
+		MaxBody: 10,
+		Writer:  &buf,
+	}
+	rpt := boom.Run()
+	if rpt.SizeTotal != 100 || rpt.Truncated != 5 {
+		t.Errorf("Expected 5 of 10 bodies of 10 bytes to be truncated, %v bytes and %v truncated are found", rpt.SizeTotal, rpt.Truncated)
+	}
+	// The connections of the truncated bodies are not reused, the short
+	// bodies after them need a new one.
+	if rpt.NewConns != 6 {
+		t.Errorf("Expected 6 connections, %v is found", rpt.NewConns)
+	}
+	if !strings.Contains(buf.String(), "Truncated responses:\t5, bodies read up to 10 bytes.") {
+		t.Errorf("Expected the truncated responses to be printed, %v is found", buf.String())
+	}
+}
+
 func TestContentLengthIfDontExists(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 	}
@@ -184,3 +1766,228 @@ func TestContentLengthIfDontExists(t *testing.T) {
 		t.Errorf("Expected Total Data Recieved 200 bytes, found %v", boom.rpt.SizeTotal)
 	}
 }
+
+func TestChunked(t *testing.T) {
+	body := strings.Repeat("0123456789", 1000)
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if len(r.TransferEncoding) != 1 || r.TransferEncoding[0] != "chunked" || r.ContentLength != -1 {
+			failed = append(failed, fmt.Sprintf("transfer encoding %v, content length %d", r.TransferEncoding, r.ContentLength))
+		}
+		if string(b) != body {
+			failed = append(failed, fmt.Sprintf("body of %d bytes", len(b)))
+		}
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   body,
+		},
+		N:         4,
+		C:         2,
+		Chunked:   true,
+		ChunkSize: 1000,
+		Output:    "quiet",
+		Writer:    ioutil.Discard,
+	}
+	rpt := boom.Run()
+	for _, f := range failed {
+		t.Errorf("Expected a chunked body, %s is found", f)
+	}
+	if rpt.StatusCodeDist[http.StatusOK] != 4 {
+		t.Errorf("Expected 4 responses, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.SizeSent != int64(4*len(body)) {
+		t.Errorf("Expected %v bytes sent, %v is found", 4*len(body), rpt.SizeSent)
+	}
+}
+
+func TestCacheBust(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries = make(map[string]bool)
+		failed  []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		q := r.URL.Query()
+		if q.Get("page") != "2" || len(q["_"]) != 1 || r.Header.Get("Cache-Control") != "no-cache" {
+			failed = append(failed, r.URL.RawQuery)
+		}
+		queries[q.Get("_")] = true
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL + "/?page=2",
+		},
+		CacheBust: "_",
+		NoCache:   true,
+		N:         10,
+		C:         2,
+		Output:    "quiet",
+		Writer:    ioutil.Discard,
+	}
+	boom.Run()
+	for _, f := range failed {
+		t.Errorf("Expected a page, a cache-busting parameter and a no-cache header, %q is found", f)
+	}
+	if len(queries) != 10 {
+		t.Errorf("Expected 10 unique requests, %v are found", len(queries))
+	}
+}
+
+func TestUserAgents(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		agents = make(map[string]int)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.UserAgent()]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+			Header: http.Header{"User-Agent": []string{"boom"}},
+		},
+		UserAgents: []string{"a", "b", "c"},
+		N:          9,
+		C:          3,
+		Output:     "quiet",
+		Writer:     ioutil.Discard,
+	}
+	rpt := boom.Run()
+	for _, ua := range boom.UserAgents {
+		if agents[ua] != 3 {
+			t.Errorf("Expected 3 requests with User-Agent %q, %v is found", ua, agents)
+		}
+		if rpt.UserAgentDist[ua] != 3 {
+			t.Errorf("Expected 3 requests counted for User-Agent %q, %v is found", ua, rpt.UserAgentDist)
+		}
+	}
+}
+
+func TestUrlWeights(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req:        &ReqOpts{Method: "GET"},
+		Urls:       []string{server.URL + "/search", server.URL + "/checkout"},
+		UrlWeights: []float64{9, 1},
+		N:          2000,
+		C:          4,
+		Writer:     &buf,
+	}
+	rpt := boom.Run()
+	if share := float64(rpt.UrlDist[server.URL+"/search"]) / 2000; share < 0.85 || share > 0.95 {
+		t.Errorf("Expected about 90%% of the requests to search, %v is found", share)
+	}
+	if w := rpt.UrlWeights[server.URL+"/checkout"]; w != 0.1 {
+		t.Errorf("Expected an intended share of 0.1 for checkout, %v is found", w)
+	}
+	if s := "90.00% intended\n"; !strings.Contains(buf.String(), s) {
+		t.Errorf("Expected %q to be printed, %v is found", s, buf.String())
+	}
+
+	boom = &Boom{
+		Req:        &ReqOpts{Method: "GET"},
+		Urls:       []string{server.URL},
+		UrlWeights: []float64{9, 1},
+		N:          1,
+		C:          1,
+	}
+	if err := boom.Prepare(); err == nil {
+		t.Errorf("Expected weights that do not match the URLs to be rejected")
+	}
+}
+
+func TestSelfCPU(t *testing.T) {
+	var buf bytes.Buffer
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "http://example.invalid/",
+		},
+		N:         20000,
+		C:         4,
+		Transport: &stubTransport{},
+		Writer:    &buf,
+	}
+	rpt := boom.Run()
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if rpt.SelfCPU <= 0 {
+		t.Errorf("Expected the CPU time of the run, %v is found", rpt.SelfCPU)
+	}
+	if !strings.Contains(buf.String(), "  Self CPU:\t") {
+		t.Errorf("Expected the CPU time to be printed, %q is found", buf.String())
+	}
+}
+
+// Measures the allocations per request of a run, the transport answering
+// right away.
+func BenchmarkRun(b *testing.B) {
+	b.ReportAllocs()
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    "http://example.invalid/",
+			Header: http.Header{"Accept": {"text/plain"}},
+		},
+		N:         b.N,
+		C:         1,
+		Transport: &stubTransport{},
+		Writer:    ioutil.Discard,
+	}
+	b.ResetTimer()
+	boom.Run()
+}
+
+// Measures the time per request of the workers and the aggregator
+// alone, the transport answering right away, with more and more
+// workers. The time per request should not grow with them if the
+// results channel is not contended, go test -blockprofile shows where
+// the workers wait otherwise.
+func BenchmarkRun_Concurrency(b *testing.B) {
+	for _, c := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("c=%d", c), func(b *testing.B) {
+			boom := &Boom{
+				Req: &ReqOpts{
+					Method: "GET",
+					Url:    "http://example.invalid/",
+				},
+				N:           b.N,
+				C:           c,
+				StreamStats: true,
+				Transport:   &stubTransport{},
+				Output:      "quiet",
+				Writer:      ioutil.Discard,
+			}
+			if b.N < c {
+				boom.C = b.N
+			}
+			b.ResetTimer()
+			boom.Run()
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Number of responses queued for writing, responses are dropped
+// rather than blocking once the queue is full.
+const saverQueueSize = 64
+
+// sample is a response kept to be saved, headers and start of the body.
+type sample struct {
+	seq    int
+	at     time.Time
+	proto  string
+	status string
+	code   int
+	header http.Header
+	body   capped
+}
+
+// capped keeps the first max bytes written to it and discards the rest.
+type capped struct {
+	buf []byte
+	max int64
+}
+
+func (c *capped) Write(p []byte) (int, error) {
+	if n := c.max - int64(len(c.buf)); n > 0 {
+		if int64(len(p)) < n {
+			n = int64(len(p))
+		}
+		c.buf = append(c.buf, p[:n]...)
+	}
+	return len(p), nil
+}
+
+// saver writes samples of the responses to a directory, up to a number
+// per status code and a total number of bytes. Files are written by
+// a goroutine of their own, so that the requests are not slowed down.
+type saver struct {
+	dir       string
+	perStatus int
+
+	mu     sync.Mutex
+	counts map[int]int
+	// Bytes left to write, bodies are not kept past it.
+	left int64
+
+	queue chan *sample
+	done  chan struct{}
+	// Number of samples dropped as the queue was full.
+	dropped int
+	// Number of files written and the first error, if any.
+	saved int
+	err   error
+}
+
+func newSaver(dir string, perStatus int, maxBytes int64) *saver {
+	s := &saver{
+		dir:       dir,
+		perStatus: perStatus,
+		counts:    make(map[int]int),
+		left:      maxBytes,
+		queue:     make(chan *sample, saverQueueSize),
+		done:      make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Returns a sample of the response to fill with its body, or nil if
+// enough responses of its status are kept already. The sample holds a
+// slot of its status until it is saved or released.
+func (s *saver) take(resp *http.Response) *sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts[resp.StatusCode] >= s.perStatus {
+		return nil
+	}
+	if s.left <= 0 {
+		return nil
+	}
+	s.counts[resp.StatusCode]++
+	return &sample{
+		at:     time.Now(),
+		proto:  resp.Proto,
+		status: resp.Status,
+		code:   resp.StatusCode,
+		header: resp.Header,
+		body:   capped{max: s.left},
+	}
+}
+
+// Releases the slot of a sample that is not saved, e.g. that of an
+// attempt which is retried.
+func (s *saver) release(sm *sample) {
+	s.mu.Lock()
+	s.counts[sm.code]--
+	s.mu.Unlock()
+}
+
+// Queues the sample of a reported result.
+func (s *saver) save(sm *sample) {
+	select {
+	case s.queue <- sm:
+	default:
+		// The disk is lagging behind, the run is not slowed down.
+		s.mu.Lock()
+		s.counts[sm.code]--
+		s.dropped++
+		s.mu.Unlock()
+	}
+}
+
+func (s *saver) loop() {
+	defer close(s.done)
+	for sm := range s.queue {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%s %s\r\n", sm.proto, sm.status)
+		sm.header.Write(&buf)
+		buf.WriteString("\r\n")
+		buf.Write(sm.body.buf)
+		s.mu.Lock()
+		fits := int64(buf.Len()) <= s.left
+		s.mu.Unlock()
+		if !fits {
+			// Skipped, smaller responses may still fit.
+			continue
+		}
+		name := fmt.Sprintf("%d-%06d-%s.txt", sm.code, sm.seq, sm.at.Format("20060102T150405.000"))
+		if err := ioutil.WriteFile(filepath.Join(s.dir, name), buf.Bytes(), 0644); err != nil {
+			if s.err == nil {
+				s.err = err
+			}
+			continue
+		}
+		s.mu.Lock()
+		s.left -= int64(buf.Len())
+		s.mu.Unlock()
+		s.saved++
+	}
+}
+
+// Writes the queued responses.
+func (s *saver) close() {
+	close(s.queue)
+	<-s.done
+}
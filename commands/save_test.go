@@ -0,0 +1,162 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func saveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Test", "boom")
+	if r.URL.Query().Get("fail") != "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("oops"))
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func TestSaveResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(saveHandler))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "responses")
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+		},
+		Urls:         []string{server.URL, server.URL + "?fail=1"},
+		N:            10,
+		C:            1,
+		SaveDir:      dir,
+		SaveSample:   2,
+		SaveMaxBytes: 1 << 20,
+		Output:       "json",
+		Writer:       ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.Saved != 4 {
+		t.Errorf("Expected 4 saved responses, %v is found", rpt.Saved)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "500-*.txt"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files of 500 responses, %v is found", files)
+	}
+	b, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(b)
+	if !strings.HasPrefix(content, "HTTP/1.1 500 Internal Server Error\r\n") ||
+		!strings.Contains(content, "X-Test: boom\r\n") || !strings.HasSuffix(content, "\r\n\r\noops") {
+		t.Errorf("Expected the status line, headers and body, %q is found", content)
+	}
+}
+
+func TestSaveResponses_MaxBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(saveHandler))
+	defer server.Close()
+
+	dir := t.TempDir()
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:            10,
+		C:            1,
+		SaveDir:      dir,
+		SaveSample:   10,
+		SaveMaxBytes: 1,
+		Output:       "json",
+		Writer:       ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); rpt.Saved != 0 || len(files) != 0 {
+		t.Errorf("Expected no response to fit, %v are found", files)
+	}
+}
+
+func TestSaveResponses_Retried(t *testing.T) {
+	var n int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:            5,
+		C:            1,
+		Retries:      1,
+		Retry5xx:     true,
+		SaveDir:      dir,
+		SaveSample:   1,
+		SaveMaxBytes: 1 << 20,
+		Output:       "json",
+		Writer:       ioutil.Discard,
+	}
+	rpt := boom.Run()
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if rpt.Saved != 1 || len(files) != 1 || !strings.HasPrefix(filepath.Base(files[0]), "200-") {
+		t.Errorf("Expected the response of the last attempt only, %v is found", files)
+	}
+}
+
+func TestSaver_Dropped(t *testing.T) {
+	s := &saver{
+		perStatus: 10,
+		counts:    make(map[int]int),
+		left:      1 << 20,
+		queue:     make(chan *sample, 1),
+	}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header)}
+	for i := 0; i < 3; i++ {
+		s.save(s.take(resp))
+	}
+	if s.dropped != 2 || s.counts[http.StatusOK] != 1 {
+		t.Errorf("Expected 2 dropped samples and 1 queued, %d and %d are found", s.dropped, s.counts[http.StatusOK])
+	}
+}
+
+func TestSaver_Reserved(t *testing.T) {
+	s := &saver{
+		perStatus: 2,
+		counts:    make(map[int]int),
+		left:      1 << 20,
+	}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header)}
+	// Responses in flight hold their slot, no more buffers are taken.
+	a, b := s.take(resp), s.take(resp)
+	if a == nil || b == nil || s.take(resp) != nil {
+		t.Fatalf("Expected 2 samples to be taken")
+	}
+	s.release(a)
+	if s.take(resp) == nil {
+		t.Errorf("Expected the released slot to be taken again")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type scenarioFile struct {
+	Steps []struct {
+		Name    string            `json:"name"`
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    string            `json:"body"`
+		// Values to extract per variable, either a regexp or the path
+		// of a JSON field.
+		Extract map[string]struct {
+			Regexp string `json:"regex"`
+			JSON   string `json:"json"`
+		} `json:"extract"`
+	} `json:"steps"`
+}
+
+// LoadScenario reads the steps of a scenario file.
+func LoadScenario(path string) ([]*ReqOpts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadScenario(f)
+}
+
+// ReadScenario reads the steps of a scenario, a JSON document listing
+// the requests of a flow in order:
+//
+//	{"steps": [
+//		{"name": "login", "method": "POST", "url": "https://host/login",
+//		 "headers": {"Content-Type": "application/json"}, "body": "{...}",
+//		 "extract": {"token": {"regex": "\"token\":\"(.*?)\""}}},
+//		{"name": "dashboard", "url": "https://host/dashboard",
+//		 "headers": {"Authorization": "Bearer {{.token}}"}}
+//	]}
+//
+// The method defaults to GET. The values extracted from the response of
+// a step, by regexp or by JSON field path, e.g. {"json": "data.id"}, are
+// variables of the templates of the following steps. Steps are only
+// templates if a value is extracted. Those without a name are reported
+// by their method and URL.
+func ReadScenario(r io.Reader) ([]*ReqOpts, error) {
+	var sc scenarioFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("invalid scenario, %v", err)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, errors.New("scenario has no steps")
+	}
+	reqs := make([]*ReqOpts, 0, len(sc.Steps))
+	for i, s := range sc.Steps {
+		if s.Method == "" {
+			s.Method = "GET"
+		}
+		u, err := url.ParseRequestURI(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("scenario step %d has an invalid URL", i+1)
+		}
+		opts := &ReqOpts{
+			Method: strings.ToUpper(s.Method),
+			Url:    s.URL,
+			Header: make(http.Header),
+			Body:   s.Body,
+			Name:   s.Name,
+		}
+		for name, value := range s.Headers {
+			opts.Header.Set(name, value)
+		}
+		names := make([]string, 0, len(s.Extract))
+		for name := range s.Extract {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			x := s.Extract[name]
+			e := Extraction{Var: name, JSONPath: x.JSON}
+			if (x.Regexp == "") == (x.JSON == "") {
+				return nil, fmt.Errorf("scenario step %d must extract %s with either a regex or a json path", i+1, name)
+			}
+			if x.Regexp != "" {
+				if e.Regexp, err = regexp.Compile(x.Regexp); err != nil {
+					return nil, fmt.Errorf("scenario step %d has an invalid regex for %s, %v", i+1, name, err)
+				}
+			}
+			opts.Extract = append(opts.Extract, e)
+		}
+		reqs = append(reqs, opts)
+	}
+	return reqs, nil
+}
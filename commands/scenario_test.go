@@ -0,0 +1,103 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testScenario = `{"steps": [
+	{"name": "login", "method": "post", "url": "%[1]s/login",
+	 "headers": {"content-type": "application/json"}, "body": "{\"user\":\"a\"}"},
+	{"name": "dashboard", "url": "%[1]s/dashboard"},
+	{"url": "%[1]s/comments", "method": "POST", "body": "hi"}
+]}`
+
+func TestReadScenario(t *testing.T) {
+	reqs, err := ReadScenario(strings.NewReader(fmt.Sprintf(testScenario, "http://example.com")))
+	if err != nil {
+		t.Fatalf("Unexpected error, %v", err)
+	}
+	if len(reqs) != 3 {
+		t.Fatalf("Expected 3 steps, %v are found", len(reqs))
+	}
+	if r := reqs[0]; r.Name != "login" || r.Method != "POST" || r.Body != `{"user":"a"}` || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected first step %+v", r)
+	}
+	if r := reqs[1]; r.Name != "dashboard" || r.Method != "GET" || r.Url != "http://example.com/dashboard" {
+		t.Errorf("Unexpected second step %+v", r)
+	}
+
+	for _, s := range []string{`{"steps": []}`, `{"steps": [{"url": "/rel"}]}`, `{"requests": []}`, `not json`} {
+		if _, err := ReadScenario(strings.NewReader(s)); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestRun_Scenario(t *testing.T) {
+	var sessions int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := r.Cookie("session")
+		switch r.URL.Path {
+		case "/login":
+			// Each iteration logs in with a new jar.
+			if err == nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			n := atomic.AddInt32(&sessions, 1)
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: fmt.Sprint(n)})
+		default:
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	steps, _ := ReadScenario(strings.NewReader(fmt.Sprintf(testScenario, server.URL)))
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    steps[0].Url,
+		},
+		Entries:      steps,
+		IterationJar: true,
+		N:            12,
+		C:            2,
+		Output:       "quiet",
+		Writer:       ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.StatusCodeDist[http.StatusOK] != 12 {
+		t.Errorf("Expected the steps to share the cookies of their iteration, %v is found", rpt.StatusCodeDist)
+	}
+	if sessions != 4 {
+		t.Errorf("Expected 4 iterations to log in, %v is found", sessions)
+	}
+	if e := rpt.Entries[0]; e.Name != "login" || e.Count != 4 || e.ErrorRate != 0 {
+		t.Errorf("Unexpected first step %+v", e)
+	}
+	if e := rpt.Entries[2]; e.Name != "" || e.Request != "POST "+server.URL+"/comments" {
+		t.Errorf("Unexpected third step %+v", e)
+	}
+}
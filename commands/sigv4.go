@@ -0,0 +1,190 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const awsAlgorithm = "AWS4-HMAC-SHA256"
+
+// Headers left out of the signature, as proxies may change them.
+var awsUnsigned = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"x-amzn-trace-id": true,
+}
+
+// AWSSigner signs requests with AWS Signature Version 4.
+type AWSSigner struct {
+	Region    string
+	Service   string
+	AccessKey string
+	SecretKey string
+	// Optional session token of temporary credentials.
+	SessionToken string
+}
+
+// Signs the request as of t. The signature covers the body, which is
+// read from a copy, and the headers set so far.
+func (s *AWSSigner) sign(req *http.Request, t time.Time) error {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payload, err := payloadHash(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	if s.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+
+	headers, signed := canonicalHeaders(req)
+	creq := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL, s.Service),
+		canonicalQuery(req.URL),
+		headers,
+		signed,
+		payload,
+	}, "\n")
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	sts := awsAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(creq))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	for _, v := range []string{s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	sig := hex.EncodeToString(hmacSHA256(key, sts))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, s.AccessKey, scope, signed, sig))
+	return nil
+}
+
+// Returns the hex-encoded SHA-256 of the body of the request.
+func payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hashHex(nil), nil
+	}
+	if req.GetBody == nil {
+		return "", errors.New("request body cannot be read to be signed")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Returns the canonical headers, one "name:value\n" line per header sorted
+// by name, and the semicolon-separated list of their names.
+func canonicalHeaders(req *http.Request) (headers, signed string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, vs := range req.Header {
+		name = strings.ToLower(name)
+		if awsUnsigned[name] {
+			continue
+		}
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// Returns the URI-encoded path. It is encoded twice, as the escaped path
+// is encoded again, except for S3.
+func canonicalURI(u *url.URL, service string) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if service == "s3" {
+		return path
+	}
+	return awsEscape(path, true)
+}
+
+// Returns the query parameters, sorted by name then value.
+func canonicalQuery(u *url.URL) string {
+	var params []string
+	for name, vs := range u.Query() {
+		for _, v := range vs {
+			params = append(params, awsEscape(name, false)+"="+awsEscape(v, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// Percent-encodes all but the unreserved characters of RFC 3986, and the
+// slashes of a path.
+func awsEscape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || path && c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hashHex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
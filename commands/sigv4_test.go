@@ -0,0 +1,87 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSigner = &AWSSigner{
+	Region:    "us-east-1",
+	Service:   "service",
+	AccessKey: "AKIDEXAMPLE",
+	SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+// The get-vanilla vector of the AWS Signature Version 4 test suite.
+func TestAWSSigner_Vector(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err := testSigner.sign(req, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Errorf("Expected authorization %q, %q is found", expected, auth)
+	}
+	if date := req.Header.Get("X-Amz-Date"); date != "20150830T123600Z" {
+		t.Errorf("Expected date 20150830T123600Z, %v is found", date)
+	}
+}
+
+func TestAWSSigner_Body(t *testing.T) {
+	at := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	opts := &ReqOpts{Method: "POST", Url: "https://example.amazonaws.com/a b?y=2&x=1", Body: "body"}
+	req := opts.Request()
+	testSigner.sign(req, at)
+	opts.Body = "other"
+	other := opts.Request()
+	testSigner.sign(other, at)
+	if req.Header.Get("Authorization") == other.Header.Get("Authorization") {
+		t.Errorf("Expected the signature to cover the body")
+	}
+	// The body is hashed from a copy, it is left to be sent.
+	b := make([]byte, 4)
+	if n, _ := req.Body.Read(b); string(b[:n]) != "body" {
+		t.Errorf("Expected the body to be left unread, %q is found", b[:n])
+	}
+	if got := canonicalURI(req.URL, "service"); got != "/a%2520b" {
+		t.Errorf("Expected the path to be encoded twice, %v is found", got)
+	}
+	if got := canonicalURI(req.URL, "s3"); got != "/a%20b" {
+		t.Errorf("Expected the path to be encoded once for s3, %v is found", got)
+	}
+	if got := canonicalQuery(req.URL); got != "x=1&y=2" {
+		t.Errorf("Expected sorted query parameters, %v is found", got)
+	}
+}
+
+func TestAWSSigner_S3(t *testing.T) {
+	s3 := *testSigner
+	s3.Service = "s3"
+	s3.SessionToken = "token"
+	req := (&ReqOpts{Method: "PUT", Url: "https://bucket.s3.amazonaws.com/key", Body: "body"}).Request()
+	s3.sign(req, time.Now())
+	if h := req.Header.Get("X-Amz-Content-Sha256"); h != hashHex([]byte("body")) {
+		t.Errorf("Expected the payload hash header, %v is found", h)
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Expected the s3 headers to be signed, %v is found", req.Header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"time"
+)
+
+// SLA holds the thresholds checked at the end of a run, nil ones are
+// not checked. A zero threshold is checked, e.g. an error rate of 0
+// fails the run on any error.
+type SLA struct {
+	// Maximum 99th percentile latency.
+	P99 *time.Duration
+	// Maximum percentage of failed requests.
+	ErrorRate *float64
+	// Minimum number of requests per second.
+	MinRPS *float64
+}
+
+// SLACheck is the outcome of a threshold check. Latencies are in seconds,
+// rates in percent.
+type SLACheck struct {
+	Name      string  `json:"name"`
+	Threshold float64 `json:"threshold"`
+	Value     float64 `json:"value"`
+	Pass      bool    `json:"pass"`
+}
+
+// SLAFailed returns true if any of the SLA checks failed.
+func (r *Report) SLAFailed() bool {
+	for _, c := range r.SLA {
+		if !c.Pass {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the report against the thresholds. Latencies are sorted, the
+// percentile is the one of the latency distribution.
+func (r *Report) evaluateSLA() {
+	if r.sla == nil {
+		return
+	}
+	if r.sla.P99 != nil {
+		max := r.sla.P99.Seconds()
+		var v float64
+		if r.latCount > 0 {
+			v = r.percentile(99)
+		}
+		r.SLA = append(r.SLA, &SLACheck{Name: "p99", Threshold: max, Value: v, Pass: r.latCount > 0 && v <= max})
+	}
+	if max := r.sla.ErrorRate; max != nil {
+		v := r.ErrorRate * 100
+		r.SLA = append(r.SLA, &SLACheck{Name: "error_rate", Threshold: *max, Value: v, Pass: v <= *max})
+	}
+	if min := r.sla.MinRPS; min != nil {
+		r.SLA = append(r.SLA, &SLACheck{Name: "rps_min", Threshold: *min, Value: r.RPS, Pass: r.RPS >= *min})
+	}
+}
+
+func (r *Report) printSLA() {
+	fmt.Fprintf(r.w, "\nSLA:\n")
+	for _, c := range r.SLA {
+		status := "PASS"
+		if !c.Pass {
+			status = "FAIL"
+		}
+		switch c.Name {
+		case "p99":
+			fmt.Fprintf(r.w, "  [%s]\tp99 %4.4f secs, at most %4.4f secs.\n", status, c.Value, c.Threshold)
+		case "error_rate":
+			fmt.Fprintf(r.w, "  [%s]\terror rate %.2f%%, at most %.2f%%.\n", status, c.Value, c.Threshold)
+		case "rps_min":
+			fmt.Fprintf(r.w, "  [%s]\t%4.4f requests/sec, at least %4.4f.\n", status, c.Value, c.Threshold)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func slaResults() []*result {
+	var results []*result
+	for i := 1; i <= 100; i++ {
+		results = append(results, &result{statusCode: 200, duration: time.Duration(i) * time.Millisecond})
+	}
+	return append(results, &result{err: errors.New("boom")})
+}
+
+func newSLA(p99 time.Duration, errorRate, minRPS float64) *SLA {
+	return &SLA{P99: &p99, ErrorRate: &errorRate, MinRPS: &minRPS}
+}
+
+func TestSLA(t *testing.T) {
+	rpt, buf := newTestReport("", false, slaResults()...)
+	rpt.sla = newSLA(99*time.Millisecond, 0.5, 50)
+	finalizeReport(rpt, time.Second)
+
+	if len(rpt.SLA) != 3 {
+		t.Fatalf("Expected 3 SLA checks, %v is found", len(rpt.SLA))
+	}
+	// The p99 check agrees with the latency distribution.
+	if c := rpt.SLA[0]; !c.Pass || c.Value != 0.099 {
+		t.Errorf("Expected p99 of 0.099 to pass, %+v is found", c)
+	}
+	if c := rpt.SLA[1]; c.Pass || c.Value < 0.99 || c.Value > 0.991 {
+		t.Errorf("Expected an error rate of 0.99%% to fail, %+v is found", c)
+	}
+	if c := rpt.SLA[2]; !c.Pass || c.Value != 100 {
+		t.Errorf("Expected 100 req/s to pass, %+v is found", c)
+	}
+	if !rpt.SLAFailed() {
+		t.Errorf("Expected the SLA to fail")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "[PASS]\tp99 0.0990 secs") || !strings.Contains(out, "[FAIL]\terror rate 0.99%") {
+		t.Errorf("Expected the SLA checks in the summary, %q is found", out)
+	}
+}
+
+func TestSLA_JSON(t *testing.T) {
+	rpt, buf := newTestReport("json", false, slaResults()...)
+	p99 := 10 * time.Millisecond
+	rpt.sla = &SLA{P99: &p99}
+	finalizeReport(rpt, time.Second)
+
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is expected to be valid JSON, %v", err)
+	}
+	if len(got.SLA) != 1 || got.SLA[0].Pass || got.SLA[0].Name != "p99" {
+		t.Errorf("Expected a failed p99 check in the JSON output, %+v is found", got.SLA)
+	}
+}
+
+func TestSLA_ZeroErrorRate(t *testing.T) {
+	rpt, _ := newTestReport("", false, slaResults()...)
+	var zero float64
+	rpt.sla = &SLA{ErrorRate: &zero}
+	finalizeReport(rpt, time.Second)
+	if len(rpt.SLA) != 1 || rpt.SLA[0].Pass || !rpt.SLAFailed() {
+		t.Errorf("Expected a zero error rate to fail on any error, %+v is found", rpt.SLA)
+	}
+}
+
+func TestSLA_None(t *testing.T) {
+	rpt, buf := newTestReport("", false, slaResults()...)
+	finalizeReport(rpt, time.Second)
+	if rpt.SLAFailed() || strings.Contains(buf.String(), "SLA") {
+		t.Errorf("Expected no SLA checks")
+	}
+}
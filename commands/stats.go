@@ -0,0 +1,107 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"math"
+)
+
+const (
+	// Lowest latency with a dedicated bucket, in seconds. Lower
+	// latencies are counted in the first bucket.
+	histMin = 1e-6
+	// Growth factor between two consecutive buckets. A bucket is
+	// represented by its geometric middle, the relative error is
+	// then at most 0.1%.
+	histGrowth = 1.002
+	// Number of buckets, enough to cover latencies up to ~2 hours.
+	histSize = 11500
+)
+
+var histLogGrowth = math.Log(histGrowth)
+
+// latencyHistogram aggregates latencies into logarithmic buckets of
+// a fixed relative resolution, so that percentiles can be computed
+// without keeping every sample in memory.
+type latencyHistogram struct {
+	counts   []int
+	count    int
+	min, max float64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]int, histSize)}
+}
+
+func (h *latencyHistogram) add(v float64) {
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.counts[h.index(v)]++
+}
+
+func (h *latencyHistogram) index(v float64) int {
+	if v <= histMin {
+		return 0
+	}
+	i := int(math.Log(v/histMin) / histLogGrowth)
+	if i >= histSize {
+		i = histSize - 1
+	}
+	return i
+}
+
+// Returns the value representing the i-th bucket, bound to
+// the observed latency range.
+func (h *latencyHistogram) value(i int) float64 {
+	v := histMin * math.Pow(histGrowth, float64(i)+0.5)
+	return math.Min(math.Max(v, h.min), h.max)
+}
+
+// Calls fn for each non-empty bucket in ascending order, with the
+// representative value of the bucket and its count.
+func (h *latencyHistogram) each(fn func(v float64, n int)) {
+	for i, n := range h.counts {
+		if n > 0 {
+			fn(h.value(i), n)
+		}
+	}
+}
+
+// Returns the p-th percentile using the nearest-rank method.
+func (h *latencyHistogram) percentile(p float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(h.count) - 1e-9))
+	if rank <= 1 {
+		return h.min
+	}
+	if rank >= h.count {
+		return h.max
+	}
+	var seen int
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return h.value(i)
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,47 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	h := newLatencyHistogram()
+	lats := make([]float64, 200000)
+	for i := range lats {
+		// Log-normal latencies around 50ms.
+		lats[i] = math.Exp(rnd.NormFloat64()*0.8) * 0.05
+		h.add(lats[i])
+	}
+	sort.Float64s(lats)
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		want := percentile(lats, p)
+		got := h.percentile(p)
+		if math.Abs(got-want)/want > 0.005 {
+			t.Errorf("Expected p%v to be within 0.5%% of %v, %v is found", p, want, got)
+		}
+	}
+	if h.percentile(100) != lats[len(lats)-1] {
+		t.Errorf("Expected p100 to be the slowest latency")
+	}
+	if h.min != lats[0] || h.max != lats[len(lats)-1] {
+		t.Errorf("Expected min and max to be exact")
+	}
+}
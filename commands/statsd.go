@@ -0,0 +1,91 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+)
+
+// Number of metrics queued for sending, metrics are dropped
+// rather than blocking once the queue is full.
+const statsdQueueSize = 1024
+
+// statsd emits a metric per result to a StatsD server over UDP, with
+// DogStatsD tags.
+type statsd struct {
+	conn   net.Conn
+	prefix string
+	sample float64
+	queue  chan string
+	done   chan struct{}
+}
+
+func newStatsd(addr, prefix string, sample float64) (*statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if sample <= 0 || sample > 1 {
+		sample = 1
+	}
+	s := &statsd{
+		conn:   conn,
+		prefix: prefix,
+		sample: sample,
+		queue:  make(chan string, statsdQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+func (s *statsd) observe(res *result) {
+	if s.sample < 1 && rand.Float64() >= s.sample {
+		return
+	}
+	var rate string
+	if s.sample < 1 {
+		rate = fmt.Sprintf("|@%g", s.sample)
+	}
+	var m string
+	if res.err != nil {
+		m = fmt.Sprintf("%serrors:1|c%s|#type:%s", s.prefix, rate, classifyError(res.err))
+	} else {
+		ms := float64(res.duration.Nanoseconds()) / 1e6
+		m = fmt.Sprintf("%srequest:%.3f|ms%s|#class:%dxx", s.prefix, ms, rate, res.statusCode/100)
+	}
+	select {
+	case s.queue <- m:
+	default:
+		// The server or the network is lagging behind, the
+		// run is not slowed down.
+	}
+}
+
+func (s *statsd) loop() {
+	defer close(s.done)
+	for m := range s.queue {
+		s.conn.Write([]byte(m))
+	}
+}
+
+// Sends the queued metrics and closes the connection.
+func (s *statsd) close() {
+	close(s.queue)
+	<-s.done
+	s.conn.Close()
+}
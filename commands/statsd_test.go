@@ -0,0 +1,66 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStatsd(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := newStatsd(pc.LocalAddr().String(), "boom.", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.observe(&result{statusCode: 204, duration: 1500 * time.Microsecond})
+	s.observe(&result{err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}})
+	s.close()
+
+	want := []string{"boom.request:1.500|ms|#class:2xx", "boom.errors:1|c|#type:connection_refused"}
+	buf := make([]byte, 512)
+	for _, w := range want {
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != w {
+			t.Errorf("Expected metric %q, %q is found", w, got)
+		}
+	}
+}
+
+func TestStatsd_Sample(t *testing.T) {
+	// Not sending, so that the queue holds all the sampled metrics.
+	s := &statsd{sample: 0.5, queue: make(chan string, 1000)}
+	for i := 0; i < 1000; i++ {
+		s.observe(&result{statusCode: 200, duration: time.Millisecond})
+	}
+	if n := len(s.queue); n < 400 || n > 600 {
+		t.Errorf("Expected about 500 sampled metrics, %v is found", n)
+	}
+	if got := <-s.queue; got != "request:1.000|ms|@0.5|#class:2xx" {
+		t.Errorf("Expected the sample rate in the metric, %q is found", got)
+	}
+}
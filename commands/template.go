@@ -0,0 +1,86 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	mrand "math/rand"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Counter of the seq template function, shared by all the templates.
+var seqCounter int64
+
+// Functions available in URL and body templates. They are safe for
+// concurrent use.
+var templateFuncs = template.FuncMap{
+	"uuid": uuid,
+	"rand_int": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + mrand.Intn(max-min+1)
+	},
+	"rand_string": func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[mrand.Intn(len(letters))]
+		}
+		return string(b)
+	},
+	"seq": func() int64 {
+		return atomic.AddInt64(&seqCounter, 1)
+	},
+	"unix": func() int64 {
+		return time.Now().Unix()
+	},
+}
+
+// Returns a random version 4 UUID.
+func uuid() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Parses a template, or returns nil if s has no action and
+// can be used as is.
+func parseTemplate(name, s string) (*template.Template, error) {
+	if !strings.Contains(s, "{{") {
+		return nil, nil
+	}
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(s)
+}
+
+// Renders the template, or returns s if there is no template.
+func render(t *template.Template, s string, data interface{}) (string, error) {
+	if t == nil {
+		return s, nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
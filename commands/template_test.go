@@ -0,0 +1,67 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		re   string
+	}{
+		{"/item/{{rand_int 1 10}}", `^/item/([1-9]|10)$`},
+		{"{{uuid}}", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"{{rand_string 8}}", `^[a-zA-Z0-9]{8}$`},
+		{"{{seq}}", `^[0-9]+$`},
+		{"{{unix}}", `^[0-9]{10,}$`},
+		{"no template", `^no template$`},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseTemplate("test", tt.tmpl)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q, %v", tt.tmpl, err)
+		}
+		for i := 0; i < 10; i++ {
+			got, err := render(tmpl, tt.tmpl, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error for %q, %v", tt.tmpl, err)
+			}
+			if !regexp.MustCompile(tt.re).MatchString(got) {
+				t.Errorf("Expected %q to render as %v, %q is found", tt.tmpl, tt.re, got)
+			}
+		}
+	}
+}
+
+func TestTemplateSeq(t *testing.T) {
+	tmpl, _ := parseTemplate("test", "{{seq}}")
+	a, _ := render(tmpl, "", nil)
+	b, _ := render(tmpl, "", nil)
+	na, _ := strconv.Atoi(a)
+	nb, _ := strconv.Atoi(b)
+	if nb != na+1 {
+		t.Errorf("Expected seq to increment, %v and %v are found", a, b)
+	}
+}
+
+func TestTemplateInvalid(t *testing.T) {
+	if _, err := parseTemplate("test", "{{nope}}"); err == nil {
+		t.Errorf("Expected unknown function to be rejected")
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Stages of a request, in the order they happen.
+const (
+	stageDNS = iota
+	stageConnect
+	stageTLS
+	stageContinue
+	stageWait
+	stageTransfer
+	numStages
+)
+
+var stageNames = [numStages]string{"dns", "connect", "tls", "continue", "wait", "transfer"}
+
+// Printed names of the stages.
+var stageLabels = [numStages]string{"DNS lookup", "TCP connect", "TLS handshake", "100 Continue", "Server wait", "Content transfer"}
+
+// timings are the durations of the stages of a request. A stage is zero
+// if it was skipped, e.g. DNS, connect and TLS on a reused connection.
+type timings struct {
+	stages [numStages]time.Duration
+	reused bool
+}
+
+// tracer records the stages of a request. Dials may report from other
+// goroutines, even after the request got another connection.
+type tracer struct {
+	mu                               sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+	wrote, firstByte                 time.Time
+	dns, connect, tls                time.Duration
+	reused                           bool
+	// Times of an "Expect: 100-continue" request: the headers written,
+	// the 100 Continue response and the headers of the final response.
+	// Set if the transport waited for the 100 Continue response.
+	wroteHeaders, got100, headers time.Time
+	waited                        bool
+	// Negotiated TLS version and cipher suite, if a handshake was made.
+	tlsVersion, cipherSuite uint16
+	// Remote and local addresses of the connection, if it is a new one.
+	remote, local net.Addr
+	// Number of connections dialed, including those of redirects.
+	dials int
+}
+
+func (t *tracer) context(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			t.dials++
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			if err == nil && t.connect == 0 {
+				t.connect = time.Since(t.connectStart)
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.mu.Lock()
+			t.tls = time.Since(t.tlsStart)
+			if err == nil {
+				t.tlsVersion, t.cipherSuite = state.Version, state.CipherSuite
+			}
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			if !info.Reused {
+				t.remote = info.Conn.RemoteAddr()
+				t.local = info.Conn.LocalAddr()
+			}
+			t.mu.Unlock()
+		},
+		WroteHeaders: func() {
+			t.mu.Lock()
+			t.wroteHeaders = time.Now()
+			t.mu.Unlock()
+		},
+		Wait100Continue: func() {
+			t.mu.Lock()
+			t.waited = true
+			t.mu.Unlock()
+		},
+		Got100Continue: func() {
+			t.mu.Lock()
+			t.got100 = time.Now()
+			t.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wrote = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			t.mu.Unlock()
+		},
+	})
+}
+
+// Returns the negotiated TLS version and cipher suite, zero if no
+// handshake was made for the request.
+func (t *tracer) tlsState() (version, cipherSuite uint16) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tlsVersion, t.cipherSuite
+}
+
+// Records that the headers of the final response were read. The first
+// response byte is that of the 100 Continue response, if there is one.
+func (t *tracer) gotResponse() {
+	t.mu.Lock()
+	t.headers = time.Now()
+	t.mu.Unlock()
+}
+
+// Returns whether the body was sent without a 100 Continue response,
+// once the transport stopped waiting for it after timeout. It is not if
+// the server replied first, e.g. with an error.
+func (t *tracer) continueTimedOut(timeout time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waited && t.got100.IsZero() && t.firstByte.Sub(t.wroteHeaders) >= timeout
+}
+
+// Returns the number of connections dialed for the request.
+func (t *tracer) dialed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dials
+}
+
+// Returns the address family of the connection of the request, "IPv4"
+// or "IPv6", empty if it was reused or is not TCP.
+func (t *tracer) family() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	addr, ok := t.remote.(*net.TCPAddr)
+	switch {
+	case !ok:
+		return ""
+	case addr.IP.To4() != nil:
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// Returns the local IP of the connection of the request, empty if it
+// was reused or is not TCP.
+func (t *tracer) localIP() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if addr, ok := t.local.(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// Returns the server IP of the connection of the request, empty if it
+// was reused or is not TCP.
+func (t *tracer) remoteIP() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if addr, ok := t.remote.(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// Returns the timings of the request, whose body was read at end.
+func (t *tracer) timings(end time.Time) timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tm := timings{reused: t.reused}
+	if !t.reused {
+		tm.stages[stageDNS] = t.dns
+		tm.stages[stageConnect] = t.connect
+		tm.stages[stageTLS] = t.tls
+	}
+	switch {
+	case t.waited && !t.headers.IsZero():
+		// The server waits for the body, or from the headers if it
+		// replied before the body was sent.
+		start := t.wrote
+		if !t.got100.IsZero() {
+			tm.stages[stageContinue] = t.got100.Sub(t.wroteHeaders)
+		} else if start.IsZero() || start.After(t.headers) {
+			start = t.wroteHeaders
+		}
+		tm.stages[stageWait] = t.headers.Sub(start)
+		tm.stages[stageTransfer] = end.Sub(t.headers)
+	case !t.wrote.IsZero() && !t.firstByte.IsZero():
+		tm.stages[stageWait] = t.firstByte.Sub(t.wrote)
+		tm.stages[stageTransfer] = end.Sub(t.firstByte)
+	}
+	return tm
+}
+
+// StageStats summarizes a stage over the requests that went through it.
+type StageStats struct {
+	Stage   string  `json:"stage"`
+	Count   int     `json:"count"`
+	Average float64 `json:"average"`
+	P99     float64 `json:"p99"`
+}
+
+// ConnLatency summarizes the latency of the requests made over either
+// reused or new connections.
+type ConnLatency struct {
+	Count   int     `json:"count"`
+	Fastest float64 `json:"fastest"`
+	Slowest float64 `json:"slowest"`
+	Average float64 `json:"average"`
+}
+
+// Breakdown is the latency of the requests per stage, and the fraction
+// of requests made over a reused connection. The latency of the requests
+// is also split between reused and new connections, the latter being
+// usually the slowest.
+type Breakdown struct {
+	Stages     []StageStats `json:"stages"`
+	ReuseRatio float64      `json:"reuse_ratio"`
+	Reused     *ConnLatency `json:"reused_connections,omitempty"`
+	New        *ConnLatency `json:"new_connections,omitempty"`
+}
+
+// breakdown aggregates the timings of the successful requests.
+type breakdown struct {
+	hists  [numStages]*latencyHistogram
+	sums   [numStages]float64
+	count  int
+	reused int
+	// Latencies over new and reused connections.
+	newLats, reusedLats connLatency
+}
+
+// connLatency aggregates the latencies of the requests of a kind of
+// connection.
+type connLatency struct {
+	count         int
+	min, max, sum float64
+}
+
+func (c *connLatency) add(lat float64) {
+	if c.count == 0 || lat < c.min {
+		c.min = lat
+	}
+	if lat > c.max {
+		c.max = lat
+	}
+	c.count++
+	c.sum += lat
+}
+
+func (c *connLatency) finalize() *ConnLatency {
+	if c.count == 0 {
+		return nil
+	}
+	return &ConnLatency{
+		Count:   c.count,
+		Fastest: c.min,
+		Slowest: c.max,
+		Average: c.sum / float64(c.count),
+	}
+}
+
+func (b *breakdown) add(tm timings) {
+	b.count++
+	if tm.reused {
+		b.reused++
+	}
+	for i, d := range tm.stages {
+		if d <= 0 {
+			continue
+		}
+		if b.hists[i] == nil {
+			b.hists[i] = newLatencyHistogram()
+		}
+		b.hists[i].add(d.Seconds())
+		b.sums[i] += d.Seconds()
+	}
+}
+
+// Adds the latency of a request, in seconds, made over a reused
+// connection or not.
+func (b *breakdown) addLatency(reused bool, lat float64) {
+	if reused {
+		b.reusedLats.add(lat)
+	} else {
+		b.newLats.add(lat)
+	}
+}
+
+func (b *breakdown) finalize() *Breakdown {
+	if b.count == 0 {
+		return nil
+	}
+	bd := &Breakdown{
+		ReuseRatio: float64(b.reused) / float64(b.count),
+		Reused:     b.reusedLats.finalize(),
+		New:        b.newLats.finalize(),
+	}
+	for i, h := range b.hists {
+		if h == nil {
+			continue
+		}
+		bd.Stages = append(bd.Stages, StageStats{
+			Stage:   stageNames[i],
+			Count:   h.count,
+			Average: b.sums[i] / float64(h.count),
+			P99:     h.percentile(99),
+		})
+	}
+	return bd
+}
+
+func (r *Report) printBreakdown() {
+	fmt.Fprintf(r.w, "\nLatency breakdown:\n")
+	for _, st := range r.Breakdown.Stages {
+		label := st.Stage
+		for i, name := range stageNames {
+			if name == st.Stage {
+				label = stageLabels[i]
+			}
+		}
+		fmt.Fprintf(r.w, "  %s:\t%4.4f secs average, %4.4f secs p99, %d requests.\n", label, st.Average, st.P99, st.Count)
+	}
+	fmt.Fprintf(r.w, "  Connection reuse:\t%.2f%%\n", r.Breakdown.ReuseRatio*100)
+	if c := r.Breakdown.Reused; c != nil {
+		fmt.Fprintf(r.w, "  Reused connections:\t%4.4f secs fastest, %4.4f secs slowest, %4.4f secs average, %d requests.\n", c.Fastest, c.Slowest, c.Average, c.Count)
+	}
+	if c := r.Breakdown.New; c != nil {
+		fmt.Fprintf(r.w, "  New connections:\t%4.4f secs fastest, %4.4f secs slowest, %4.4f secs average, %d requests.\n", c.Fastest, c.Slowest, c.Average, c.Count)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBreakdown(t *testing.T) {
+	var b breakdown
+	var first timings
+	first.stages[stageConnect] = 2 * time.Millisecond
+	first.stages[stageWait] = 10 * time.Millisecond
+	b.add(first)
+	for i := 0; i < 3; i++ {
+		var tm timings
+		tm.reused = true
+		tm.stages[stageWait] = 20 * time.Millisecond
+		b.add(tm)
+	}
+	bd := b.finalize()
+	if bd.ReuseRatio != 0.75 {
+		t.Errorf("Expected a reuse ratio of 0.75, %v is found", bd.ReuseRatio)
+	}
+	if len(bd.Stages) != 2 {
+		t.Fatalf("Expected the connect and wait stages only, %+v is found", bd.Stages)
+	}
+	// The connect stage is only over the request that connected.
+	if st := bd.Stages[0]; st.Stage != "connect" || st.Count != 1 || st.Average != 0.002 {
+		t.Errorf("Expected 1 connect of 0.002 secs, %+v is found", st)
+	}
+	if st := bd.Stages[1]; st.Stage != "wait" || st.Count != 4 || st.Average != 0.0175 {
+		t.Errorf("Expected 4 waits of 0.0175 secs on average, %+v is found", st)
+	}
+}
+
+func TestBreakdown_Run(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "GET",
+			Url:    server.URL,
+		},
+		N:             10,
+		C:             1,
+		AllowInsecure: true,
+		Output:        "json",
+		Writer:        ioutil.Discard,
+	}
+	rpt := boom.Run()
+	bd := rpt.Breakdown
+	if bd == nil {
+		t.Fatalf("Expected a latency breakdown")
+	}
+	if bd.ReuseRatio != 0.9 {
+		t.Errorf("Expected a reuse ratio of 0.9, %v is found", bd.ReuseRatio)
+	}
+	if bd.Reused == nil || bd.Reused.Count != 9 || bd.New == nil || bd.New.Count != 1 {
+		t.Errorf("Expected 9 requests over a reused connection and 1 over a new one, %+v and %+v are found", bd.Reused, bd.New)
+	} else if bd.Reused.Fastest > bd.Reused.Slowest || bd.New.Fastest != bd.New.Slowest {
+		t.Errorf("Expected the fastest requests to be faster than the slowest ones, %+v and %+v are found", bd.Reused, bd.New)
+	}
+	counts := make(map[string]int)
+	for _, st := range bd.Stages {
+		counts[st.Stage] = st.Count
+	}
+	if counts["dns"] != 0 || counts["connect"] != 1 || counts["tls"] != 1 || counts["wait"] != 10 || counts["transfer"] != 10 {
+		t.Errorf("Expected a single connection, %v is found", counts)
+	}
+}
+
+func TestExpectContinue(t *testing.T) {
+	// The server replies 100 Continue as the handler reads the body.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Expect") != "100-continue" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    server.URL,
+			Body:   "body",
+		},
+		N:              5,
+		C:              1,
+		ExpectContinue: true,
+		Output:         "json",
+		Writer:         ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.StatusCodeDist[http.StatusOK] != 5 {
+		t.Fatalf("Expected 5 responses with an Expect header, %v is found", rpt.StatusCodeDist)
+	}
+	counts := make(map[string]int)
+	for _, st := range rpt.Breakdown.Stages {
+		counts[st.Stage] = st.Count
+	}
+	if counts["continue"] != 5 || counts["wait"] != 5 {
+		t.Errorf("Expected 5 continue and wait stages, %v is found", counts)
+	}
+	if rpt.ContinueTimeouts != 0 {
+		t.Errorf("Expected no continue timeout, %v is found", rpt.ContinueTimeouts)
+	}
+}
+
+func TestExpectContinue_Timeout(t *testing.T) {
+	// The server ignores the Expect header, and waits for the body.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					req, err := http.ReadRequest(br)
+					if err != nil {
+						return
+					}
+					ioutil.ReadAll(req.Body)
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				}
+			}()
+		}
+	}()
+
+	boom := &Boom{
+		Req: &ReqOpts{
+			Method: "POST",
+			Url:    "http://" + l.Addr().String(),
+			Body:   "body",
+		},
+		N:               3,
+		C:               1,
+		ExpectContinue:  true,
+		ContinueTimeout: 20 * time.Millisecond,
+		Output:          "json",
+		Writer:          ioutil.Discard,
+	}
+	rpt := boom.Run()
+	if rpt.StatusCodeDist[http.StatusOK] != 3 {
+		t.Fatalf("Expected 3 responses, %v is found", rpt.StatusCodeDist)
+	}
+	if rpt.ContinueTimeouts != 3 {
+		t.Errorf("Expected 3 continue timeouts, %v is found", rpt.ContinueTimeouts)
+	}
+	for _, st := range rpt.Breakdown.Stages {
+		if st.Stage == "continue" {
+			t.Errorf("Expected no continue stage, %+v is found", st)
+		}
+	}
+}
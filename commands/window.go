@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// window aggregates the results collected during the current interval
+// of the live summaries, apart from the report. It is reset once the
+// summary of the interval is printed, and only used by the goroutine
+// collecting the results.
+type window struct {
+	length time.Duration
+	start  time.Time
+	count  int
+	errors int
+	lh     *latencyHistogram
+}
+
+func newWindow(length time.Duration, start time.Time) *window {
+	return &window{length: length, start: start, lh: newLatencyHistogram()}
+}
+
+// Adds a collected result, warmup included.
+func (w *window) add(res *result) {
+	w.count++
+	if res.err != nil {
+		w.errors++
+	} else {
+		w.lh.add(res.duration.Seconds())
+	}
+}
+
+// Returns the summary of the interval ending at now, e.g.
+// "last 10s: 1,204 req, p50 38.000ms, p99 210.000ms, 3 errors",
+// and starts the next one.
+func (w *window) flush(now time.Time) string {
+	s := fmt.Sprintf("last %v: %s req, p50 %s, p99 %s, %d errors",
+		now.Sub(w.start).Round(100*time.Millisecond), formatCount(w.count),
+		formatLatency(w.lh.percentile(50)), formatLatency(w.lh.percentile(99)), w.errors)
+	w.start = now
+	w.count, w.errors = 0, 0
+	for i := range w.lh.counts {
+		w.lh.counts[i] = 0
+	}
+	w.lh.count = 0
+	return s
+}
+
+// Formats n with a comma between groups of thousands, e.g. 1,204.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindowFlush(t *testing.T) {
+	start := time.Now()
+	w := newWindow(10*time.Second, start)
+	for i := 0; i < 1204; i++ {
+		w.add(&result{duration: 38 * time.Millisecond})
+	}
+	w.add(&result{duration: 210 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		w.add(&result{err: errors.New("refused")})
+	}
+	want := "last 10s: 1,208 req, p50 38.000ms, p99 38.000ms, 3 errors"
+	if s := w.flush(start.Add(10 * time.Second)); s != want {
+		t.Errorf("Expected %q, %q is found", want, s)
+	}
+	// The next interval starts over.
+	w.add(&result{duration: 2 * time.Second})
+	want = "last 2.5s: 1 req, p50 2.000s, p99 2.000s, 0 errors"
+	if s := w.flush(start.Add(12500 * time.Millisecond)); s != want {
+		t.Errorf("Expected %q, %q is found", want, s)
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 1234567: "1,234,567", -4500: "-4,500"} {
+		if s := formatCount(n); s != want {
+			t.Errorf("Expected %v to be formatted as %q, %q is found", n, want, s)
+		}
+	}
+}
+
+func TestProgressInterval(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(10, time.Hour, &buf)
+	p.Start()
+	p.increment(nil)
+	p.printInterval("last 10s: 1 req")
+	p.Finish()
+	if s := buf.String(); !strings.Contains(s, "\r\033[Klast 10s: 1 req\n\r1 / 10 requests") {
+		t.Errorf("Expected the summary above the progress line, %q is found", s)
+	}
+
+	buf.Reset()
+	p = newProgress(0, time.Hour, &buf)
+	p.line = false
+	p.Start()
+	p.printInterval("last 10s: 1 req")
+	p.Finish()
+	if s := buf.String(); s != "last 10s: 1 req\n" {
+		t.Errorf("Expected the summary only, %q is found", s)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/boom/commands"
+)
+
+// Prints the changes between two JSON reports, the arguments are those
+// following "compare". Exits with a non-zero code if a metric regressed
+// by more than the threshold, if set.
+func compare(args []string) {
+	var paths []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		paths, args = append(paths, args[0]), args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	paths = append(paths, flag.Args()...)
+	if len(paths) != 2 {
+		usageAndExit("compare requires two JSON reports.")
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "regression-threshold" && f.Name != "regression-metrics" {
+			usageAndExit(fmt.Sprintf("%s cannot be used with compare.", f.Name))
+		}
+	})
+	threshold, err := parseThreshold(*flagRegression)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+	var metrics []string
+	if *flagRegressOn != "" {
+		if threshold == 0 {
+			usageAndExit("regression-metrics requires regression-threshold.")
+		}
+		metrics = strings.Split(*flagRegressOn, ",")
+	}
+
+	before, err := commands.LoadReport(paths[0])
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+	after, err := commands.LoadReport(paths[1])
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+	if diff := commands.Differences(before, after); len(diff) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the runs differ in %s.\n", strings.Join(diff, ", "))
+	}
+	deltas := commands.Compare(before, after)
+	for i, m := range metrics {
+		metrics[i] = strings.TrimSpace(m)
+		found := false
+		for _, d := range deltas {
+			found = found || d.Metric == metrics[i]
+		}
+		if !found {
+			usageAndExit(fmt.Sprintf("Unknown metric %q, not in both reports.", m))
+		}
+	}
+	commands.PrintDeltas(os.Stdout, deltas, threshold, metrics)
+	if len(commands.Regressions(deltas, threshold, metrics)) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Parses a percentage, e.g. 5%, zero if empty.
+func parseThreshold(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("Invalid regression threshold %q.", s)
+	}
+	return v, nil
+}
+
+// Metrics a regression limit can be set on.
+var regressionMetric = regexp.MustCompile(`^(rps|average|error_rate|p[0-9]+(\.[0-9]+)?)$`)
+
+// Parses the limits of the regressions, metric=percentage pairs, e.g.
+// p99=10%,rps=5%.
+func parseMaxRegression(s string) (map[string]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	limits := make(map[string]float64)
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		metric := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !regressionMetric.MatchString(metric) {
+			return nil, fmt.Errorf("Invalid max-regression %q, metric=percentage is expected.", kv)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(parts[1]), "%"), 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("Invalid max-regression %q, metric=percentage is expected.", kv)
+		}
+		limits[metric] = v
+	}
+	return limits, nil
+}
+
+// Writes the report as the new baseline, as the json output does.
+func writeBaseline(path string, rpt *commands.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rpt.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,415 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Keys of a config file that stand for a flag of another name, besides
+// the names of the flags themselves.
+var configAliases = map[string]string{
+	"method":       "m",
+	"headers":      "H",
+	"body":         "d",
+	"body-file":    "D",
+	"content-type": "T",
+	"requests":     "n",
+	"concurrency":  "c",
+	"qps":          "q",
+	"timeout":      "t",
+	"duration":     "z",
+	"output":       "o",
+}
+
+// configValue is the value of a key of a config file.
+type configValue struct {
+	key  string
+	line int
+	// Values of a list, or a single one.
+	values []string
+	list   bool
+}
+
+// runConfig is the options of a config file, in the order of its keys.
+type runConfig struct {
+	url    string
+	values []configValue
+}
+
+// Reads a config file, either a JSON object or YAML, whose keys are the
+// names of the flags or their aliases.
+func loadConfig(path string) (*runConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values []configValue
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		values, err = parseJSONConfig(b)
+	} else {
+		values, err = parseYAMLConfig(string(b))
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &runConfig{}
+	seen := make(map[string]bool)
+	for _, v := range values {
+		name := v.key
+		if alias, ok := configAliases[name]; ok {
+			name = alias
+		}
+		switch {
+		case seen[name]:
+			return nil, fmt.Errorf("config line %d: %s is already set.", v.line, v.key)
+		case name == "url":
+			if v.list || v.values[0] == "" {
+				return nil, fmt.Errorf("config line %d: url must be a single value.", v.line)
+			}
+			c.url = v.values[0]
+		case name == "config" || flag.Lookup(name) == nil:
+			return nil, fmt.Errorf("config line %d: unknown key %q.", v.line, v.key)
+		case v.list && !isListFlag(name):
+			return nil, fmt.Errorf("config line %d: %s must be a single value.", v.line, v.key)
+		}
+		seen[name] = true
+		if name != "url" {
+			v.key = name
+			c.values = append(c.values, v)
+		}
+	}
+	return c, nil
+}
+
+// Whether the flag can be repeated.
+func isListFlag(name string) bool {
+	f := flag.Lookup(name)
+	if f == nil {
+		return false
+	}
+	_, ok := f.Value.(*stringsFlag)
+	return ok
+}
+
+// Sets the flags of the config that are not set on the command line,
+// which wins. The headers of the config are kept unless a header of the
+// same name is set on the command line.
+func (c *runConfig) apply() error {
+	for _, v := range c.values {
+		if v.key == "H" {
+			if err := c.applyHeaders(v); err != nil {
+				return err
+			}
+			continue
+		}
+		if isFlagSet(v.key) {
+			continue
+		}
+		for _, s := range v.values {
+			if err := flag.Set(v.key, s); err != nil {
+				return fmt.Errorf("config line %d: invalid value %q for %s.", v.line, s, v.key)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *runConfig) applyHeaders(v configValue) error {
+	set := make(map[string]bool)
+	for _, h := range flagHeader {
+		if name, _, err := parseHeader(h); err == nil {
+			set[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	var headers stringsFlag
+	for _, h := range v.values {
+		name, _, err := parseHeader(h)
+		if err != nil {
+			return fmt.Errorf("config line %d: invalid header %q.", v.line, h)
+		}
+		if !set[http.CanonicalHeaderKey(name)] {
+			headers = append(headers, h)
+		}
+	}
+	flagHeader = append(headers, flagHeader...)
+	return nil
+}
+
+// Parses the subset of YAML a config needs: "key: value" lines, whose
+// value can be quoted or a | block, and lists of "- value" lines or, for
+// the headers, "Name: value" lines indented under their key.
+func parseYAMLConfig(s string) ([]configValue, error) {
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	var values []configValue
+	for i := 0; i < len(lines); i++ {
+		line := stripComment(lines[i])
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("config line %d: unexpected indentation.", i+1)
+		}
+		key, value, ok := splitYAMLKey(line)
+		if !ok {
+			return nil, fmt.Errorf("config line %d: expected a key: value line.", i+1)
+		}
+		v := configValue{key: key, line: i + 1}
+		switch {
+		case value == "|" || value == "|-":
+			// Literal block, its lines are those indented.
+			var block []string
+			for i+1 < len(lines) && (strings.TrimSpace(lines[i+1]) == "" || lines[i+1][0] == ' ') {
+				i++
+				block = append(block, lines[i])
+			}
+			text := strings.TrimRight(unindent(block), "\n")
+			if value == "|" {
+				text += "\n"
+			}
+			v.values = []string{text}
+		case value == "":
+			// List or mapping, of the indented lines.
+			v.list = true
+			for i+1 < len(lines) {
+				item := strings.TrimSpace(stripComment(lines[i+1]))
+				if item == "" {
+					i++
+					continue
+				}
+				if lines[i+1][0] != ' ' && lines[i+1][0] != '\t' {
+					break
+				}
+				i++
+				if strings.HasPrefix(item, "- ") || item == "-" {
+					s, err := unquoteYAML(strings.TrimSpace(item[1:]))
+					if err != nil {
+						return nil, fmt.Errorf("config line %d: %s: %v.", i+1, key, err)
+					}
+					v.values = append(v.values, s)
+					continue
+				}
+				name, s, ok := splitYAMLKey(item)
+				if !ok || configAliases[key] != "H" && key != "H" {
+					return nil, fmt.Errorf("config line %d: %s: expected a - value line.", i+1, key)
+				}
+				s, err := unquoteYAML(s)
+				if err != nil {
+					return nil, fmt.Errorf("config line %d: %s: %v.", i+1, key, err)
+				}
+				v.values = append(v.values, name+": "+s)
+			}
+			if len(v.values) == 0 {
+				return nil, fmt.Errorf("config line %d: %s has no value.", v.line, key)
+			}
+		case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{"):
+			return nil, fmt.Errorf("config line %d: %s: flow lists and mappings are not supported.", i+1, key)
+		default:
+			s, err := unquoteYAML(value)
+			if err != nil {
+				return nil, fmt.Errorf("config line %d: %s: %v.", i+1, key, err)
+			}
+			v.values = []string{s}
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Splits a "key: value" line, the value is trimmed.
+func splitYAMLKey(line string) (key, value string, ok bool) {
+	i := strings.Index(line, ":")
+	if i <= 0 || i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '\t' {
+		return "", "", false
+	}
+	key = strings.TrimSpace(line[:i])
+	if k, err := unquoteYAML(key); err == nil {
+		key = k
+	}
+	return key, strings.TrimSpace(line[i+1:]), key != ""
+}
+
+// Removes the comment of a line, a # at its start or after a space and
+// outside of quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' || line[i-1] == ':' {
+				quote = ch
+			}
+		case ch == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// Unquotes a single or double quoted scalar, others are kept as is.
+func unquoteYAML(s string) (string, error) {
+	if len(s) == 0 || s[0] != '"' && s[0] != '\'' {
+		return s, nil
+	}
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", errors.New("unterminated quote")
+	}
+	if s[0] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	u, err := strconv.Unquote(s)
+	if err != nil {
+		return "", errors.New("invalid quoted value")
+	}
+	return u, nil
+}
+
+// Removes the indentation the lines share.
+func unindent(lines []string) string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if n := len(l) - len(strings.TrimLeft(l, " ")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			l = l[indent:]
+		} else {
+			l = strings.TrimLeft(l, " ")
+		}
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Parses a JSON object whose values are scalars, lists of scalars or,
+// for the headers, an object of names to values.
+func parseJSONConfig(b []byte) ([]configValue, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	lineAt := func() int {
+		return bytes.Count(b[:dec.InputOffset()], []byte("\n")) + 1
+	}
+	fail := func(err error) error {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("config line %d: %v.", lineAt(), err)
+	}
+	if t, err := dec.Token(); err != nil {
+		return nil, fail(err)
+	} else if t != json.Delim('{') {
+		return nil, fmt.Errorf("config line %d: expected an object.", lineAt())
+	}
+	var values []configValue
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, fail(err)
+		}
+		v := configValue{key: t.(string), line: lineAt()}
+		if t, err = dec.Token(); err != nil {
+			return nil, fail(err)
+		}
+		switch t {
+		case json.Delim('['):
+			v.list = true
+			for dec.More() {
+				s, err := jsonScalar(dec)
+				if err != nil {
+					return nil, fmt.Errorf("config line %d: %s: %v.", lineAt(), v.key, err)
+				}
+				v.values = append(v.values, s)
+			}
+			dec.Token()
+		case json.Delim('{'):
+			if v.key != "H" && configAliases[v.key] != "H" {
+				return nil, fmt.Errorf("config line %d: %s must not be an object.", v.line, v.key)
+			}
+			v.list = true
+			for dec.More() {
+				name, err := dec.Token()
+				if err != nil {
+					return nil, fail(err)
+				}
+				s, err := jsonScalar(dec)
+				if err != nil {
+					return nil, fmt.Errorf("config line %d: %s: %v.", lineAt(), v.key, err)
+				}
+				v.values = append(v.values, name.(string)+": "+s)
+			}
+			dec.Token()
+		default:
+			s, err := scalarString(t)
+			if err != nil {
+				return nil, fmt.Errorf("config line %d: %s: %v.", v.line, v.key, err)
+			}
+			v.values = []string{s}
+		}
+		if v.list && len(v.values) == 0 {
+			return nil, fmt.Errorf("config line %d: %s has no value.", v.line, v.key)
+		}
+		values = append(values, v)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fail(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("config line %d: unexpected data after the object.", lineAt())
+	}
+	return values, nil
+}
+
+func jsonScalar(dec *json.Decoder) (string, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	return scalarString(t)
+}
+
+// Returns the string of a scalar token, as it would be given to a flag.
+func scalarString(t json.Token) (string, error) {
+	switch t := t.(type) {
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+	return "", errors.New("expected a string, number or boolean")
+}
@@ -0,0 +1,150 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	want := &runConfig{
+		url: "https://example.com/items",
+		values: []configValue{
+			{key: "m", line: 3, values: []string{"POST"}},
+			{key: "n", line: 4, values: []string{"100"}},
+			{key: "t", line: 5, values: []string{"5"}},
+			{key: "H", line: 6, values: []string{"Content-Type: application/json", "X-Id: a # b"}, list: true},
+			{key: "d", line: 9, values: []string{"{\n  \"a\": 1\n}\n"}},
+			{key: "resolve", line: 13, values: []string{"example.com:443:127.0.0.1"}, list: true},
+			{key: "allow-insecure", line: 15, values: []string{"true"}},
+		},
+	}
+	yaml := `# Run of the items API.
+url: https://example.com/items
+method: POST
+n: 100 # requests
+timeout: 5
+headers:
+  Content-Type: application/json
+  X-Id: "a # b"
+body: |
+  {
+    "a": 1
+  }
+resolve:
+  - example.com:443:127.0.0.1
+allow-insecure: true
+`
+	c, err := loadConfig(writeConfig(t, "run.yaml", yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Expected %+v, %+v is found", want, c)
+	}
+
+	json := `{
+  "url": "https://example.com/items",
+  "method": "POST",
+  "n": 100,
+  "timeout": 5,
+  "headers": {"Content-Type": "application/json",
+    "X-Id": "a # b"},
+  "body": "{\n  \"a\": 1\n}\n",
+  "x": 1, "y": 2, "z": 3,
+  "resolve": ["example.com:443:127.0.0.1"], "u": 0,
+  "w": 0,
+  "allow-insecure": true
+}`
+	if _, err := loadConfig(writeConfig(t, "run.json", json)); err == nil || err.Error() != `config line 9: unknown key "y".` {
+		t.Errorf("Expected an unknown key error, %v is found", err)
+	}
+}
+
+func TestLoadConfig_JSON(t *testing.T) {
+	json := `{
+  "url": "https://example.com/items",
+  "c": 10,
+  "headers": {"Accept": "*/*"},
+  "resolve": ["a.com:443:127.0.0.1", "b.com:443:127.0.0.1"],
+  "disable-keepalive": false
+}`
+	c, err := loadConfig(writeConfig(t, "run.json", json))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &runConfig{
+		url: "https://example.com/items",
+		values: []configValue{
+			{key: "c", line: 3, values: []string{"10"}},
+			{key: "H", line: 4, values: []string{"Accept: */*"}, list: true},
+			{key: "resolve", line: 5, values: []string{"a.com:443:127.0.0.1", "b.com:443:127.0.0.1"}, list: true},
+			{key: "disable-keepalive", line: 6, values: []string{"false"}},
+		},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Expected %+v, %+v is found", want, c)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{"n: 1\nfoo: 2\n", `config line 2: unknown key "foo".`},
+		{"n: 1\nrequests: 2\n", "config line 2: requests is already set."},
+		{"n:\n  - 1\n  - 2\n", "config line 1: n must be a single value."},
+		{"n: 1\n  c: 2\n", "config line 2: unexpected indentation."},
+		{"url\n", "config line 1: expected a key: value line."},
+		{"resolve:\n  a: b\n", "config line 2: resolve: expected a - value line."},
+		{"H: [a]\n", "config line 1: H: flow lists and mappings are not supported."},
+		{"d: \"abc\n", "config line 1: d: unterminated quote."},
+		{"config: a.yaml\n", `config line 1: unknown key "config".`},
+		{"{\n  \"n\": 1,\n  \"d\": {\"a\": 1}\n}", "config line 3: d must not be an object."},
+		{"{\n  \"n\": [1, {}]\n}", "config line 2: n: expected a string, number or boolean."},
+		{"{\n  \"n\": 1\n", "config line 2: unexpected end of JSON input."},
+	}
+	for _, tt := range tests {
+		if _, err := loadConfig(writeConfig(t, "run", tt.data)); err == nil || err.Error() != tt.err {
+			t.Errorf("Expected %q for %q, %v is found", tt.err, tt.data, err)
+		}
+	}
+}
+
+func TestConfigApplyHeaders(t *testing.T) {
+	defer func(h stringsFlag) { flagHeader = h }(flagHeader)
+	flagHeader = stringsFlag{"accept: text/plain"}
+	c := &runConfig{}
+	v := configValue{key: "H", line: 1, values: []string{"Accept: */*", "X-Id: 1"}, list: true}
+	if err := c.applyHeaders(v); err != nil {
+		t.Fatal(err)
+	}
+	want := stringsFlag{"X-Id: 1", "accept: text/plain"}
+	if !reflect.DeepEqual(flagHeader, want) {
+		t.Errorf("Expected %v, %v is found", want, flagHeader)
+	}
+}
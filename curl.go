@@ -0,0 +1,321 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// curlRequest is the request of a curl command line.
+type curlRequest struct {
+	method string
+	url    string
+	// Headers, "Name: value", in the order they are given.
+	header []string
+	// Body, and whether one is set, possibly empty.
+	body    string
+	hasBody bool
+	// Credentials, username:password.
+	user     string
+	insecure bool
+}
+
+// Long names of the supported curl flags, and whether they take a value.
+var curlFlags = map[string]bool{
+	"--request":     true,
+	"--header":      true,
+	"--data":        true,
+	"--data-raw":    true,
+	"--data-ascii":  true,
+	"--data-binary": true,
+	"--user":        true,
+	"--user-agent":  true,
+	"--url":         true,
+	"--compressed":  false,
+	"--insecure":    false,
+	"--location":    false,
+}
+
+// Short names of the supported curl flags.
+var curlShortFlags = map[byte]string{
+	'X': "--request",
+	'H': "--header",
+	'd': "--data",
+	'u': "--user",
+	'A': "--user-agent",
+	'k': "--insecure",
+	'L': "--location",
+}
+
+// Unsupported curl flags that take a value, it is skipped along with them.
+var curlValueFlags = map[string]bool{
+	"-b": true, "--cookie": true, "-c": true, "--cookie-jar": true,
+	"-e": true, "--referer": true, "-F": true, "--form": true,
+	"-o": true, "--output": true, "-w": true, "--write-out": true,
+	"-x": true, "--proxy": true, "-m": true, "--max-time": true,
+	"-T": true, "--upload-file": true, "-E": true, "--cert": true,
+	"--key": true, "--cacert": true, "--connect-timeout": true,
+	"--resolve": true, "-r": true, "--range": true, "--retry": true,
+	"--data-urlencode": true, "-K": true, "--config": true,
+}
+
+// Parses a curl command line into a request. Unsupported flags are
+// ignored, a warning is returned for each of them.
+func parseCurl(cmd string) (*curlRequest, []string, error) {
+	args, err := splitCommandLine(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+	c := &curlRequest{}
+	var warnings []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var (
+			name  string
+			value string
+			// Set if the value is attached to a short flag, e.g. -XPOST.
+			attached bool
+		)
+		switch {
+		case arg == "--":
+			// The rest of the arguments are URLs.
+			for _, u := range args[i+1:] {
+				if err := c.setUrl(u); err != nil {
+					return nil, nil, err
+				}
+			}
+			i = len(args)
+			continue
+		case !strings.HasPrefix(arg, "-"):
+			if err := c.setUrl(arg); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case strings.HasPrefix(arg, "--"):
+			name = arg
+		default:
+			// Short flags can be grouped, e.g. -sk, the value of the
+			// last one can follow it, e.g. -XPOST.
+			for j := 1; j < len(arg) && name == ""; j++ {
+				long, ok := curlShortFlags[arg[j]]
+				switch {
+				case !ok:
+					warnings = append(warnings, fmt.Sprintf("curl flag -%c is not supported, ignored.", arg[j]))
+					if curlValueFlags["-"+string(arg[j])] {
+						if j == len(arg)-1 {
+							i++
+						}
+						j = len(arg)
+					}
+				case curlFlags[long]:
+					name = long
+					if j < len(arg)-1 {
+						value, attached = arg[j+1:], true
+					}
+				default:
+					c.setFlag(long, "")
+				}
+			}
+			if name == "" {
+				continue
+			}
+		}
+		takesValue, ok := curlFlags[name]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("curl flag %s is not supported, ignored.", name))
+			if curlValueFlags[name] {
+				i++
+			}
+			continue
+		}
+		if takesValue && !attached {
+			if i+1 == len(args) {
+				return nil, nil, fmt.Errorf("curl flag %s requires a value.", arg)
+			}
+			i++
+			value = args[i]
+		}
+		if err := c.setFlag(name, value); err != nil {
+			return nil, nil, err
+		}
+	}
+	if c.url == "" {
+		return nil, nil, errors.New("curl command has no URL.")
+	}
+	if c.method == "" {
+		c.method = "GET"
+		if c.hasBody {
+			c.method = "POST"
+		}
+	}
+	return c, warnings, nil
+}
+
+func (c *curlRequest) setUrl(u string) error {
+	if c.url != "" {
+		return errors.New("curl command has more than one URL.")
+	}
+	c.url = u
+	return nil
+}
+
+// Sets the option of a supported flag, by its long name.
+func (c *curlRequest) setFlag(name, value string) error {
+	switch name {
+	case "--request":
+		c.method = strings.ToUpper(value)
+	case "--header":
+		c.header = append(c.header, value)
+	case "--user-agent":
+		c.header = append(c.header, "User-Agent: "+value)
+	case "--data", "--data-ascii", "--data-raw", "--data-binary":
+		if strings.HasPrefix(value, "@") && name != "--data-raw" {
+			b, err := ioutil.ReadFile(value[1:])
+			if err != nil {
+				return err
+			}
+			value = string(b)
+			if name != "--data-binary" {
+				// As curl does, line breaks of the file are removed.
+				value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+			}
+		}
+		// Repeated data is joined as form fields.
+		if c.hasBody {
+			c.body += "&"
+		}
+		c.body += value
+		c.hasBody = true
+	case "--user":
+		c.user = value
+	case "--url":
+		return c.setUrl(value)
+	case "--insecure":
+		c.insecure = true
+	case "--compressed", "--location":
+		// Responses are decompressed and redirects followed by default.
+	}
+	return nil
+}
+
+// Sets the flags of the request that are not explicitly set already.
+// The headers of the request come before those of the -H flags.
+func (c *curlRequest) apply() {
+	set := func(name, value string) {
+		if !isFlagSet(name) {
+			flag.Set(name, value)
+		}
+	}
+	set("m", c.method)
+	if c.hasBody {
+		set("d", c.body)
+		set("T", "application/x-www-form-urlencoded")
+	}
+	if c.user != "" {
+		set("a", c.user)
+	}
+	if c.insecure {
+		set("allow-insecure", "true")
+	}
+	flagHeader = append(stringsFlag(c.header), flagHeader...)
+}
+
+// Escapes of the $'...' quotes, besides the numeric ones.
+var curlEscapes = map[byte]byte{
+	'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"',
+}
+
+// Splits a command line into its arguments, as a POSIX shell would
+// with single and double quotes, $'...' quotes, backslashes and line
+// continuations.
+func splitCommandLine(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote byte
+	)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				arg.WriteByte(ch)
+			}
+		case quote == '$':
+			// ANSI-C quoting, as in the commands copied from browsers.
+			switch {
+			case ch == '\'':
+				quote = 0
+			case ch == '\\' && i+1 < len(s):
+				i++
+				if r, ok := curlEscapes[s[i]]; ok {
+					arg.WriteByte(r)
+				} else {
+					arg.WriteByte('\\')
+					arg.WriteByte(s[i])
+				}
+			default:
+				arg.WriteByte(ch)
+			}
+		case quote == '"':
+			switch {
+			case ch == '"':
+				quote = 0
+			case ch == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0:
+				if i++; s[i] != '\n' {
+					arg.WriteByte(s[i])
+				}
+			default:
+				arg.WriteByte(ch)
+			}
+		case ch == '\'' || ch == '"':
+			quote, inArg = ch, true
+		case ch == '$' && i+1 < len(s) && s[i+1] == '\'':
+			quote, inArg = '$', true
+			i++
+		case ch == '\\' && i+1 < len(s):
+			if i++; s[i] != '\n' {
+				arg.WriteByte(s[i])
+				inArg = true
+			}
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("curl command has an unterminated quote.")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCurl(t *testing.T) {
+	tests := []struct {
+		cmd      string
+		want     curlRequest
+		warnings []string
+	}{
+		{
+			cmd:  `curl https://example.com/path`,
+			want: curlRequest{method: "GET", url: "https://example.com/path"},
+		},
+		{
+			cmd: `curl -X PUT -H 'Content-Type: application/json' -H "X-Id: \"1\"" -d '{"a": 1}' https://example.com/items`,
+			want: curlRequest{
+				method:  "PUT",
+				url:     "https://example.com/items",
+				header:  []string{"Content-Type: application/json", `X-Id: "1"`},
+				body:    `{"a": 1}`,
+				hasBody: true,
+			},
+		},
+		{
+			// The method defaults to POST with a body, repeated data is
+			// joined.
+			cmd:  `curl 'http://a.com/form' -d a=1 --data-raw b=2`,
+			want: curlRequest{method: "POST", url: "http://a.com/form", body: "a=1&b=2", hasBody: true},
+		},
+		{
+			// Copied from a browser, with line continuations.
+			cmd: "curl 'https://a.com/api' \\\n  -H 'accept: */*' \\\n  --data-binary $'{\\\"a\\\":\\n1}' \\\n  --compressed",
+			want: curlRequest{
+				method:  "POST",
+				url:     "https://a.com/api",
+				header:  []string{"accept: */*"},
+				body:    "{\"a\":\n1}",
+				hasBody: true,
+			},
+		},
+		{
+			cmd:  `curl -sSk -XDELETE -u user:pass -A boom/1.0 -L http://a.com/1`,
+			want: curlRequest{method: "DELETE", url: "http://a.com/1", header: []string{"User-Agent: boom/1.0"}, user: "user:pass", insecure: true},
+			warnings: []string{
+				"curl flag -s is not supported, ignored.",
+				"curl flag -S is not supported, ignored.",
+			},
+		},
+		{
+			// Unsupported flags are skipped along with their value.
+			cmd:  `curl -o out.txt -b 'a=1' --retry 3 --http2 http://a.com/`,
+			want: curlRequest{method: "GET", url: "http://a.com/"},
+			warnings: []string{
+				"curl flag -o is not supported, ignored.",
+				"curl flag -b is not supported, ignored.",
+				"curl flag --retry is not supported, ignored.",
+				"curl flag --http2 is not supported, ignored.",
+			},
+		},
+	}
+	for _, tt := range tests {
+		c, warnings, err := parseCurl(tt.cmd)
+		if err != nil {
+			t.Errorf("Unexpected error for %q, %v", tt.cmd, err)
+			continue
+		}
+		if !reflect.DeepEqual(*c, tt.want) {
+			t.Errorf("Expected %+v for %q, %+v is found", tt.want, tt.cmd, *c)
+		}
+		if !reflect.DeepEqual(warnings, tt.warnings) {
+			t.Errorf("Expected warnings %q for %q, %q are found", tt.warnings, tt.cmd, warnings)
+		}
+	}
+}
+
+func TestParseCurl_Invalid(t *testing.T) {
+	for _, cmd := range []string{
+		`curl -X POST`,
+		`curl http://a.com http://b.com`,
+		`curl -H`,
+		`curl 'http://a.com`,
+	} {
+		if _, _, err := parseCurl(cmd); err == nil {
+			t.Errorf("Expected %q to be rejected", cmd)
+		}
+	}
+}
+
+func TestParseCurl_DataFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "body.txt")
+	ioutil.WriteFile(path, []byte("a=1\nb=2\n"), 0644)
+	c, _, err := parseCurl("curl -d @" + path + " http://a.com/")
+	if err != nil || c.body != "a=1b=2" {
+		t.Errorf("Expected the line breaks of the file to be removed, %q is found", c.body)
+	}
+	c, _, err = parseCurl("curl --data-binary @" + path + " http://a.com/")
+	if err != nil || c.body != "a=1\nb=2\n" {
+		t.Errorf("Expected the file to be kept as is, %q is found", c.body)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/boom/commands"
+)
+
+// Options of the report subcommand, the others are about the requests.
+var reportFlags = map[string]bool{
+	"o":                       true,
+	"output-file":             true,
+	"percentiles":             true,
+	"buckets":                 true,
+	"bucket-width":            true,
+	"hist-scale":              true,
+	"stream-stats":            true,
+	"include-lats":            true,
+	"status":                  true,
+	"fail-on-status-mismatch": true,
+	"non-2xx-errors":          true,
+	"verbose-errors":          true,
+	"sla-p99":                 true,
+	"sla-error-rate":          true,
+	"sla-rps-min":             true,
+	"time-series":             true,
+	"warmup":                  true,
+	"warmup-requests":         true,
+	"influx-measurement":      true,
+}
+
+// Prints the report of a results file written by -record, the arguments
+// are those following "report", the file and the options of the report.
+func report(args []string) {
+	var path string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if path == "" && flag.NArg() == 1 {
+		path = flag.Arg(0)
+	} else if flag.NArg() > 0 {
+		usageAndExit("report takes a single results file.")
+	}
+	if path == "" {
+		usageAndExit("report requires a results file.")
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if !reportFlags[f.Name] {
+			usageAndExit(fmt.Sprintf("%s cannot be used with report.", f.Name))
+		}
+	})
+
+	switch *flagOutput {
+	case "", "csv", "csv-detail", "json", "influx", "html", "md":
+	default:
+		usageAndExit("Invalid output type.")
+	}
+	if *flagStreamStats && (*flagIncludeLats || strings.HasPrefix(*flagOutput, "csv")) {
+		usageAndExit("stream-stats cannot be used with the csv outputs or include-lats.")
+	}
+	if *flagBuckets < 1 || *flagBuckets > 100 {
+		usageAndExit("buckets must be between 1 and 100.")
+	}
+	if *flagBucketWidth < 0 {
+		usageAndExit("bucket-width cannot be negative.")
+	}
+	if err := checkHistScale(); err != nil {
+		usageAndExit(err.Error())
+	}
+	if *flagTimeSeries < 0 {
+		usageAndExit("time-series cannot be negative.")
+	}
+	pctls, err := parsePercentiles(*flagPercentiles)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+	status, err := parseStatus(*flagStatus)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+	if *flagFailOnStatus && len(status) == 0 {
+		usageAndExit("fail-on-status-mismatch requires status.")
+	}
+	sla, err := parseSLA(*flagSLAP99, *flagSLAErrorRate, *flagSLAMinRPS, isFlagSet)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+
+	var (
+		w io.Writer = os.Stdout
+		f *os.File
+	)
+	if *flagOutputFile != "" {
+		if f, err = os.Create(*flagOutputFile); err != nil {
+			usageAndExit(err.Error())
+		}
+		w = f
+	}
+	boom := &commands.Boom{
+		Warmup:         *flagWarmup,
+		WarmupRequests: *flagWarmupN,
+		ExpectedStatus: status,
+		VerboseErrors:  *flagVerboseErrors,
+		Non2xxErrors:   *flagNon2xxErrors,
+		SLA:            sla,
+		TimeSeries:     *flagTimeSeries,
+		Measurement:    *flagMeasurement,
+		Output:         *flagOutput,
+		IncludeLats:    *flagIncludeLats,
+		Percentiles:    pctls,
+		Buckets:        *flagBuckets,
+		BucketWidth:    *flagBucketWidth,
+		HistScale:      *flagHistScale,
+		StreamStats:    *flagStreamStats,
+		Writer:         w,
+	}
+	rpt, err := boom.LoadResults(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rpt.Print()
+	if f != nil {
+		f.Close()
+	}
+	if failed(rpt) {
+		os.Exit(1)
+	}
+}